@@ -0,0 +1,611 @@
+package sshman
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sonnt85/sshman/sshconfig"
+	"gopkg.in/yaml.v3"
+)
+
+// Ansible inventory formats
+const (
+	AnsibleINI  = "ansible-ini"
+	AnsibleYAML = "ansible-yaml"
+)
+
+// ansibleVars ssh options and the ansible host variables they map to
+var ansibleVars = []struct{ key, variable string }{
+	{"hostname", "ansible_host"},
+	{"user", "ansible_user"},
+	{"port", "ansible_port"},
+	{"identityfile", "ansible_ssh_private_key_file"},
+}
+
+// legacy names of the ansible host variables
+var ansibleLegacyVars = map[string]string{
+	"ansible_ssh_host": "ansible_host",
+	"ansible_ssh_user": "ansible_user",
+	"ansible_ssh_port": "ansible_port",
+}
+
+// AnsibleHost a host of an ansible inventory
+type AnsibleHost struct {
+	// Alias inventory hostname
+	Alias string
+	// Groups groups the host belongs to, sorted
+	Groups []string
+	// Vars host variables
+	Vars map[string]string
+}
+
+// Config return the ssh options of the host variables
+func (ah *AnsibleHost) Config() (map[string]string, error) {
+	config := map[string]string{}
+	for _, v := range ansibleVars {
+		if value := ah.Vars[v.variable]; value != "" {
+			config[v.key] = value
+		}
+	}
+	if args := ah.Vars["ansible_ssh_common_args"]; args != "" {
+		options, err := parseSSHArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: ansible_ssh_common_args: %v", ah.Alias, err)
+		}
+		for k, v := range options {
+			config[k] = v
+		}
+	}
+	return config, nil
+}
+
+// parseSSHArgs return the options of ssh command line arguments such as
+// "-o ProxyJump=bastion -J other", the first value of each option wins. The
+// arguments are split like the shell splits them, so that a quoted value
+// such as -o ProxyCommand="ssh -W %h:%p bastion" stays whole.
+func parseSSHArgs(s string) (map[string]string, error) {
+	config := map[string]string{}
+	set := func(k, v string) {
+		k = strings.ToLower(k)
+		if _, ok := config[k]; !ok && v != "" {
+			config[k] = v
+		}
+	}
+	args, err := sshconfig.SplitArgs(s)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		var value string
+		switch {
+		case arg == "-o" || arg == "-J":
+			if i+1 >= len(args) {
+				continue
+			}
+			i++
+			value = args[i]
+		case strings.HasPrefix(arg, "-o") || strings.HasPrefix(arg, "-J"):
+			value = arg[2:]
+		default:
+			continue
+		}
+		if strings.HasPrefix(arg, "-J") {
+			set("proxyjump", value)
+		} else if k, v, ok := strings.Cut(value, "="); ok {
+			set(k, v)
+		} else if k, v, ok := strings.Cut(value, " "); ok {
+			set(k, v)
+		}
+	}
+	return config, nil
+}
+
+// AnsibleHosts return the hosts of the aliases as an ansible inventory. The
+// groups of an alias are read from a "groups: a,b" comment on its Host line,
+// or else from the name of the included file declaring it. Aliases with
+// wildcards are skipped.
+func AnsibleHosts(p string, hosts []*HostConfig) []*AnsibleHost {
+	var result []*AnsibleHost
+	for _, hc := range hosts {
+		if strings.ContainsAny(hc.Alias, "*?!") {
+			continue
+		}
+		ah := &AnsibleHost{Alias: hc.Alias, Groups: aliasGroups(p, hc), Vars: map[string]string{}}
+		for _, v := range ansibleVars {
+			if value := fileValue(hc, v.key); value != "" {
+				ah.Vars[v.variable] = value
+			}
+		}
+		if jump := fileValue(hc, "proxyjump"); jump != "" {
+			ah.Vars["ansible_ssh_common_args"] = "-o ProxyJump=" + jump
+		}
+		result = append(result, ah)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Alias < result[j].Alias })
+	return result
+}
+
+// fileValue return the first value of key read from a config file, the
+// values sshman assumes are left out
+func fileValue(hc *HostConfig, key string) string {
+	for _, s := range hc.Settings {
+		if s.Key == key && s.Source.File != "" {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+func aliasGroups(p string, hc *HostConfig) []string {
+	set := map[string]bool{}
+	for _, hosts := range hc.PathMap {
+		for _, host := range hosts {
+			for _, g := range commentGroups(host.EOLComment) {
+				set[g] = true
+			}
+		}
+	}
+	if len(set) == 0 && hc.Path != "" && hc.Path != p {
+		set[ansibleGroupName(filepath.Base(hc.Path))] = true
+	}
+	groups := make([]string, 0, len(set))
+	for g := range set {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// ansibleGroupInvalid the characters not allowed in ansible group names
+var ansibleGroupInvalid = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// ansibleGroupName turn s into a valid ansible group name
+func ansibleGroupName(s string) string {
+	return ansibleGroupInvalid.ReplaceAllString(s, "_")
+}
+
+// WriteAnsible write hosts as an ansible inventory in format, AnsibleINI or
+// AnsibleYAML, to w
+func WriteAnsible(w io.Writer, format string, hosts []*AnsibleHost) error {
+	switch format {
+	case AnsibleINI:
+		return writeAnsibleINI(w, hosts)
+	case AnsibleYAML:
+		return writeAnsibleYAML(w, hosts)
+	}
+	return fmt.Errorf("unknown ansible format %q, expect %s or %s", format, AnsibleINI, AnsibleYAML)
+}
+
+func writeAnsibleINI(w io.Writer, hosts []*AnsibleHost) error {
+	bw := bufio.NewWriter(w)
+	// a value holding both quotes cannot be quoted in an ini inventory
+	for _, ah := range hosts {
+		for k, v := range ah.Vars {
+			if strings.Contains(v, "'") && strings.Contains(v, `"`) {
+				return fmt.Errorf("alias[%s]: %s %s holds both ' and \", export it as %s", ah.Alias, k, v, AnsibleYAML)
+			}
+		}
+	}
+	line := func(ah *AnsibleHost) {
+		bw.WriteString(ah.Alias)
+		for _, k := range SortKeys(ah.Vars) {
+			v := ah.Vars[k]
+			if strings.ContainsAny(v, " \t'\"#=") {
+				if strings.Contains(v, "'") {
+					v = `"` + v + `"`
+				} else {
+					v = "'" + v + "'"
+				}
+			}
+			fmt.Fprintf(bw, " %s=%s", k, v)
+		}
+		bw.WriteByte('\n')
+	}
+	groups := map[string][]*AnsibleHost{}
+	for _, ah := range hosts {
+		if len(ah.Groups) == 0 {
+			line(ah)
+		}
+		for _, g := range ah.Groups {
+			groups[g] = append(groups[g], ah)
+		}
+	}
+	names := make([]string, 0, len(groups))
+	for g := range groups {
+		names = append(names, g)
+	}
+	sort.Strings(names)
+	for _, g := range names {
+		if bw.Buffered() > 0 {
+			bw.WriteByte('\n')
+		}
+		fmt.Fprintf(bw, "[%s]\n", g)
+		for _, ah := range groups[g] {
+			line(ah)
+		}
+	}
+	return bw.Flush()
+}
+
+// ansibleGroup a group of a yaml ansible inventory
+type ansibleGroup struct {
+	Hosts    map[string]map[string]string `yaml:"hosts,omitempty"`
+	Vars     map[string]string            `yaml:"vars,omitempty"`
+	Children map[string]*ansibleGroup     `yaml:"children,omitempty"`
+}
+
+func writeAnsibleYAML(w io.Writer, hosts []*AnsibleHost) error {
+	all := &ansibleGroup{}
+	for _, ah := range hosts {
+		vars := ah.Vars
+		if len(vars) == 0 {
+			vars = nil
+		}
+		if len(ah.Groups) == 0 {
+			if all.Hosts == nil {
+				all.Hosts = map[string]map[string]string{}
+			}
+			all.Hosts[ah.Alias] = vars
+		}
+		for _, g := range ah.Groups {
+			if all.Children == nil {
+				all.Children = map[string]*ansibleGroup{}
+			}
+			child := all.Children[g]
+			if child == nil {
+				child = &ansibleGroup{Hosts: map[string]map[string]string{}}
+				all.Children[g] = child
+			}
+			child.Hosts[ah.Alias] = vars
+		}
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string]*ansibleGroup{"all": all}); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// ParseAnsible read an ansible inventory, in ini or yaml format, from r. The
+// format is that of the extension of the file r reads, or else guessed from
+// its first line. Group variables apply to the hosts of the group and of its
+// children, host variables win over group variables.
+func ParseAnsible(r io.Reader) ([]*AnsibleHost, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	inv := newAnsibleInventory()
+	if isAnsibleYAML(r, data) {
+		var groups map[string]*ansibleGroup
+		if err := yaml.Unmarshal(data, &groups); err != nil {
+			return nil, fmt.Errorf("yaml inventory: %v", err)
+		}
+		for _, name := range sortedGroups(groups) {
+			inv.addYAML(name, groups[name])
+		}
+	} else if err := inv.parseINI(data); err != nil {
+		return nil, err
+	}
+	return inv.hosts(), nil
+}
+
+// yamlKeyLine a line starting a yaml mapping, an ini host line has no space
+// after the colon of a port
+var yamlKeyLine = regexp.MustCompile(`^(---|[^\s=\[]+:(\s|$))`)
+
+// isAnsibleYAML whether the inventory data read from r is in yaml format
+func isAnsibleYAML(r io.Reader, data []byte) bool {
+	if f, ok := r.(interface{ Name() string }); ok {
+		switch strings.ToLower(filepath.Ext(f.Name())) {
+		case ".yml", ".yaml":
+			return true
+		case ".ini", ".cfg":
+			return false
+		}
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		return yamlKeyLine.MatchString(line)
+	}
+	return false
+}
+
+// ansibleInventory the groups of an inventory being parsed
+type ansibleInventory struct {
+	hostVars  map[string]map[string]string
+	order     []string
+	members   map[string][]string
+	children  map[string][]string
+	groupVars map[string]map[string]string
+}
+
+func newAnsibleInventory() *ansibleInventory {
+	return &ansibleInventory{
+		hostVars:  map[string]map[string]string{},
+		members:   map[string][]string{},
+		children:  map[string][]string{},
+		groupVars: map[string]map[string]string{},
+	}
+}
+
+func (inv *ansibleInventory) addHost(group, alias string, vars map[string]string) {
+	if _, ok := inv.hostVars[alias]; !ok {
+		inv.hostVars[alias] = map[string]string{}
+		inv.order = append(inv.order, alias)
+	}
+	for k, v := range vars {
+		if name, ok := ansibleLegacyVars[k]; ok {
+			k = name
+		}
+		inv.hostVars[alias][k] = v
+	}
+	inv.members[group] = append(inv.members[group], alias)
+}
+
+func (inv *ansibleInventory) addYAML(name string, g *ansibleGroup) {
+	if g == nil {
+		return
+	}
+	aliases := make([]string, 0, len(g.Hosts))
+	for alias := range g.Hosts {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		inv.addHost(name, alias, g.Hosts[alias])
+	}
+	for k, v := range g.Vars {
+		if inv.groupVars[name] == nil {
+			inv.groupVars[name] = map[string]string{}
+		}
+		inv.groupVars[name][k] = v
+	}
+	for _, child := range sortedGroups(g.Children) {
+		inv.children[name] = append(inv.children[name], child)
+		inv.addYAML(child, g.Children[child])
+	}
+}
+
+func sortedGroups(groups map[string]*ansibleGroup) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (inv *ansibleInventory) parseINI(data []byte) error {
+	group, kind := "ungrouped", ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			group, kind, _ = strings.Cut(line[1:len(line)-1], ":")
+			continue
+		}
+		fields, err := splitINI(line)
+		if err != nil {
+			return fmt.Errorf("inventory line %d: %v", n, err)
+		}
+		switch kind {
+		case "vars":
+			k, v, ok := strings.Cut(line, "=")
+			if !ok {
+				return fmt.Errorf("inventory line %d: expect key=value", n)
+			}
+			if inv.groupVars[group] == nil {
+				inv.groupVars[group] = map[string]string{}
+			}
+			inv.groupVars[group][strings.TrimSpace(k)] = strings.Trim(strings.TrimSpace(v), `'"`)
+		case "children":
+			inv.children[group] = append(inv.children[group], fields[0])
+		case "":
+			vars := map[string]string{}
+			for _, f := range fields[1:] {
+				k, v, ok := strings.Cut(f, "=")
+				if !ok {
+					return fmt.Errorf("inventory line %d: expect key=value, got %q", n, f)
+				}
+				vars[k] = v
+			}
+			aliases, err := expandAnsibleRange(fields[0])
+			if err != nil {
+				return fmt.Errorf("inventory line %d: %v", n, err)
+			}
+			for _, alias := range aliases {
+				inv.addHost(group, alias, vars)
+			}
+		default:
+			return fmt.Errorf("inventory line %d: unknown section type %q", n, kind)
+		}
+	}
+	return scanner.Err()
+}
+
+// splitINI split an inventory line on spaces, quoted values stay whole
+func splitINI(line string) ([]string, error) {
+	var fields []string
+	var buf strings.Builder
+	var quote rune
+	for _, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+		case quote == 0 && (c == ' ' || c == '\t'):
+			if buf.Len() > 0 {
+				fields = append(fields, buf.String())
+				buf.Reset()
+			}
+		case quote == 0 && c == '#':
+			// trailing comment
+			if buf.Len() > 0 {
+				fields = append(fields, buf.String())
+			}
+			return fields, nil
+		default:
+			buf.WriteRune(c)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if buf.Len() > 0 {
+		fields = append(fields, buf.String())
+	}
+	return fields, nil
+}
+
+var ansibleRange = regexp.MustCompile(`\[([0-9]+|[a-z]):([0-9]+|[a-z])\]`)
+
+// expandAnsibleRange expand a host pattern such as web[01:03] or db-[a:c]
+func expandAnsibleRange(pattern string) ([]string, error) {
+	loc := ansibleRange.FindStringSubmatchIndex(pattern)
+	if loc == nil {
+		return []string{pattern}, nil
+	}
+	prefix, suffix := pattern[:loc[0]], pattern[loc[1]:]
+	from, to := pattern[loc[2]:loc[3]], pattern[loc[4]:loc[5]]
+	var items []string
+	if a, err := strconv.Atoi(from); err == nil {
+		b, err := strconv.Atoi(to)
+		if err != nil || b < a {
+			return nil, fmt.Errorf("invalid range in %q", pattern)
+		}
+		for i := a; i <= b; i++ {
+			items = append(items, fmt.Sprintf("%0*d", len(from), i))
+		}
+	} else {
+		if len(to) != 1 || to[0] < from[0] {
+			return nil, fmt.Errorf("invalid range in %q", pattern)
+		}
+		for c := from[0]; c <= to[0]; c++ {
+			items = append(items, string(c))
+		}
+	}
+	var result []string
+	for _, item := range items {
+		rest, err := expandAnsibleRange(suffix)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rest {
+			result = append(result, prefix+item+r)
+		}
+	}
+	return result, nil
+}
+
+// hosts return the hosts with their groups and group variables applied:
+// the variables of the host win over those of its groups, which win over
+// those of their parent groups, and "all" comes last
+func (inv *ansibleInventory) hosts() []*AnsibleHost {
+	parents := map[string][]string{}
+	for parent, children := range inv.children {
+		for _, child := range children {
+			parents[child] = append(parents[child], parent)
+		}
+	}
+	direct := map[string][]string{}
+	for g, aliases := range inv.members {
+		for _, alias := range aliases {
+			if !containsString(direct[alias], g) {
+				direct[alias] = append(direct[alias], g)
+			}
+		}
+	}
+
+	result := make([]*AnsibleHost, 0, len(inv.order))
+	for _, alias := range inv.order {
+		ah := &AnsibleHost{Alias: alias, Vars: map[string]string{}}
+		set := func(vars map[string]string) {
+			for k, v := range vars {
+				if name, ok := ansibleLegacyVars[k]; ok {
+					k = name
+				}
+				if _, ok := ah.Vars[k]; !ok {
+					ah.Vars[k] = v
+				}
+			}
+		}
+		set(inv.hostVars[alias])
+		level := append([]string{}, direct[alias]...)
+		seen := map[string]bool{}
+		for len(level) > 0 {
+			sort.Strings(level)
+			var next []string
+			for _, g := range level {
+				if seen[g] || g == "all" {
+					continue
+				}
+				seen[g] = true
+				set(inv.groupVars[g])
+				next = append(next, parents[g]...)
+			}
+			level = next
+		}
+		set(inv.groupVars["all"])
+		for _, g := range direct[alias] {
+			if g != "all" && g != "ungrouped" {
+				ah.Groups = append(ah.Groups, g)
+			}
+		}
+		sort.Strings(ah.Groups)
+		result = append(result, ah)
+	}
+	return result
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+type ansibleImporter struct{}
+
+func (ansibleImporter) Name() string { return "ansible" }
+
+// Import the hosts of an ansible inventory, their groups are kept in a
+// "groups: a,b" comment
+func (ansibleImporter) Import(r io.Reader) ([]*AddOption, error) {
+	hosts, err := ParseAnsible(r)
+	if err != nil {
+		return nil, err
+	}
+	var options []*AddOption
+	for _, ah := range hosts {
+		config, err := ah.Config()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, &AddOption{Alias: ah.Alias, Config: config, Comment: groupsLabel(ah.Groups)})
+	}
+	return options, nil
+}
+
+func init() {
+	RegisterImporter(ansibleImporter{})
+}
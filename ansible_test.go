@@ -0,0 +1,198 @@
+package sshman
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const ansibleINI = `
+bastion ansible_host=203.0.113.1
+
+[web]
+web[01:02] ansible_user=deploy
+
+[db]
+db1 ansible_host=10.0.1.1 ansible_port=5022 ansible_ssh_common_args='-o ProxyJump=bastion'
+
+[prod:children]
+web
+db
+
+[prod:vars]
+ansible_ssh_private_key_file=~/.ssh/prod
+ansible_user=admin
+`
+
+func TestParseAnsibleINI(t *testing.T) {
+	hosts, err := ParseAnsible(strings.NewReader(ansibleINI))
+	require.Nil(t, err)
+	byAlias := map[string]*AnsibleHost{}
+	var aliases []string
+	for _, ah := range hosts {
+		byAlias[ah.Alias] = ah
+		aliases = append(aliases, ah.Alias)
+	}
+	require.Equal(t, []string{"bastion", "web01", "web02", "db1"}, aliases)
+
+	require.Equal(t, []string{"web"}, byAlias["web01"].Groups)
+	require.Equal(t, map[string]string{
+		"user":         "deploy",
+		"identityfile": "~/.ssh/prod",
+	}, ansibleConfig(t, byAlias["web01"]))
+	require.Equal(t, map[string]string{
+		"hostname":     "10.0.1.1",
+		"port":         "5022",
+		"user":         "admin",
+		"identityfile": "~/.ssh/prod",
+		"proxyjump":    "bastion",
+	}, ansibleConfig(t, byAlias["db1"]))
+	require.Empty(t, byAlias["bastion"].Groups)
+}
+
+func ansibleConfig(t *testing.T, ah *AnsibleHost) map[string]string {
+	config, err := ah.Config()
+	require.Nil(t, err)
+	return config
+}
+
+func TestParseAnsibleSSHArgs(t *testing.T) {
+	hosts, err := ParseAnsible(strings.NewReader(`[db]
+db1 ansible_host=10.0.1.1 ansible_ssh_common_args='-o ProxyCommand="ssh -W %h:%p -q bastion" -o StrictHostKeyChecking=no'
+db2 ansible_ssh_common_args='-J "jump user@bastion"'
+db3 ansible_ssh_common_args='-o "ProxyCommand=nc %h %p'
+`))
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{
+		"hostname":              "10.0.1.1",
+		"proxycommand":          "ssh -W %h:%p -q bastion",
+		"stricthostkeychecking": "no",
+	}, ansibleConfig(t, hosts[0]))
+	require.Equal(t, map[string]string{"proxyjump": "jump user@bastion"}, ansibleConfig(t, hosts[1]))
+	_, err = hosts[2].Config()
+	require.ErrorContains(t, err, "db3: ansible_ssh_common_args: sshconfig: unterminated quoted string")
+
+	// the command is written whole to the config
+	p := filepath.Join(t.TempDir(), "config")
+	_, err = Import(p, ansibleImporter{}, strings.NewReader("db1 ansible_ssh_common_args='-o ProxyCommand=\"ssh -W %h:%p -q bastion\"'\n"), ImportOption{})
+	require.Nil(t, err)
+	host, err := Resolve(p, "db1")
+	require.Nil(t, err)
+	require.Equal(t, []string{"ssh -W %h:%p -q bastion"}, host.Values("proxycommand"))
+}
+
+func TestParseAnsibleYAML(t *testing.T) {
+	hosts, err := ParseAnsible(strings.NewReader(`
+all:
+  vars:
+    ansible_user: root
+  hosts:
+    bastion:
+      ansible_ssh_host: 203.0.113.1
+  children:
+    web:
+      hosts:
+        web01:
+          ansible_port: 2222
+        web02:
+`))
+	require.Nil(t, err)
+	require.Equal(t, 3, len(hosts))
+	require.Equal(t, "bastion", hosts[0].Alias)
+	require.Equal(t, map[string]string{"hostname": "203.0.113.1", "user": "root"}, ansibleConfig(t, hosts[0]))
+	require.Equal(t, []string{"web"}, hosts[1].Groups)
+	require.Equal(t, "2222", ansibleConfig(t, hosts[1])["port"])
+	require.Equal(t, map[string]string{"user": "root"}, ansibleConfig(t, hosts[2]))
+
+	// a broken yaml inventory is not read as ini
+	_, err = ParseAnsible(strings.NewReader("all:\n  hosts:\n    web01:\n   ansible_port: 22\n"))
+	require.ErrorContains(t, err, "yaml inventory")
+	p := filepath.Join(t.TempDir(), "hosts.yml")
+	require.Nil(t, os.WriteFile(p, []byte("# inventory\nweb01: [\n"), 0600))
+	f, err := os.Open(p)
+	require.Nil(t, err)
+	defer f.Close()
+	_, err = ParseAnsible(f)
+	require.ErrorContains(t, err, "yaml inventory")
+
+	// an ini host with a port
+	hosts, err = ParseAnsible(strings.NewReader("web01:2222 ansible_user=root\n"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(hosts))
+}
+
+func TestImportExportAnsible(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "config")
+	require.Nil(t, os.WriteFile(main, []byte("Host *\n    ServerAliveInterval 30\n"), 0600))
+
+	results, err := Import(main, ansibleImporter{}, strings.NewReader(ansibleINI), ImportOption{DryRun: true})
+	require.Nil(t, err)
+	require.Equal(t, 4, len(results))
+	require.Equal(t, "Host *\n    ServerAliveInterval 30\n", readString(t, main))
+
+	_, err = Import(main, ansibleImporter{}, strings.NewReader(ansibleINI), ImportOption{})
+	require.Nil(t, err)
+	require.Contains(t, readString(t, main), "Host db1 # groups: db\n")
+
+	hosts, err := List(main, ListOption{})
+	require.Nil(t, err)
+	var buf bytes.Buffer
+	require.Nil(t, WriteAnsible(&buf, AnsibleINI, AnsibleHosts(main, hosts)))
+	require.Equal(t, `bastion ansible_host=203.0.113.1
+
+[db]
+db1 ansible_host=10.0.1.1 ansible_port=5022 ansible_ssh_common_args='-o ProxyJump=bastion' ansible_ssh_private_key_file=~/.ssh/prod ansible_user=admin
+
+[web]
+web01 ansible_ssh_private_key_file=~/.ssh/prod ansible_user=deploy
+web02 ansible_ssh_private_key_file=~/.ssh/prod ansible_user=deploy
+`, buf.String())
+
+	buf.Reset()
+	require.Nil(t, WriteAnsible(&buf, AnsibleYAML, AnsibleHosts(main, hosts)))
+	exported, err := ParseAnsible(&buf)
+	require.Nil(t, err)
+	require.Equal(t, 4, len(exported))
+
+	// a value with both quotes cannot be written to an ini inventory
+	quoted := []*AnsibleHost{{Alias: "web", Vars: map[string]string{"ansible_ssh_common_args": `-o RemoteCommand="echo 'hi'"`}}}
+	require.ErrorContains(t, WriteAnsible(&buf, AnsibleINI, quoted), "ansible-yaml")
+	buf.Reset()
+	require.Nil(t, WriteAnsible(&buf, AnsibleYAML, quoted))
+	exported, err = ParseAnsible(&buf)
+	require.Nil(t, err)
+	require.Equal(t, quoted[0].Vars, exported[0].Vars)
+
+	// updating an alias keeps its groups
+	_, err = Update(main, &UpdateOption{Alias: "db1", Config: map[string]string{"port": "6022"}})
+	require.Nil(t, err)
+	require.Contains(t, readString(t, main), "Host db1 # groups: db\n")
+
+	// importing again fails on the first existing alias and adds nothing
+	before := readString(t, main)
+	_, err = Import(main, ansibleImporter{}, strings.NewReader(ansibleINI), ImportOption{})
+	require.NotNil(t, err)
+	require.Equal(t, before, readString(t, main))
+}
+
+func TestImportAnsibleGroupFiles(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "config")
+	require.Nil(t, os.WriteFile(main, []byte(fmt.Sprintf("Include %s/conf.d/*\n", dir)), 0600))
+
+	_, err := Import(main, ansibleImporter{}, strings.NewReader(ansibleINI), ImportOption{Groups: GroupsFiles})
+	require.Nil(t, err)
+	require.Contains(t, readString(t, filepath.Join(dir, "conf.d", "web")), "Host web01\n")
+	require.NotContains(t, readString(t, main), "web01")
+
+	hosts, err := List(main, ListOption{Keywords: []string{"web02"}})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(hosts))
+	require.Equal(t, []string{"web"}, AnsibleHosts(main, hosts)[0].Groups)
+}
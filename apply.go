@@ -0,0 +1,121 @@
+package sshman
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Change one operation of a changes file, which is a yaml list of
+// changes such as `{op: update, alias: db, rename: db-primary}`
+type Change struct {
+	// Op add, update or delete
+	Op string `yaml:"op" json:"op"`
+	// Alias alias the operation applies to
+	Alias string `yaml:"alias" json:"alias"`
+	// Rename new alias, update only
+	Rename string `yaml:"rename,omitempty" json:"rename,omitempty"`
+	// Connect connection string
+	Connect string `yaml:"connect,omitempty" json:"connect,omitempty"`
+	// Path file the alias is added to, add only
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Config other config, an empty value removes the key on update
+	Config map[string]string `yaml:"config,omitempty" json:"config,omitempty"`
+}
+
+// LoadChanges read a list of changes in yaml, or json, from r
+func LoadChanges(r io.Reader) ([]*Change, error) {
+	var changes []*Change
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&changes); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid changes file: %v", err)
+	}
+	for i, c := range changes {
+		if err := c.valid(); err != nil {
+			return nil, fmt.Errorf("change %d: %v", i+1, err)
+		}
+	}
+	return changes, nil
+}
+
+func (c *Change) valid() error {
+	if c.Alias == "" {
+		return fmt.Errorf("alias is required")
+	}
+	switch c.Op {
+	case "add":
+		if c.Rename != "" {
+			return fmt.Errorf("rename is only valid with op update")
+		}
+	case "update":
+		if c.Path != "" {
+			return fmt.Errorf("path is only valid with op add")
+		}
+		if c.Rename == "" && c.Connect == "" && len(c.Config) == 0 {
+			return fmt.Errorf("nothing to update for alias[%s]", c.Alias)
+		}
+	case "delete":
+		if c.Rename != "" || c.Connect != "" || c.Path != "" || len(c.Config) > 0 {
+			return fmt.Errorf("op delete only takes an alias")
+		}
+	default:
+		return fmt.Errorf("unknown op %q, expect add, update or delete", c.Op)
+	}
+	return nil
+}
+
+// Apply apply the changes in order to the config file p in one transaction:
+// either all of them are written or, if one fails, none of them
+func Apply(p string, changes []*Change) error {
+	tx, err := Begin(p)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i, c := range changes {
+		if err := c.valid(); err != nil {
+			return fmt.Errorf("change %d: %v", i+1, err)
+		}
+		switch c.Op {
+		case "add":
+			_, err = tx.Add(&AddOption{
+				Path:    expandHome(c.Path),
+				Alias:   c.Alias,
+				Connect: c.Connect,
+				Config:  copyConfig(c.Config),
+			})
+		case "update":
+			_, err = tx.Update(&UpdateOption{
+				Alias:    c.Alias,
+				NewAlias: c.Rename,
+				Connect:  c.Connect,
+				Config:   copyConfig(c.Config),
+			})
+		case "delete":
+			_, err = tx.Delete(c.Alias)
+		}
+		if err != nil {
+			return fmt.Errorf("change %d (%s %s): %v", i+1, c.Op, c.Alias, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func copyConfig(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		return filepath.Join(GetHomeDir(), p[1:])
+	}
+	return p
+}
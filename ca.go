@@ -0,0 +1,364 @@
+package sshman
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// States of a CertInfo
+const (
+	CertValid       = "valid"
+	CertExpiring    = "expiring"
+	CertExpired     = "expired"
+	CertNotYetValid = "not-yet-valid"
+	CertInvalid     = "invalid"
+)
+
+// CertExpiryWarning the most time before its expiry a certificate is
+// reported as expiring, it is a fifth of the validity of shorter lived
+// certificates
+var CertExpiryWarning = 7 * 24 * time.Hour
+
+// DefaultExtensions the extensions of the certificates SignKey signs by
+// default, those of ssh-keygen
+var DefaultExtensions = []string{
+	"permit-X11-forwarding",
+	"permit-agent-forwarding",
+	"permit-port-forwarding",
+	"permit-pty",
+	"permit-user-rc",
+}
+
+// CA a certificate authority key
+type CA struct {
+	// Path the private key, the public key is Path.pub
+	Path        string `json:"path" yaml:"path"`
+	Type        string `json:"type" yaml:"type"`
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+	// PublicKey the authorized_keys line of the public key, for the
+	// TrustedUserCAKeys of the servers
+	PublicKey string `json:"public_key" yaml:"public_key"`
+}
+
+// CertInfo a user certificate
+type CertInfo struct {
+	Path       string   `json:"path" yaml:"path"`
+	KeyID      string   `json:"key_id" yaml:"key_id"`
+	Serial     uint64   `json:"serial" yaml:"serial"`
+	Principals []string `json:"principals" yaml:"principals"`
+	// ValidAfter the start of the validity, zero if always
+	ValidAfter time.Time `json:"valid_after" yaml:"valid_after"`
+	// ValidBefore the end of the validity, zero if forever
+	ValidBefore time.Time `json:"valid_before" yaml:"valid_before"`
+	Extensions  []string  `json:"extensions" yaml:"extensions"`
+	// CA the fingerprint of the key that signed the certificate
+	CA string `json:"ca" yaml:"ca"`
+	// State one of the Cert constants, when the certificate was read
+	State string `json:"state" yaml:"state"`
+	// Error why the certificate cannot be read
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// DefaultCAPath the private key of the certificate authority in KeyDir
+func DefaultCAPath() string {
+	return filepath.Join(keyDir(), "sshman_ca")
+}
+
+// InitCA generate the key of a certificate authority at path, or at
+// DefaultCAPath if empty, it is never overwritten
+func InitCA(path string, o KeyOption) (*CA, error) {
+	if path == "" {
+		path = DefaultCAPath()
+	} else if p, ok := identityPath(path); ok {
+		path = p
+	}
+	if o.Comment == "" {
+		o.Comment = "sshman CA " + defaultKeyComment()
+	}
+	pub, err := GenerateKey(path, o)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{
+		Path:        path,
+		Type:        pub.Type(),
+		Fingerprint: ssh.FingerprintSHA256(pub),
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))) + " " + o.Comment,
+	}, nil
+}
+
+// SignOption options for SignKey
+type SignOption struct {
+	// CA the private key of the certificate authority, DefaultCAPath if
+	// empty. It is taken from the agent when it is encrypted.
+	CA string
+	// Key the public key to sign, or its private key next to it, the first
+	// IdentityFile of the alias with a public key if empty
+	Key string
+	// KeyID the identity of the certificate, the alias if empty
+	KeyID string
+	// Principals the users the certificate is valid for, the User a config
+	// file sets for the alias if empty
+	Principals []string
+	// Validity how long the certificate is valid from now, 24h if not set
+	Validity time.Duration
+	// Extensions name or name=value, DefaultExtensions if nil
+	Extensions []string
+}
+
+// SignedCert a certificate SignKey wrote
+type SignedCert struct {
+	Alias string `json:"alias" yaml:"alias"`
+	// Key the public key signed
+	Key         string    `json:"key" yaml:"key"`
+	Certificate *CertInfo `json:"certificate" yaml:"certificate"`
+	// Host the alias with its new CertificateFile
+	Host *HostConfig `json:"-" yaml:"-"`
+}
+
+// ParseValidity parse a validity such as 12h, 30d or 52w
+func ParseValidity(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			if v, err := strconv.Atoi(n); err == nil && v > 0 {
+				return time.Duration(v) * unit, nil
+			}
+			return 0, fmt.Errorf("invalid validity %q", s)
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid validity %q, expect a duration such as 12h, 30d or 52w", s)
+	}
+	return d, nil
+}
+
+// SignKey sign the key of an alias of the config file p with the certificate
+// authority, write the certificate next to the key with the -cert.pub
+// suffix and set it as the CertificateFile of the alias. The certificate is
+// valid from 5 minutes ago, for clocks that are behind.
+func SignKey(p, alias string, o SignOption) (*SignedCert, error) {
+	if o.Validity <= 0 {
+		o.Validity = 24 * time.Hour
+	}
+	if o.Extensions == nil {
+		o.Extensions = DefaultExtensions
+	}
+	tx, err := Begin(p)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := checkAlias(tx.aliasMap, true, alias); err != nil {
+		return nil, err
+	}
+	hc, err := tx.host(alias)
+	if err != nil {
+		return nil, err
+	}
+
+	key := o.Key
+	if key == "" {
+		if key, err = deployKeyPath(hc); err != nil {
+			return nil, err
+		}
+	} else if path, ok := identityPath(key); ok {
+		key = path
+	}
+	pubPath, pub, _, err := publicKeyFile(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := pub.(*ssh.Certificate); ok {
+		return nil, fmt.Errorf("%s is a certificate, give the key to sign", pubPath)
+	}
+	caPath := o.CA
+	if caPath == "" {
+		caPath = DefaultCAPath()
+	} else if path, ok := identityPath(caPath); ok {
+		caPath = path
+	}
+	caPubPath, caPub, _, err := publicKeyFile(caPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%v, run ca init first", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, closeSigner, err := keySigner(strings.TrimSuffix(caPubPath, ".pub"), caPub)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSigner()
+
+	principals := o.Principals
+	if len(principals) == 0 {
+		// the local user sshman assumes is no principal
+		for _, s := range hc.Settings {
+			if s.Key == "user" {
+				if s.Source.File != "" {
+					principals = []string{s.Value}
+				}
+				break
+			}
+		}
+		if len(principals) == 0 {
+			return nil, fmt.Errorf("alias[%s] has no User, give the principals", alias)
+		}
+	}
+	keyID := o.KeyID
+	if keyID == "" {
+		keyID = alias
+	}
+	var serial [8]byte
+	if _, err := rand.Read(serial[:]); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		CertType:        ssh.UserCert,
+		KeyId:           keyID,
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(now.Add(-5 * time.Minute).Unix()),
+		ValidBefore:     uint64(now.Add(o.Validity).Unix()),
+		Permissions:     ssh.Permissions{Extensions: map[string]string{}},
+	}
+	for _, ext := range o.Extensions {
+		name, value, _ := strings.Cut(ext, "=")
+		cert.Extensions[name] = value
+	}
+	if err := cert.SignCert(rand.Reader, signer); err != nil {
+		return nil, err
+	}
+
+	// the certificate replaces the previous one once the config is written
+	certPath := strings.TrimSuffix(pubPath, ".pub") + "-cert.pub"
+	tmp := certPath + ".tmp"
+	if err := os.WriteFile(tmp, ssh.MarshalAuthorizedKey(cert), 0644); err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+	host, err := tx.Update(&UpdateOption{Alias: alias, Config: map[string]string{"certificatefile": homePath(certPath)}})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, certPath); err != nil {
+		return nil, err
+	}
+	return &SignedCert{Alias: alias, Key: pubPath, Certificate: newCertInfo(certPath, cert, now), Host: host}, nil
+}
+
+// newCertInfo describe cert, read from path, at the time now
+func newCertInfo(path string, cert *ssh.Certificate, now time.Time) *CertInfo {
+	c := &CertInfo{
+		Path:       path,
+		KeyID:      cert.KeyId,
+		Serial:     cert.Serial,
+		Principals: cert.ValidPrincipals,
+		Extensions: []string{},
+		CA:         ssh.FingerprintSHA256(cert.SignatureKey),
+	}
+	if c.Principals == nil {
+		c.Principals = []string{}
+	}
+	if cert.ValidAfter != 0 {
+		c.ValidAfter = time.Unix(int64(cert.ValidAfter), 0)
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		c.ValidBefore = time.Unix(int64(cert.ValidBefore), 0)
+	}
+	for name, value := range cert.Extensions {
+		if value != "" {
+			name += "=" + value
+		}
+		c.Extensions = append(c.Extensions, name)
+	}
+	sort.Strings(c.Extensions)
+	c.State = c.state(now)
+	return c
+}
+
+// state the state of c at the time now
+func (c *CertInfo) state(now time.Time) string {
+	switch {
+	case now.Before(c.ValidAfter):
+		return CertNotYetValid
+	case c.ValidBefore.IsZero():
+		return CertValid
+	case !now.Before(c.ValidBefore):
+		return CertExpired
+	}
+	warning := CertExpiryWarning
+	if lifetime := c.ValidBefore.Sub(c.ValidAfter); !c.ValidAfter.IsZero() && lifetime/5 < warning {
+		warning = lifetime / 5
+	}
+	if c.ValidBefore.Sub(now) < warning {
+		return CertExpiring
+	}
+	return CertValid
+}
+
+// readCertInfo read the certificate at path
+func readCertInfo(path string, now time.Time) *CertInfo {
+	c := &CertInfo{Path: path, Principals: []string{}, Extensions: []string{}, State: CertInvalid}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.Error = err.Error()
+		if errors.Is(err, os.ErrNotExist) {
+			c.Error = "does not exist"
+		}
+		return c
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		c.Error = "not a certificate"
+		return c
+	}
+	return newCertInfo(path, cert, now)
+}
+
+// Certificates return the certificates ssh uses for the alias: its
+// CertificateFile, and the -cert.pub files next to its IdentityFile keys
+func (hc *HostConfig) Certificates() []*CertInfo {
+	now := time.Now()
+	var certs []*CertInfo
+	seen := map[string]bool{}
+	for _, file := range hc.Values("certificatefile") {
+		if path, ok := identityPath(file); ok && !seen[path] {
+			seen[path] = true
+			certs = append(certs, readCertInfo(path, now))
+		}
+	}
+	for _, file := range hc.Values("identityfile") {
+		path, ok := identityPath(file)
+		if !ok {
+			continue
+		}
+		path = strings.TrimSuffix(path, ".pub") + "-cert.pub"
+		if _, err := os.Stat(path); err == nil && !seen[path] {
+			seen[path] = true
+			certs = append(certs, readCertInfo(path, now))
+		}
+	}
+	return certs
+}
@@ -0,0 +1,156 @@
+package sshman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSignKey(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca")
+	p := filepath.Join(dir, "config")
+	key := writeTestKey(t, filepath.Join(dir, "id_web"))
+	config := "Host web\n    HostName 10.0.0.1\n    User deploy\n    IdentityFile " + dir + "/id_web\nHost db\n    HostName 10.0.0.2\n"
+	require.Nil(t, os.WriteFile(p, []byte(config), 0600))
+
+	_, err := SignKey(p, "web", SignOption{CA: caPath})
+	require.ErrorContains(t, err, "run ca init first")
+
+	ca, err := InitCA(caPath, KeyOption{Comment: "test CA"})
+	require.Nil(t, err)
+	require.Equal(t, caPath, ca.Path)
+	require.Equal(t, ssh.KeyAlgoED25519, ca.Type)
+	_, err = InitCA(caPath, KeyOption{})
+	require.ErrorContains(t, err, "exists already")
+	caPub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(ca.PublicKey))
+	require.Nil(t, err)
+
+	signed, err := SignKey(p, "web", SignOption{CA: caPath, Validity: 8 * time.Hour})
+	require.Nil(t, err)
+	certPath := filepath.Join(dir, "id_web-cert.pub")
+	require.Equal(t, filepath.Join(dir, "id_web.pub"), signed.Key)
+	c := signed.Certificate
+	require.Equal(t, certPath, c.Path)
+	require.Equal(t, "web", c.KeyID)
+	require.Equal(t, []string{"deploy"}, c.Principals)
+	require.ElementsMatch(t, DefaultExtensions, c.Extensions)
+	require.Equal(t, ca.Fingerprint, c.CA)
+	require.Equal(t, CertValid, c.State)
+	require.WithinDuration(t, time.Now().Add(8*time.Hour), c.ValidBefore, time.Minute)
+
+	// the certificate is one sshd trusting the CA accepts for deploy
+	data, err := os.ReadFile(certPath)
+	require.Nil(t, err)
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	require.Nil(t, err)
+	cert, ok := pub.(*ssh.Certificate)
+	require.True(t, ok)
+	require.Equal(t, key.PublicKey().Marshal(), cert.Key.Marshal())
+	checker := &ssh.CertChecker{IsUserAuthority: func(auth ssh.PublicKey) bool {
+		return bytes.Equal(auth.Marshal(), caPub.Marshal())
+	}}
+	require.Nil(t, checker.CheckCert("deploy", cert))
+	require.NotNil(t, checker.CheckCert("root", cert))
+
+	host, err := Resolve(p, "web")
+	require.Nil(t, err)
+	require.Equal(t, []string{certPath}, host.Values("certificatefile"))
+	certs := host.Certificates()
+	require.Len(t, certs, 1)
+	require.Equal(t, c.Serial, certs[0].Serial)
+	require.Equal(t, []*CertInfo{certs[0]}, host.Output().Certificates)
+
+	// the certificate is left as it was when the config cannot be written
+	func() {
+		defer func(auto bool, dir string) { AutoBackup, BackupDir = auto, dir }(AutoBackup, BackupDir)
+		// the backup directory is a file
+		AutoBackup, BackupDir = true, p
+		require.Nil(t, os.WriteFile(p, []byte(config), 0600))
+		_, err := SignKey(p, "web", SignOption{CA: caPath, Principals: []string{"root"}})
+		require.NotNil(t, err)
+	}()
+	require.Equal(t, string(data), readString(t, certPath))
+	_, err = os.Stat(certPath + ".tmp")
+	require.True(t, os.IsNotExist(err))
+
+	// db sets no User, the local user is no principal
+	writeTestKey(t, filepath.Join(dir, "id_db"))
+	_, err = SignKey(p, "db", SignOption{CA: caPath, Key: filepath.Join(dir, "id_db.pub")})
+	require.ErrorContains(t, err, "has no User")
+	_, err = os.Stat(filepath.Join(dir, "id_db-cert.pub"))
+	require.True(t, os.IsNotExist(err))
+
+	// signed again with other principals, extensions and key
+	signed, err = SignKey(p, "db", SignOption{CA: caPath, Key: filepath.Join(dir, "id_db.pub"), Principals: []string{"admin", "backup"}, KeyID: "db-admin", Extensions: []string{"permit-pty", "x@example.com=1"}})
+	require.Nil(t, err)
+	require.Equal(t, []string{"admin", "backup"}, signed.Certificate.Principals)
+	require.Equal(t, []string{"permit-pty", "x@example.com=1"}, signed.Certificate.Extensions)
+	require.Equal(t, "db-admin", signed.Certificate.KeyID)
+
+	_, err = SignKey(p, "web", SignOption{CA: caPath, Key: certPath})
+	require.ErrorContains(t, err, "is a certificate")
+	_, err = SignKey(p, "missing", SignOption{CA: caPath})
+	require.NotNil(t, err)
+
+	// a CertificateFile that does not exist
+	require.Nil(t, os.Remove(filepath.Join(dir, "id_db-cert.pub")))
+	host, err = Resolve(p, "db")
+	require.Nil(t, err)
+	certs = host.Certificates()
+	require.Len(t, certs, 1)
+	require.Equal(t, CertInvalid, certs[0].State)
+	require.Equal(t, "does not exist", certs[0].Error)
+
+	// a quoted path with a space
+	writeTestKey(t, filepath.Join(dir, "my key"))
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_WRONLY, 0)
+	require.Nil(t, err)
+	_, err = f.WriteString("Host spaced\n    HostName 10.0.0.3\n    User deploy\n    IdentityFile \"" + dir + "/my key\"\n")
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+	signed, err = SignKey(p, "spaced", SignOption{CA: caPath})
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(dir, "my key.pub"), signed.Key)
+	require.Equal(t, []string{filepath.Join(dir, "my key-cert.pub")}, signed.Host.Values("certificatefile"))
+	require.Len(t, signed.Host.Certificates(), 1)
+	require.Equal(t, CertValid, signed.Host.Certificates()[0].State)
+}
+
+func TestCertState(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		after, before time.Time
+		want          string
+	}{
+		{now.Add(-time.Hour), now.Add(23 * time.Hour), CertValid},
+		{now.Add(-20 * time.Hour), now.Add(4 * time.Hour), CertExpiring},
+		{now.Add(-300 * 24 * time.Hour), now.Add(65 * 24 * time.Hour), CertValid},
+		{now.Add(-360 * 24 * time.Hour), now.Add(5 * 24 * time.Hour), CertExpiring},
+		{now.Add(-2 * time.Hour), now.Add(-time.Hour), CertExpired},
+		{now.Add(time.Hour), now.Add(2 * time.Hour), CertNotYetValid},
+		{time.Time{}, time.Time{}, CertValid},
+	}
+	for i, tt := range tests {
+		c := &CertInfo{ValidAfter: tt.after, ValidBefore: tt.before}
+		require.Equal(t, tt.want, c.state(now), i)
+	}
+}
+
+func TestParseValidity(t *testing.T) {
+	for s, want := range map[string]time.Duration{"8h": 8 * time.Hour, "90m": 90 * time.Minute, "30d": 30 * 24 * time.Hour, "52w": 52 * 7 * 24 * time.Hour} {
+		d, err := ParseValidity(s)
+		require.Nil(t, err, s)
+		require.Equal(t, want, d, s)
+	}
+	for _, s := range []string{"", "0h", "-1d", "xd", "forever"} {
+		_, err := ParseValidity(s)
+		require.NotNil(t, err, s)
+	}
+}
@@ -0,0 +1,444 @@
+package sshman
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sonnt85/sshman/sshconfig"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Auth results of a CheckResult
+const (
+	AuthOK     = "ok"
+	AuthFailed = "failed"
+	// AuthNoKeys no identity file could be read and no agent holds a key
+	AuthNoKeys = "no-keys"
+)
+
+// CheckOption options for Check
+type CheckOption struct {
+	// Aliases the aliases to check, every alias without wildcards if empty
+	Aliases []string
+	// Concurrency how many aliases are checked at once, 4 if not set
+	Concurrency int
+	// Timeout the time the check of an alias may take, 5s if not set
+	Timeout time.Duration
+}
+
+// CheckResult what Check found out about an alias
+type CheckResult struct {
+	Alias string `json:"alias" yaml:"alias"`
+	// Address the host:port dialed
+	Address string `json:"address" yaml:"address"`
+	// Via the ProxyJump hosts the connection goes through
+	Via []string `json:"via,omitempty" yaml:"via,omitempty"`
+	// Reachable whether the TCP connection succeeded
+	Reachable bool `json:"reachable" yaml:"reachable"`
+	// Banner the version the server sent, such as SSH-2.0-OpenSSH_9.6
+	Banner string `json:"banner,omitempty" yaml:"banner,omitempty"`
+	// HostKey the algorithm of the host key of the server
+	HostKey string `json:"host_key,omitempty" yaml:"host_key,omitempty"`
+	// Auth one of the Auth constants, empty if the handshake failed first
+	Auth string `json:"auth,omitempty" yaml:"auth,omitempty"`
+	// Duration how long the check took, in milliseconds
+	Duration int64  `json:"duration_ms" yaml:"duration_ms"`
+	Error    string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// OK whether the alias is reachable and the authentication succeeded
+func (r *CheckResult) OK() bool {
+	return r.Reachable && r.Auth == AuthOK
+}
+
+// Check dial the aliases of the config file p the way ssh does, through
+// their ProxyJump hosts, and authenticate with their IdentityFile keys and
+// the agent. Host keys are recorded, not verified against known_hosts.
+func Check(p string, o CheckOption) ([]*CheckResult, error) {
+	if o.Concurrency <= 0 {
+		o.Concurrency = 4
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 5 * time.Second
+	}
+	aliases := o.Aliases
+	if len(aliases) == 0 {
+		hosts, err := List(p, ListOption{})
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range hosts {
+			if !strings.ContainsAny(host.Alias, "*?!") {
+				aliases = append(aliases, host.Alias)
+			}
+		}
+	}
+	results := make([]*CheckResult, len(aliases))
+	sem := make(chan struct{}, o.Concurrency)
+	var wg sync.WaitGroup
+	for i, alias := range aliases {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			results[i] = checkHost(p, alias, o.Timeout)
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// endpoint a host ssh connects to, the alias or a ProxyJump host
+type endpoint struct {
+	host *HostConfig
+	user string
+	addr string
+	// jump the ProxyJump entry of a jump host
+	jump string
+	// hostKeys verifies the host key, which is only recorded if nil
+	hostKeys ssh.HostKeyCallback
+}
+
+func newEndpoint(host *HostConfig) *endpoint {
+	hostname := host.Get("hostname")
+	if hostname == "" {
+		hostname = host.Alias
+	}
+	port := host.Get("port")
+	if port == "" {
+		port = "22"
+	}
+	return &endpoint{host: host, user: host.Get("user"), addr: net.JoinHostPort(hostname, port)}
+}
+
+// jumpEndpoint the endpoint of a ProxyJump host, [ssh://][user@]host[:port],
+// configured by the config file p like any alias
+func jumpEndpoint(p, spec string) (*endpoint, error) {
+	jump := strings.TrimPrefix(spec, "ssh://")
+	var user, port string
+	if i := strings.LastIndex(jump, "@"); i >= 0 {
+		user, jump = jump[:i], jump[i+1:]
+	}
+	if strings.HasPrefix(jump, "[") || strings.Count(jump, ":") == 1 {
+		var err error
+		if jump, port, err = net.SplitHostPort(jump); err != nil {
+			return nil, err
+		}
+	}
+	host, err := Resolve(p, jump)
+	if err != nil {
+		return nil, err
+	}
+	e := newEndpoint(host)
+	e.jump = spec
+	if user != "" {
+		e.user = user
+	}
+	if port != "" {
+		hostname, _, _ := net.SplitHostPort(e.addr)
+		e.addr = net.JoinHostPort(hostname, port)
+	}
+	return e, nil
+}
+
+// jumpEndpoints the endpoints of the ProxyJump hosts of host, in the order
+// ssh connects to them. Like ssh, the ProxyJump of the first jump host is
+// followed, those of the next ones are replaced by the hosts before them.
+func jumpEndpoints(p string, host *HostConfig) ([]*endpoint, error) {
+	return jumpChain(p, host, map[string]bool{host.Alias: true})
+}
+
+// jumpChain the endpoints of jumpEndpoints, seen the aliases of the chain
+// being followed
+func jumpChain(p string, host *HostConfig, seen map[string]bool) ([]*endpoint, error) {
+	spec := host.Get("proxyjump")
+	if spec == "" || strings.EqualFold(spec, "none") {
+		return nil, nil
+	}
+	var chain []*endpoint
+	for i, jump := range strings.Split(spec, ",") {
+		e, err := jumpEndpoint(p, jump)
+		if err != nil {
+			return nil, fmt.Errorf("jump host %s: %v", jump, err)
+		}
+		if i == 0 {
+			if seen[e.host.Alias] {
+				return nil, fmt.Errorf("jump host %s: ProxyJump loop", jump)
+			}
+			seen[e.host.Alias] = true
+			if pc := e.host.Get("proxycommand"); pc != "" && !strings.EqualFold(pc, "none") && e.host.Get("proxyjump") == "" {
+				return nil, fmt.Errorf("jump host %s: ProxyCommand is not supported", jump)
+			}
+			nested, err := jumpChain(p, e.host, seen)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, nested...)
+		}
+		chain = append(chain, e)
+	}
+	return chain, nil
+}
+
+func checkHost(p, alias string, timeout time.Duration) *CheckResult {
+	start := time.Now()
+	r := &CheckResult{Alias: alias}
+	defer func() { r.Duration = time.Since(start).Milliseconds() }()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	host, err := Resolve(p, alias)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	target := newEndpoint(host)
+	r.Address = target.addr
+	if pc := host.Get("proxycommand"); pc != "" && !strings.EqualFold(pc, "none") {
+		r.Error = "ProxyCommand is not supported"
+		return r
+	}
+
+	client, via, closeJumps, err := jumpClient(ctx, p, host, hostKeysRecorded)
+	r.Via = via
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	defer closeJumps()
+
+	conn, err := dial(ctx, client, target.addr)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Reachable = true
+	hs := handshake(ctx, conn, target)
+	r.Banner, r.HostKey, r.Auth = hs.banner, hs.hostKey, hs.auth
+	if hs.err != nil {
+		r.Error = hs.err.Error()
+		return r
+	}
+	hs.client.Close()
+	return r
+}
+
+// jumpClient connect to the jumpEndpoints of host in turn, checking their
+// host keys as check says, and return the client of the last one, nil
+// without ProxyJump, with the addresses of the hosts and a function closing
+// the connections
+func jumpClient(ctx context.Context, p string, host *HostConfig, check hostKeyCheck) (*ssh.Client, []string, func(), error) {
+	var client *ssh.Client
+	var via []string
+	var clients []*ssh.Client
+	closeAll := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}
+	jumps, err := jumpEndpoints(p, host)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, e := range jumps {
+		e.hostKeys = e.hostKeyCallback(check)
+		via = append(via, e.addr)
+		conn, err := dial(ctx, client, e.addr)
+		if err != nil {
+			closeAll()
+			return nil, via, nil, fmt.Errorf("jump host %s: %v", e.jump, err)
+		}
+		hs := handshake(ctx, conn, e)
+		if hs.err != nil {
+			closeAll()
+			return nil, via, nil, fmt.Errorf("jump host %s: %v", e.jump, hs.err)
+		}
+		clients = append(clients, hs.client)
+		client = hs.client
+	}
+	return client, via, closeAll, nil
+}
+
+// dial connect to addr, through client if it is not nil
+func dial(ctx context.Context, client *ssh.Client, addr string) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if client != nil {
+		conn, err = client.DialContext(ctx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		// connections through a jump host have no deadline, the one of the
+		// jump host's connection stops them
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+type handshakeResult struct {
+	client  *ssh.Client
+	banner  string
+	hostKey string
+	auth    string
+	err     error
+}
+
+// handshake run the SSH handshake and authentication of e over conn with the
+// keys ssh offers, then the extra methods
+func handshake(ctx context.Context, conn net.Conn, e *endpoint, extra ...ssh.AuthMethod) *handshakeResult {
+	signers, closeAgent := identitySigners(e.host)
+	defer closeAgent()
+	var auth []ssh.AuthMethod
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	return handshakeAuth(ctx, conn, e, append(auth, extra...))
+}
+
+// handshakeAuth run the SSH handshake and authentication of e over conn with
+// the auth methods only
+func handshakeAuth(ctx context.Context, conn net.Conn, e *endpoint, auth []ssh.AuthMethod) *handshakeResult {
+	hs := &handshakeResult{}
+	var hostKeyErr error
+	config := &ssh.ClientConfig{
+		User: e.user,
+		Auth: auth,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hs.hostKey = key.Type()
+			if e.hostKeys != nil {
+				hostKeyErr = e.hostKeys(hostname, remote, key)
+			}
+			return hostKeyErr
+		},
+	}
+	bc := &bannerConn{Conn: conn}
+	c, chans, reqs, err := ssh.NewClientConn(bc, e.addr, config)
+	hs.banner = bc.banner()
+	switch {
+	case err == nil:
+		hs.auth = AuthOK
+		hs.client = ssh.NewClient(c, chans, reqs)
+		return hs
+	case hostKeyErr != nil:
+		hs.err = hostKeyErr
+	case ctx.Err() != nil:
+		hs.err = fmt.Errorf("timeout during the SSH handshake")
+	case hs.hostKey == "":
+		// the key exchange did not complete
+		hs.err = err
+	case len(auth) == 0:
+		hs.auth = AuthNoKeys
+		hs.err = errors.New("no identity file could be read and no agent holds a key")
+	default:
+		hs.auth = AuthFailed
+		hs.err = err
+	}
+	conn.Close()
+	return hs
+}
+
+// identitySigners the keys ssh offers for host: its IdentityFile keys, or
+// the default ones, and those of the agent. With IdentitiesOnly only the
+// agent keys of an identity file are kept. Encrypted keys are used through
+// the agent only.
+func identitySigners(host *HostConfig) ([]ssh.Signer, func()) {
+	files := host.Values("identityfile")
+	if len(files) == 0 {
+		files = strings.Fields(sshconfig.Default("IdentityFile"))
+	}
+	var signers []ssh.Signer
+	// identities the public keys of the identity files
+	identities := map[string]bool{}
+	for _, file := range files {
+		path, ok := identityPath(file)
+		if !ok {
+			continue
+		}
+		if data, err := os.ReadFile(path + ".pub"); err == nil {
+			if key, _, _, _, err := ssh.ParseAuthorizedKey(data); err == nil {
+				identities[string(key.Marshal())] = true
+			}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(data); err == nil {
+			signers = append(signers, signer)
+			identities[string(signer.PublicKey().Marshal())] = true
+		}
+	}
+
+	sock := host.Get("identityagent")
+	if sock == "" || sock == "SSH_AUTH_SOCK" {
+		sock = os.Getenv("SSH_AUTH_SOCK")
+	} else if strings.HasPrefix(sock, "$") {
+		sock = os.Getenv(strings.Trim(sock[1:], "{}"))
+	} else if path, ok := identityPath(sock); ok {
+		sock = path
+	}
+	if sock == "" || strings.EqualFold(sock, "none") {
+		return signers, func() {}
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return signers, func() {}
+	}
+	agentSigners, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		conn.Close()
+		return signers, func() {}
+	}
+	identitiesOnly := strings.EqualFold(host.Get("identitiesonly"), "yes")
+	for _, signer := range agentSigners {
+		blob := string(signer.PublicKey().Marshal())
+		if !identitiesOnly || identities[blob] {
+			signers = append(signers, signer)
+		}
+	}
+	return signers, func() { conn.Close() }
+}
+
+// bannerConn records the first line the server sends, its version
+type bannerConn struct {
+	net.Conn
+	mu   sync.Mutex
+	head []byte
+}
+
+func (c *bannerConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.mu.Lock()
+	if len(c.head) < 256 {
+		c.head = append(c.head, b[:n]...)
+	}
+	c.mu.Unlock()
+	return n, err
+}
+
+// banner the SSH-... line of the server, the lines before it are skipped
+func (c *bannerConn) banner() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	scanner := bufio.NewScanner(bytes.NewReader(c.head))
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); strings.HasPrefix(line, "SSH-") {
+			return line
+		}
+	}
+	return ""
+}
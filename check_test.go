@@ -0,0 +1,333 @@
+package sshman
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// writeTestKey write a new ed25519 key pair to path and path.pub
+func writeTestKey(t *testing.T, path string) ssh.Signer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "test")
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(path, pem.EncodeToMemory(block), 0600))
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(path+".pub", ssh.MarshalAuthorizedKey(signer.PublicKey()), 0644))
+	return signer
+}
+
+// testServerOption what the in-process SSH server of newTestServer accepts
+type testServerOption struct {
+	// Keys the public keys accepted
+	Keys []ssh.PublicKey
+	// Password the password accepted, none if empty
+	Password string
+	// Home the home directory of the user: the keys of its
+	// .ssh/authorized_keys are accepted too, and exec requests run there
+	// with sh. Sessions are rejected if empty.
+	Home string
+}
+
+// testServer an in-process SSH server accepting the keys of authorized, it
+// forwards direct-tcpip channels so that it can be a jump host
+func testServer(t *testing.T, authorized ...ssh.PublicKey) string {
+	return newTestServer(t, testServerOption{Keys: authorized})
+}
+
+func newTestServer(t *testing.T, o testServerOption) string {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	hostKey, err := ssh.NewSignerFromKey(hostPriv)
+	require.Nil(t, err)
+	config := &ssh.ServerConfig{
+		ServerVersion: "SSH-2.0-sshman_test",
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			keys := o.Keys
+			if o.Home != "" {
+				data, _ := os.ReadFile(filepath.Join(o.Home, ".ssh", "authorized_keys"))
+				for len(data) > 0 {
+					k, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+					if err != nil {
+						break
+					}
+					keys, data = append(keys, k), rest
+				}
+			}
+			for _, k := range keys {
+				if string(k.Marshal()) == string(key.Marshal()) {
+					return &ssh.Permissions{}, nil
+				}
+			}
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+	if o.Password != "" {
+		config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) == o.Password {
+				return &ssh.Permissions{}, nil
+			}
+			return nil, fmt.Errorf("wrong password for %s", conn.User())
+		}
+	}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestConn(conn, config, o.Home)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func serveTestConn(conn net.Conn, config *ssh.ServerConfig, home string) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "direct-tcpip":
+			serveTestForward(newChannel)
+		case "session":
+			if home == "" {
+				newChannel.Reject(ssh.Prohibited, "no sessions")
+				continue
+			}
+			serveTestSession(newChannel, home)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "only direct-tcpip and session")
+		}
+	}
+}
+
+func serveTestForward(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	remote, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		remote.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	go func() {
+		io.Copy(channel, remote)
+		channel.Close()
+	}()
+	go func() {
+		io.Copy(remote, channel)
+		remote.Close()
+	}()
+}
+
+// serveTestSession run the command of an exec request with sh in home
+func serveTestSession(newChannel ssh.NewChannel, home string) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	go func() {
+		defer channel.Close()
+		for req := range requests {
+			if req.Type != "exec" {
+				req.Reply(false, nil)
+				continue
+			}
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			cmd := exec.Command("sh", "-c", payload.Command)
+			cmd.Dir, cmd.Env = home, []string{"HOME=" + home, "PATH=" + os.Getenv("PATH")}
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = channel, channel, channel.Stderr()
+			status := uint32(0)
+			if err := cmd.Run(); err != nil {
+				status = 1
+				if exitErr, ok := err.(*exec.ExitError); ok {
+					status = uint32(exitErr.ExitCode())
+				}
+			}
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			return
+		}
+	}()
+}
+
+func TestCheck(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	dir := t.TempDir()
+	key := writeTestKey(t, filepath.Join(dir, "id_ed25519"))
+	writeTestKey(t, filepath.Join(dir, "id_other"))
+	server := testServer(t, key.PublicKey())
+	host, port, _ := net.SplitHostPort(server)
+
+	// a port nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	closed := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	p := filepath.Join(dir, "config")
+	config := fmt.Sprintf(`Host ok jump
+    HostName %[1]s
+    Port %[2]s
+    User deploy
+    IdentityFile %[3]s/id_ed25519
+Host behind
+    HostName %[1]s
+    Port %[2]s
+    ProxyJump jump
+    IdentityFile %[3]s/id_ed25519
+Host deep
+    HostName %[1]s
+    Port %[2]s
+    ProxyJump behind
+    IdentityFile %[3]s/id_ed25519
+Host wrongkey
+    HostName %[1]s
+    Port %[2]s
+    IdentityFile %[3]s/id_other
+Host closed
+    HostName 127.0.0.1
+    Port %[4]d
+`, host, port, dir, closed)
+	require.Nil(t, os.WriteFile(p, []byte(config), 0600))
+
+	results, err := Check(p, CheckOption{Aliases: []string{"ok", "behind", "wrongkey", "closed", "deep"}, Timeout: 3 * time.Second})
+	require.Nil(t, err)
+	require.Len(t, results, 5)
+
+	ok := results[0]
+	require.Equal(t, "ok", ok.Alias)
+	require.Equal(t, server, ok.Address)
+	require.True(t, ok.OK(), ok.Error)
+	require.Equal(t, "SSH-2.0-sshman_test", ok.Banner)
+	require.Equal(t, ssh.KeyAlgoED25519, ok.HostKey)
+
+	behind := results[1]
+	require.True(t, behind.OK(), behind.Error)
+	require.Equal(t, []string{server}, behind.Via)
+	require.Equal(t, "SSH-2.0-sshman_test", behind.Banner)
+
+	wrongkey := results[2]
+	require.True(t, wrongkey.Reachable)
+	require.Equal(t, AuthFailed, wrongkey.Auth)
+	require.Equal(t, ssh.KeyAlgoED25519, wrongkey.HostKey)
+	require.NotEmpty(t, wrongkey.Error)
+
+	unreachable := results[3]
+	require.False(t, unreachable.Reachable)
+	require.Empty(t, unreachable.Auth)
+	require.NotEmpty(t, unreachable.Error)
+
+	// the ProxyJump of the jump host is followed
+	deep := results[4]
+	require.True(t, deep.OK(), deep.Error)
+	require.Equal(t, []string{server, server}, deep.Via)
+
+	// every alias without wildcards by default
+	results, err = Check(p, CheckOption{Timeout: 3 * time.Second})
+	require.Nil(t, err)
+	require.Len(t, results, 6)
+}
+
+func TestJumpEndpoint(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config")
+	require.Nil(t, os.WriteFile(p, []byte("Host bastion\n    HostName 10.0.0.1\n    User admin\n    Port 2200\n"), 0600))
+
+	e, err := jumpEndpoint(p, "bastion")
+	require.Nil(t, err)
+	require.Equal(t, "admin", e.user)
+	require.Equal(t, "10.0.0.1:2200", e.addr)
+
+	e, err = jumpEndpoint(p, "ssh://root@bastion:22")
+	require.Nil(t, err)
+	require.Equal(t, "root", e.user)
+	require.Equal(t, "10.0.0.1:22", e.addr)
+
+	e, err = jumpEndpoint(p, "[::1]:2222")
+	require.Nil(t, err)
+	require.Equal(t, "[::1]:2222", e.addr)
+}
+
+func TestJumpEndpoints(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config")
+	require.Nil(t, os.WriteFile(p, []byte(`Host web
+    ProxyJump inner,last
+Host inner
+    ProxyJump outer
+Host last
+    ProxyJump ignored
+Host outer
+    HostName 10.0.0.1
+Host loop
+    ProxyJump loop2
+Host loop2
+    ProxyJump loop
+Host proxied
+    ProxyJump piped
+Host piped
+    ProxyCommand nc %h %p
+`), 0600))
+	jumps := func(alias string) ([]string, error) {
+		host, err := Resolve(p, alias)
+		require.Nil(t, err)
+		es, err := jumpEndpoints(p, host)
+		var names []string
+		for _, e := range es {
+			names = append(names, e.jump)
+		}
+		return names, err
+	}
+
+	names, err := jumps("web")
+	require.Nil(t, err)
+	require.Equal(t, []string{"outer", "inner", "last"}, names)
+	names, err = jumps("outer")
+	require.Nil(t, err)
+	require.Empty(t, names)
+
+	_, err = jumps("loop")
+	require.ErrorContains(t, err, "ProxyJump loop")
+	_, err = jumps("proxied")
+	require.ErrorContains(t, err, "ProxyCommand is not supported")
+}
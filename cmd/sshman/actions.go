@@ -4,18 +4,28 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
 
+	"github.com/fatih/color"
 	"github.com/sonnt85/gosutils/sutils"
 	"github.com/sonnt85/gosystem"
 	"github.com/sonnt85/sshman"
+	"github.com/sonnt85/sshman/sshconfig"
 	"github.com/spf13/cobra"
 )
 
 var (
 	path             = fmt.Sprintf("%s/.ssh/config", gosystem.GetHomeDir())
 	DisablePrintHost bool
+	// ShowSource print the file and line every value comes from
+	ShowSource bool
+	// OutputFormat machine readable output format, human readable text if empty
+	OutputFormat string
+	// FormatTemplate text/template of the template output
+	FormatTemplate string
 )
 
 type SshConfig struct {
@@ -40,14 +50,37 @@ func (sc *SshConfig) ListSSH(ign, pathShowFlag, onname bool, args []string) erro
 		IgnoreCase: ign,
 	})
 	if err != nil {
-		fmt.Printf(sshman.ErrorFlag)
+		if OutputFormat == "" {
+			fmt.Print(sshman.ErrorFlag)
+		}
 		return err
 	}
+	if OutputFormat != "" {
+		return writeHosts(os.Stdout, hosts, false)
+	}
 	fmt.Printf("%s total records: %d\n\n", sshman.SuccessFlag, len(hosts))
 	printHosts(pathShowFlag, hosts)
+	warnCerts(hosts)
 	return nil
 }
 
+// warnCerts warn about the aliases whose certificates are expired, about to
+// expire or unreadable
+func warnCerts(hosts []*sshman.HostConfig) {
+	var aliases []string
+	for _, host := range hosts {
+		for _, c := range host.Certificates() {
+			if c.State != sshman.CertValid {
+				aliases = append(aliases, host.Alias)
+				break
+			}
+		}
+	}
+	if len(aliases) > 0 {
+		fmt.Fprintf(os.Stderr, "%s the certificates of %s are expired, about to expire or invalid\n", color.YellowString("warning:"), strings.Join(aliases, ", "))
+	}
+}
+
 func ListSSH(ign, pathShowFlag, onname bool, args []string, paths ...string) error {
 	cfgpath := path
 	if len(paths) != 0 {
@@ -57,8 +90,11 @@ func ListSSH(ign, pathShowFlag, onname bool, args []string, paths ...string) err
 }
 
 func listCmd(c *cobra.Command, args []string) error {
+	if err := setOutput(c); err != nil {
+		return err
+	}
 	onname, _ := c.Flags().GetBool("onname")
-	if onname {
+	if onname && OutputFormat == "" {
 		if aliaslist, err := ListMatchAlias(true, args); err == nil {
 			for _, v := range aliaslist {
 				if v != "*" {
@@ -71,6 +107,7 @@ func listCmd(c *cobra.Command, args []string) error {
 	} else {
 		ign, _ := c.Flags().GetBool("ignorecase")
 		pathShowFlag, _ := c.Flags().GetBool("pathshow")
+		ShowSource, _ = c.Flags().GetBool("explain")
 		return ListSSH(ign, pathShowFlag, onname, args)
 	}
 }
@@ -79,43 +116,82 @@ func getoptCmd(c *cobra.Command, args []string) error {
 	if len(args) != 2 {
 		return fmt.Errorf("missing args")
 	}
+	if err := setOutput(c); err != nil {
+		return err
+	}
 	ign, _ := c.Flags().GetBool("ignorecase")
-	//	fmt.Println(args)
+	if OutputFormat != "" {
+		host, err := resolveAlias(args[0], ign)
+		if err != nil {
+			return err
+		}
+		return writeOption(os.Stdout, host, args[1])
+	}
+	if explainFlag, _ := c.Flags().GetBool("explain"); explainFlag {
+		lines, err := ExplainOption(args[0], args[1], ign)
+		if err != nil {
+			return err
+		}
+		fmt.Println(strings.Join(lines, "\n"))
+		return nil
+	}
 	if opt, err := GetOption(args[0], args[1], ign); err == nil {
 		fmt.Println(opt)
 		return nil
 	} else {
 		return err
 	}
+}
 
-	//	return ListSSH(ign, pathShowFlag, onname, args)
+// resolveAlias resolve the alias ssh would connect to for the query: a
+// declared alias, else the first alias matching it, else the query itself
+func resolveAlias(alias string, igncase bool) (*sshman.HostConfig, error) {
+	name := alias
+	if aliases, err := ListMatchAlias(igncase, []string{alias}); err == nil && len(aliases) != 0 {
+		name = aliases[0]
+		for _, a := range aliases {
+			if a == alias {
+				name = alias
+				break
+			}
+		}
+	}
+	return sshman.Resolve(path, name)
 }
 
+// GetOption return the value ssh uses for optionname when connecting to alias.
+// alias is searched like `sshman list` does when it is not a declared alias;
+// multi-valued options return one value per line.
 func GetOption(alias, optionname string, ignorecases ...bool) (ret string, err error) {
-	igncase := false
-	if len(ignorecases) != 0 {
-		igncase = ignorecases[0]
-	}
-	hosts, err := sshman.List(path, sshman.ListOption{
-		Keywords:   []string{alias},
-		IgnoreCase: igncase,
-	})
+	igncase := len(ignorecases) != 0 && ignorecases[0]
+	host, err := resolveAlias(alias, igncase)
 	if err != nil {
 		return "", err
 	}
-	host := hosts[0]
-
-	ret, ok := host.OwnConfig[optionname]
+	if values := host.Values(optionname); len(values) != 0 {
+		return strings.Join(values, "\n"), nil
+	}
+	return "", errors.New("Missing key: " + optionname)
+}
 
-	if ok {
-		return ret, nil
-	} else {
-		ret, ok := host.ImplicitConfig[optionname]
-		if ok {
-			return ret, nil
+// ExplainOption return the values of optionname like GetOption, each followed
+// by the file and line it comes from
+func ExplainOption(alias, optionname string, ignorecases ...bool) ([]string, error) {
+	igncase := len(ignorecases) != 0 && ignorecases[0]
+	host, err := resolveAlias(alias, igncase)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, setting := range host.Settings {
+		if setting.Key == strings.ToLower(optionname) {
+			lines = append(lines, fmt.Sprintf("%s %s", setting.Value, explain(setting)))
 		}
 	}
-	return "", errors.New("Missing key: " + optionname)
+	if len(lines) == 0 {
+		return nil, errors.New("Missing key: " + optionname)
+	}
+	return lines, nil
 }
 
 func ListMatchAlias(IgnoreCase bool, args []string) (alias []string, err error) {
@@ -161,7 +237,7 @@ func AddAlias(addpath, identityfile string, kvConfig map[string]string, pathShow
 	if ao.Path != "" {
 		var err error
 		if ao.Path, err = filepath.Abs(ao.Path); err != nil {
-			fmt.Printf(sshman.ErrorFlag)
+			fmt.Print(sshman.ErrorFlag)
 			return err
 		}
 	}
@@ -182,11 +258,14 @@ func AddAlias(addpath, identityfile string, kvConfig map[string]string, pathShow
 
 	host, err := sshman.Add(path, ao)
 	if err != nil {
-		if enablePrint {
-			fmt.Printf(sshman.ErrorFlag)
+		if enablePrint && OutputFormat == "" {
+			fmt.Print(sshman.ErrorFlag)
 		}
 		return err
 	}
+	if OutputFormat != "" && enablePrint {
+		return writeHosts(os.Stdout, []*sshman.HostConfig{host}, true)
+	}
 
 	if !DisablePrintHost {
 		if enablePrint {
@@ -201,6 +280,9 @@ func AddAlias(addpath, identityfile string, kvConfig map[string]string, pathShow
 }
 
 func addCmd(c *cobra.Command, args []string) error {
+	if err := setOutput(c); err != nil {
+		return err
+	}
 	addpath, _ := c.Flags().GetString("addpath")
 	kvConfig, _ := c.Flags().GetStringToString("config")
 	identityfile, _ := c.Flags().GetString("identityfile")
@@ -252,11 +334,14 @@ func UpdateSSH(remname, identityfile string, kvConfig map[string]string, pathSho
 	host, err := sshman.Update(path, uo)
 
 	if err != nil {
-		if enablePrint {
-			fmt.Printf(sshman.ErrorFlag)
+		if enablePrint && OutputFormat == "" {
+			fmt.Print(sshman.ErrorFlag)
 		}
 		return err
 	}
+	if OutputFormat != "" && enablePrint {
+		return writeHosts(os.Stdout, []*sshman.HostConfig{host}, true)
+	}
 
 	if !DisablePrintHost {
 		if enablePrint {
@@ -268,6 +353,9 @@ func UpdateSSH(remname, identityfile string, kvConfig map[string]string, pathSho
 }
 
 func updateCmd(c *cobra.Command, args []string) error {
+	if err := setOutput(c); err != nil {
+		return err
+	}
 	remname, _ := c.Flags().GetString("rename")
 	kvConfig, _ := c.Flags().GetStringToString("config")
 	identityfile, _ := c.Flags().GetString("identityfile")
@@ -275,16 +363,29 @@ func updateCmd(c *cobra.Command, args []string) error {
 	return UpdateSSH(remname, identityfile, kvConfig, pathShowFlag, args)
 }
 
-func DeleteAlias(pathShowFlag bool, args []string, disablePrints ...bool) error {
+func DeleteAlias(pathShowFlag, purgeKnownHosts bool, args []string, disablePrints ...bool) error {
 	enablePrint := len(disablePrints) != 0 && disablePrints[0]
 	enablePrint = !enablePrint
 	if err := sshman.ArgumentsCheck(len(args), 1, -1); err != nil {
 		return err
 	}
-	hosts, err := sshman.Delete(path, args...)
-	if err != nil {
-		if enablePrint {
-			fmt.Printf(sshman.ErrorFlag)
+	var hosts []*sshman.HostConfig
+	var purged []*sshman.KnownHost
+	var err error
+	if purgeKnownHosts {
+		hosts, purged, err = sshman.DeletePurgeKnownHosts(path, args...)
+	} else {
+		hosts, err = sshman.Delete(path, args...)
+	}
+	if err != nil && hosts == nil {
+		if enablePrint && OutputFormat == "" {
+			fmt.Print(sshman.ErrorFlag)
+		}
+		return err
+	}
+	if OutputFormat != "" && enablePrint {
+		if werr := writeHosts(os.Stdout, hosts, false); werr != nil {
+			return werr
 		}
 		return err
 	}
@@ -292,14 +393,22 @@ func DeleteAlias(pathShowFlag bool, args []string, disablePrints ...bool) error
 		if enablePrint {
 			fmt.Printf("%s deleted successfully\n\n", sshman.SuccessFlag)
 			printHosts(pathShowFlag, hosts)
+			if len(purged) > 0 {
+				fmt.Printf("\n%s removed from known_hosts\n", sshman.SuccessFlag)
+				printKnownHosts(purged)
+			}
 		}
 	}
-	return nil
+	return err
 }
 
 func deleteCmd(c *cobra.Command, args []string) error {
+	if err := setOutput(c); err != nil {
+		return err
+	}
 	pathShowFlag, _ := c.Flags().GetBool("pathshow")
-	return DeleteAlias(pathShowFlag, args)
+	purgeKnownHosts, _ := c.Flags().GetBool("purge-known-hosts")
+	return DeleteAlias(pathShowFlag, purgeKnownHosts, args)
 }
 
 func BackupSSH(args []string, disablePrints ...bool) error {
@@ -341,3 +450,449 @@ func BackupSSH(args []string, disablePrints ...bool) error {
 func backupCmd(c *cobra.Command, args []string) error {
 	return BackupSSH(args)
 }
+
+// FormatSSH canonicalise the formatting of the ssh config files, in check mode
+// it only reports the files that are not formatted and fails if there are any
+func FormatSSH(check, diff bool) error {
+	results, err := sshman.Format(path, sshman.FormatOption{Check: check})
+	if err != nil {
+		fmt.Print(sshman.ErrorFlag)
+		return err
+	}
+	for _, fr := range results {
+		if diff {
+			fmt.Print(fr.Diff())
+		} else {
+			fmt.Println(shortPath(fr.Path))
+		}
+	}
+	if check && len(results) != 0 {
+		return fmt.Errorf("%d file(s) not formatted", len(results))
+	}
+	if !check {
+		fmt.Printf("%s formatted %d file(s)\n", sshman.SuccessFlag, len(results))
+	}
+	return nil
+}
+
+func fmtCmd(c *cobra.Command, args []string) error {
+	check, _ := c.Flags().GetBool("check")
+	diff, _ := c.Flags().GetBool("diff")
+	return FormatSSH(check, diff)
+}
+
+func ApplySSH(changesPath string, pathShowFlag bool) error {
+	r := os.Stdin
+	if changesPath != "-" {
+		f, err := os.Open(changesPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	changes, err := sshman.LoadChanges(r)
+	if err != nil {
+		return err
+	}
+	if err := sshman.Apply(path, changes); err != nil {
+		fmt.Print(sshman.ErrorFlag)
+		return err
+	}
+	fmt.Printf("%s applied %d change(s) successfully\n\n", sshman.SuccessFlag, len(changes))
+	var hosts []*sshman.HostConfig
+	for _, c := range changes {
+		alias := c.Alias
+		if c.Rename != "" {
+			alias = c.Rename
+		}
+		// aliases deleted by a later change resolve to no block
+		if host, err := sshman.Resolve(path, alias); err == nil && c.Op != "delete" && host.Path != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	printHosts(pathShowFlag, hosts)
+	return nil
+}
+
+func applyCmd(c *cobra.Command, args []string) error {
+	pathShowFlag, _ := c.Flags().GetBool("pathshow")
+	return ApplySSH(args[0], pathShowFlag)
+}
+
+func SyncSSH(inventoryPath string, so sshman.SyncOption) error {
+	r := os.Stdin
+	if inventoryPath != "-" {
+		f, err := os.Open(inventoryPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	inv, err := sshman.LoadInventory(r)
+	if err != nil {
+		return err
+	}
+	plan, err := sshman.Sync(path, inv, so)
+	if plan != nil {
+		if plan.Empty() {
+			fmt.Printf("%s %s is up to date\n", sshman.SuccessFlag, shortPath(plan.Target))
+			return err
+		}
+		printPlan(plan)
+	}
+	if err != nil {
+		fmt.Print(sshman.ErrorFlag)
+		return err
+	}
+	if !so.DryRun {
+		fmt.Printf("%s synced %s successfully\n", sshman.SuccessFlag, shortPath(plan.Target))
+	}
+	return nil
+}
+
+func syncCmd(c *cobra.Command, args []string) error {
+	so := sshman.SyncOption{}
+	so.Target, _ = c.Flags().GetString("target")
+	so.Prune, _ = c.Flags().GetBool("prune")
+	so.DryRun, _ = c.Flags().GetBool("dry-run")
+	return SyncSSH(args[0], so)
+}
+
+func ExportSSH(to string, ign bool, args []string) error {
+	hosts, err := sshman.List(path, sshman.ListOption{
+		Keywords:   args,
+		IgnoreCase: ign,
+	})
+	if err != nil {
+		return err
+	}
+	return sshman.WriteAnsible(os.Stdout, to, sshman.AnsibleHosts(path, hosts))
+}
+
+func exportCmd(c *cobra.Command, args []string) error {
+	to, _ := c.Flags().GetString("to")
+	ign, _ := c.Flags().GetBool("ignorecase")
+	return ExportSSH(to, ign, args)
+}
+
+func ImportSSH(from, file string, o sshman.ImportOption) error {
+	im, err := sshman.GetImporter(from)
+	if err != nil {
+		return err
+	}
+	r := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	results, err := sshman.Import(path, im, r, o)
+	if err != nil {
+		fmt.Print(sshman.ErrorFlag)
+		return err
+	}
+	if o.DryRun {
+		fmt.Printf("%s would import %d record(s)\n\n", sshman.SuccessFlag, len(results))
+	} else {
+		fmt.Printf("%s imported %d record(s) successfully\n\n", sshman.SuccessFlag, len(results))
+	}
+	printImport(results)
+	return nil
+}
+
+func importCmd(c *cobra.Command, args []string) error {
+	from, _ := c.Flags().GetString("from")
+	o := sshman.ImportOption{}
+	o.Groups, _ = c.Flags().GetString("groups")
+	o.OnConflict, _ = c.Flags().GetString("on-conflict")
+	o.DryRun, _ = c.Flags().GetBool("dry-run")
+	return ImportSSH(from, args[0], o)
+}
+
+func LintSSH(o sshman.LintOption) error {
+	diagnostics, err := sshman.Lint(path, o)
+	if err != nil {
+		return err
+	}
+	errors, warnings := 0, 0
+	for _, d := range diagnostics {
+		if d.Severity == sshman.SeverityError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	if OutputFormat != "" {
+		if err := encode(os.Stdout, diagnostics); err != nil {
+			return err
+		}
+	} else {
+		printDiagnostics(diagnostics)
+		if len(diagnostics) == 0 {
+			fmt.Printf("%s no problems found in %s\n", sshman.SuccessFlag, shortPath(path))
+		} else {
+			fmt.Printf("\n%d error(s), %d warning(s)\n", errors, warnings)
+		}
+	}
+	if errors > 0 {
+		return fmt.Errorf("%s has %d error(s)", shortPath(path), errors)
+	}
+	return nil
+}
+
+func lintCmd(c *cobra.Command, args []string) error {
+	if err := setEncodeOutput(c); err != nil {
+		return err
+	}
+	o := sshman.LintOption{}
+	o.Strict, _ = c.Flags().GetBool("strict")
+	if version, _ := c.Flags().GetString("openssh"); version != "" {
+		var err error
+		if o.OpenSSH, err = sshconfig.ParseVersion(version); err != nil {
+			return err
+		}
+	}
+	c.SilenceUsage = true
+	return LintSSH(o)
+}
+
+func KeywordsSSH(version sshconfig.Version) error {
+	keywords := sshconfig.Keywords(version)
+	if OutputFormat != "" {
+		return encode(os.Stdout, keywords)
+	}
+	printKeywords(keywords, version)
+	return nil
+}
+
+func keywordsCmd(c *cobra.Command, args []string) error {
+	if err := setEncodeOutput(c); err != nil {
+		return err
+	}
+	var version sshconfig.Version
+	if v, _ := c.Flags().GetString("openssh"); v != "" {
+		var err error
+		if version, err = sshconfig.ParseVersion(v); err != nil {
+			return err
+		}
+	}
+	return KeywordsSSH(version)
+}
+
+// sshCommand return the ssh command line connecting to alias, with -F when
+// the config file is not the one ssh reads by default
+func sshCommand(alias string, command []string) []string {
+	args := []string{"ssh"}
+	abs, err := filepath.Abs(path)
+	if err != nil || abs != filepath.Join(sshman.GetHomeDir(), ".ssh", "config") {
+		args = append(args, "-F", path)
+	}
+	return append(append(args, alias), command...)
+}
+
+// ConnectSSH run ssh for the alias matching query best, with the remote
+// command if any. With dryRun the command is printed instead.
+func ConnectSSH(query string, command []string, dryRun bool, disablePrints ...bool) error {
+	enablePrint := len(disablePrints) != 0 && disablePrints[0]
+	enablePrint = !enablePrint
+	host, err := sshman.FindAlias(path, query)
+	if err != nil {
+		var ambiguous *sshman.AmbiguousError
+		if errors.As(err, &ambiguous) && enablePrint {
+			printMatches(ambiguous.Matches)
+		}
+		return err
+	}
+	args := sshCommand(host.Alias, command)
+	if dryRun {
+		if enablePrint {
+			fmt.Println(shellJoin(args))
+		}
+		return nil
+	}
+	bin, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(bin, args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// ssh handles ^C itself, it must not stop sshman while ssh runs
+	signal.Ignore(os.Interrupt)
+	defer signal.Reset(os.Interrupt)
+	return cmd.Run()
+}
+
+func connectCmd(c *cobra.Command, args []string) error {
+	dryRun, _ := c.Flags().GetBool("dry-run")
+	c.SilenceUsage = true
+	var err error
+	if len(args) == 0 || c.ArgsLenAtDash() == 0 {
+		// no query, the alias is picked
+		err = PickSSH(args, dryRun)
+	} else {
+		err = ConnectSSH(args[0], args[1:], dryRun)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// exit like ssh did, ssh reported the error already
+		os.Exit(exitErr.ExitCode())
+	}
+	return err
+}
+
+func pickCmd(c *cobra.Command, args []string) error {
+	c.SilenceUsage = true
+	return PickSSH(nil, false)
+}
+
+func CheckSSH(o sshman.CheckOption) error {
+	results, err := sshman.Check(path, o)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		if !r.OK() {
+			failed++
+		}
+	}
+	if OutputFormat != "" {
+		if err := encode(os.Stdout, results); err != nil {
+			return err
+		}
+	} else {
+		printCheck(results)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d alias(es) failed the check", failed, len(results))
+	}
+	return nil
+}
+
+func checkCmd(c *cobra.Command, args []string) error {
+	if err := setEncodeOutput(c); err != nil {
+		return err
+	}
+	o := sshman.CheckOption{Aliases: args}
+	o.Concurrency, _ = c.Flags().GetInt("concurrency")
+	o.Timeout, _ = c.Flags().GetDuration("timeout")
+	c.SilenceUsage = true
+	return CheckSSH(o)
+}
+
+func KnownHostsListSSH(args []string) error {
+	known, err := sshman.ListKnownHosts(path, args...)
+	if err != nil {
+		return err
+	}
+	if OutputFormat != "" {
+		return encode(os.Stdout, known)
+	}
+	printKnownHosts(known)
+	return nil
+}
+
+func knownHostsListCmd(c *cobra.Command, args []string) error {
+	if err := setEncodeOutput(c); err != nil {
+		return err
+	}
+	c.SilenceUsage = true
+	return KnownHostsListSSH(args)
+}
+
+func KnownHostsScanSSH(args []string, o sshman.ScanOption) error {
+	var results []*sshman.ScanResult
+	changed := 0
+	var errs []error
+	for _, alias := range args {
+		r, err := sshman.ScanKnownHosts(path, alias, o)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", alias, err))
+			if OutputFormat == "" {
+				fmt.Printf("%s %s: %v\n", sshman.ErrorFlag, alias, err)
+			}
+			continue
+		}
+		if !o.Replace {
+			changed += len(r.Changed)
+		}
+		results = append(results, r)
+		if OutputFormat == "" {
+			printScan(r, o.Replace)
+		}
+	}
+	if OutputFormat != "" {
+		if err := encode(os.Stdout, results); err != nil {
+			return err
+		}
+	}
+	if changed > 0 {
+		errs = append(errs, fmt.Errorf("%d host key(s) changed, check them and scan again with --replace", changed))
+	}
+	return errors.Join(errs...)
+}
+
+func knownHostsScanCmd(c *cobra.Command, args []string) error {
+	if err := setEncodeOutput(c); err != nil {
+		return err
+	}
+	o := sshman.ScanOption{}
+	o.Timeout, _ = c.Flags().GetDuration("timeout")
+	o.Replace, _ = c.Flags().GetBool("replace")
+	c.SilenceUsage = true
+	return KnownHostsScanSSH(args, o)
+}
+
+func KnownHostsRemoveSSH(args []string) error {
+	removed, err := sshman.RemoveKnownHosts(path, args...)
+	if err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		fmt.Println("no known_hosts entry found")
+		return nil
+	}
+	fmt.Printf("%s removed from known_hosts\n", sshman.SuccessFlag)
+	printKnownHosts(removed)
+	return nil
+}
+
+func knownHostsRemoveCmd(c *cobra.Command, args []string) error {
+	c.SilenceUsage = true
+	return KnownHostsRemoveSSH(args)
+}
+
+func KnownHostsPruneSSH(dryRun bool) error {
+	pruned, err := sshman.PruneKnownHosts(path, dryRun)
+	if err != nil {
+		return err
+	}
+	if OutputFormat != "" {
+		return encode(os.Stdout, pruned)
+	}
+	switch {
+	case len(pruned) == 0:
+		fmt.Printf("%s every known_hosts entry is for an alias\n", sshman.SuccessFlag)
+	case dryRun:
+		fmt.Println("entries for no alias:")
+		printKnownHosts(pruned)
+	default:
+		fmt.Printf("%s removed from known_hosts\n", sshman.SuccessFlag)
+		printKnownHosts(pruned)
+	}
+	return nil
+}
+
+func knownHostsPruneCmd(c *cobra.Command, args []string) error {
+	if err := setEncodeOutput(c); err != nil {
+		return err
+	}
+	dryRun, _ := c.Flags().GetBool("dry-run")
+	c.SilenceUsage = true
+	return KnownHostsPruneSSH(dryRun)
+}
@@ -0,0 +1,81 @@
+package sshman
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/sonnt85/sshman"
+	"github.com/spf13/cobra"
+)
+
+func CAInitSSH(caPath string, o sshman.KeyOption) error {
+	ca, err := sshman.InitCA(caPath, o)
+	if err != nil {
+		if OutputFormat == "" {
+			fmt.Print(sshman.ErrorFlag)
+		}
+		return err
+	}
+	if OutputFormat != "" {
+		return encode(os.Stdout, ca)
+	}
+	fmt.Printf("%s %s CA key %s written to %s\n\n", sshman.SuccessFlag, ca.Type, ca.Fingerprint, shortPath(ca.Path))
+	fmt.Printf("Servers trust it with the TrustedUserCAKeys file of sshd_config holding:\n%s\n", ca.PublicKey)
+	return nil
+}
+
+func caInitCmd(c *cobra.Command, args []string) error {
+	if err := setEncodeOutput(c); err != nil {
+		return err
+	}
+	caPath, _ := c.Flags().GetString("ca")
+	o := sshman.KeyOption{}
+	o.Type, _ = c.Flags().GetString("type")
+	o.Bits, _ = c.Flags().GetInt("bits")
+	o.Comment, _ = c.Flags().GetString("comment")
+	c.SilenceUsage = true
+	return CAInitSSH(caPath, o)
+}
+
+func CASignSSH(alias string, o sshman.SignOption, pathShowFlag bool) error {
+	signed, err := sshman.SignKey(path, alias, o)
+	if err != nil {
+		if OutputFormat == "" {
+			fmt.Print(sshman.ErrorFlag)
+		}
+		return err
+	}
+	if OutputFormat != "" {
+		return encode(os.Stdout, signed)
+	}
+	fmt.Printf("%s %s signed for %s, %s\n\n", sshman.SuccessFlag, shortPath(signed.Key), color.MagentaString(alias), certSummary(signed.Certificate))
+	printHost(pathShowFlag, signed.Host)
+	return nil
+}
+
+func caSignCmd(c *cobra.Command, args []string) error {
+	if err := setEncodeOutput(c); err != nil {
+		return err
+	}
+	o := sshman.SignOption{}
+	o.CA, _ = c.Flags().GetString("ca")
+	o.Key, _ = c.Flags().GetString("key")
+	o.KeyID, _ = c.Flags().GetString("id")
+	o.Principals, _ = c.Flags().GetStringSlice("principals")
+	if validity, _ := c.Flags().GetString("validity"); validity != "" {
+		var err error
+		if o.Validity, err = sshman.ParseValidity(validity); err != nil {
+			return err
+		}
+	}
+	if c.Flags().Changed("extension") {
+		o.Extensions, _ = c.Flags().GetStringSlice("extension")
+		if len(o.Extensions) == 1 && o.Extensions[0] == "clear" {
+			o.Extensions = []string{}
+		}
+	}
+	pathShowFlag, _ := c.Flags().GetBool("pathshow")
+	c.SilenceUsage = true
+	return CASignSSH(args[0], o, pathShowFlag)
+}
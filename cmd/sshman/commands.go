@@ -3,7 +3,9 @@ package sshman
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sonnt85/sshman"
 	"github.com/spf13/cobra"
@@ -17,7 +19,8 @@ var sshManCmd = &cobra.Command{
 
 	},
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-
+		sshman.AutoBackup, _ = cmd.Flags().GetBool("auto-backup")
+		sshman.BackupDir, _ = cmd.Flags().GetString("backup-dir")
 	},
 }
 
@@ -39,6 +42,13 @@ func Init_SshMan(parent ...*cobra.Command) {
 	}
 
 	sshManCmd.PersistentFlags().StringVarP(&path, "file", "f", fmt.Sprintf("%s/.ssh/config", sshman.GetHomeDir()), "Path ssh_config file")
+	autoBackup, _ := strconv.ParseBool(os.Getenv("MANSSH_AUTO_BACKUP"))
+	sshManCmd.PersistentFlags().Bool("auto-backup", autoBackup, "save a timestamped copy of every config file before changing it")
+	sshManCmd.PersistentFlags().String("backup-dir", os.Getenv("MANSSH_BACKUP_DIR"), "directory of the automatic backups, next to the main config file by default")
+	sshManCmd.MarkPersistentFlagFilename("file")
+	sshManCmd.MarkPersistentFlagDirname("backup-dir")
+	// the completion command below is used instead
+	sshManCmd.CompletionOptions.DisableDefaultCmd = true
 	m := make(map[string]string)
 	sshmanAdd.Flags().StringToStringP("config", "c", m, "config map[string]string")
 	sshmanAdd.Flags().StringP("identityfile", "i", "", "identityfile file")
@@ -51,6 +61,10 @@ func Init_SshMan(parent ...*cobra.Command) {
 		}
 	}
 	sshmanAdd.Flags().BoolP("pathshow", "p", pathShow, "display the file path of the alias")
+	sshmanAdd.RegisterFlagCompletionFunc("config", completeConfig)
+	sshmanAdd.MarkFlagFilename("identityfile")
+	sshmanAdd.MarkFlagFilename("addpath")
+	addOutputFlags(sshmanAdd)
 	sshManCmd.AddCommand(sshmanAdd)
 
 	sshmanList := &cobra.Command{
@@ -59,10 +73,14 @@ func Init_SshMan(parent ...*cobra.Command) {
 		Long:    "sshman list aliasname",
 		RunE:    listCmd,
 		Aliases: []string{"l"},
+		// list takes keywords, the aliases are the likeliest ones
+		ValidArgsFunction: completeAliases,
 	}
 	sshmanList.Flags().BoolP("ignorecase", "I", true, "ignore case while searching")
 	sshmanList.Flags().BoolP("onname", "n", false, "Show only name alias")
 	sshmanList.Flags().BoolP("pathshow", "p", pathShow, "display the file path of the alias")
+	sshmanList.Flags().BoolP("explain", "e", false, "display the file and line every value comes from")
+	addOutputFlags(sshmanList)
 	sshManCmd.AddCommand(sshmanList)
 
 	sshmanGetOpt := &cobra.Command{
@@ -71,10 +89,14 @@ func Init_SshMan(parent ...*cobra.Command) {
 		Long:    "sshman get aliasname port",
 		RunE:    getoptCmd,
 		Aliases: []string{"g"},
+		// alias then keyword
+		ValidArgsFunction: completeGet,
 	}
 	sshmanGetOpt.Flags().BoolP("ignorecase", "I", true, "ignore case while searching")
+	sshmanGetOpt.Flags().BoolP("explain", "e", false, "display the file and line the value comes from")
 	//	mansshList.Flags().BoolP("onname", "n", false, "Show only name alias")
 	//	mansshList.Flags().BoolP("pathshow", "p", pathShow, "display the file path of the alias")
+	addOutputFlags(sshmanGetOpt)
 	sshManCmd.AddCommand(sshmanGetOpt)
 
 	sshmanUpdate := &cobra.Command{
@@ -83,14 +105,21 @@ func Init_SshMan(parent ...*cobra.Command) {
 		Long:    "sshman update  aliasname -c port=22",
 		RunE:    updateCmd,
 		Aliases: []string{"u"},
+		// the second argument is a new connection string
+		ValidArgsFunction: completeFirstAlias,
 	}
 	m = make(map[string]string)
 
 	sshmanUpdate.Flags().StringToStringP("config", "c", m, "config map[string]string")
 	sshmanUpdate.Flags().StringP("rename", "r", "", "rename alias")
+	sshmanUpdate.Flags().StringP("identityfile", "i", "", "identityfile file")
 	sshmanUpdate.Flags().StringP("addpath", "a", os.Getenv("MANSSH_ADD_PATH"), "addpath")
+	sshmanUpdate.RegisterFlagCompletionFunc("config", completeConfig)
+	sshmanUpdate.MarkFlagFilename("identityfile")
+	sshmanUpdate.MarkFlagFilename("addpath")
 
 	sshmanUpdate.Flags().BoolP("pathshow", "p", pathShow, "display the file path of the alias")
+	addOutputFlags(sshmanUpdate)
 	sshManCmd.AddCommand(sshmanUpdate)
 
 	sshmanDelete := &cobra.Command{
@@ -98,9 +127,13 @@ func Init_SshMan(parent ...*cobra.Command) {
 		Short:   "Delete one or more ssh aliases",
 		RunE:    deleteCmd,
 		Aliases: []string{"d"},
+		// every argument is an alias
+		ValidArgsFunction: completeAliases,
 	}
 
 	sshmanDelete.Flags().BoolP("pathshow", "p", pathShow, "display the file path of the alias")
+	sshmanDelete.Flags().Bool("purge-known-hosts", false, "remove the known_hosts entries of the aliases too, unless another alias uses the same host")
+	addOutputFlags(sshmanDelete)
 	sshManCmd.AddCommand(sshmanDelete)
 
 	sshmanBackup := &cobra.Command{
@@ -110,6 +143,338 @@ func Init_SshMan(parent ...*cobra.Command) {
 		Aliases: []string{"b"},
 	}
 	sshManCmd.AddCommand(sshmanBackup)
+
+	sshmanFmt := &cobra.Command{
+		Use:   "fmt",
+		Short: "Canonicalise the formatting of the ssh config files [sshman fmt --check --diff]",
+		Long:  "sshman fmt --check --diff",
+		RunE:  fmtCmd,
+		Args:  cobra.NoArgs,
+	}
+	sshmanFmt.Flags().Bool("check", false, "only report the files that are not formatted, fail if there are any")
+	sshmanFmt.Flags().Bool("diff", false, "display the diff of the formatting changes")
+	sshManCmd.AddCommand(sshmanFmt)
+
+	sshmanApply := &cobra.Command{
+		Use:   "apply",
+		Short: "Apply a yaml file of add/update/delete changes all at once or not at all [sshman apply changes.yaml]",
+		Long:  "sshman apply changes.yaml\n\nThe changes file is read from stdin when it is \"-\", -f selects the ssh config file as for every command.",
+		RunE:  applyCmd,
+		Args:  cobra.ExactArgs(1),
+	}
+	sshmanApply.Flags().BoolP("pathshow", "p", pathShow, "display the file path of the alias")
+	sshManCmd.AddCommand(sshmanApply)
+
+	sshmanSync := &cobra.Command{
+		Use:   "sync",
+		Short: "Make the managed hosts match an inventory file [sshman sync inventory.yaml --target ~/.ssh/conf.d/managed --prune]",
+		Long:  "sshman sync inventory.yaml --target ~/.ssh/conf.d/managed --prune\n\nOnly the target file is written, hosts declared in other files are left untouched.",
+		RunE:  syncCmd,
+		Args:  cobra.ExactArgs(1),
+	}
+	sshmanSync.Flags().StringP("target", "t", "", "file the managed hosts are written to (default conf.d/managed next to the config file)")
+	sshmanSync.Flags().Bool("prune", false, "remove the hosts of the target file that are not in the inventory")
+	sshmanSync.Flags().BoolP("dry-run", "n", false, "only print the plan")
+	sshManCmd.AddCommand(sshmanSync)
+
+	sshmanLint := &cobra.Command{
+		Use:   "lint",
+		Short: "Check the config file and the files it includes [sshman lint --strict]",
+		Long: "sshman lint [--strict] [--openssh 8.4] [-o json]\n\n" +
+			"Reports unknown keywords, invalid values, deprecated options, values shadowed by earlier blocks,\n" +
+			"aliases declared in several files and missing IdentityFile paths as file:line diagnostics.\n" +
+			"With --openssh, keywords the given release does not know yet are errors.\n" +
+			"Exits with an error when there are errors, or any diagnostic with --strict.",
+		RunE: lintCmd,
+		Args: cobra.NoArgs,
+	}
+	sshmanLint.Flags().Bool("strict", false, "report warnings as errors")
+	sshmanLint.Flags().StringP("output", "o", "", "print the diagnostics as json or yaml")
+	sshmanLint.Flags().String("openssh", "", "check the config for this OpenSSH release, e.g. 8.4 or OpenSSH_8.4p1 (default latest)")
+	sshManCmd.AddCommand(sshmanLint)
+
+	sshmanKeywords := &cobra.Command{
+		Use:   "keywords",
+		Short: "List the keywords of ssh_config [sshman keywords --openssh 8.4]",
+		Long: "sshman keywords [--openssh 8.4] [-o json]\n\n" +
+			"Lists the client keywords with their kind of value, allowed values, default and the OpenSSH release\n" +
+			"that added or deprecated them. With --openssh, only the keywords the release knows are listed.",
+		RunE: keywordsCmd,
+		Args: cobra.NoArgs,
+	}
+	sshmanKeywords.Flags().String("openssh", "", "list the keywords of this OpenSSH release, e.g. 8.4 or OpenSSH_8.4p1 (default latest)")
+	sshmanKeywords.Flags().StringP("output", "o", "", "print the keywords as json or yaml")
+	sshManCmd.AddCommand(sshmanKeywords)
+
+	sshmanExport := &cobra.Command{
+		Use:   "export",
+		Short: "Export the aliases as an ansible inventory [sshman export --to ansible-ini keyword]",
+		Long:  "sshman export --to ansible-ini|ansible-yaml [keywords...]",
+		RunE:  exportCmd,
+	}
+	sshmanExport.Flags().String("to", sshman.AnsibleINI, "export format: ansible-ini|ansible-yaml")
+	sshmanExport.Flags().BoolP("ignorecase", "I", true, "ignore case while searching")
+	sshManCmd.AddCommand(sshmanExport)
+
+	sshmanImport := &cobra.Command{
+		Use:   "import",
+		Short: "Import hosts from another tool [sshman import --from putty-reg sessions.reg]",
+		Long: "sshman import --from " + strings.Join(sshman.Importers(), "|") + " [--groups comment|files] [--on-conflict fail|skip|rename|overwrite] [--dry-run] file\n\n" +
+			"The file is read from stdin when it is \"-\".",
+		RunE: importCmd,
+		Args: cobra.ExactArgs(1),
+	}
+	sshmanImport.Flags().String("from", "ansible", "import format: "+strings.Join(sshman.Importers(), "|"))
+	sshmanImport.Flags().String("groups", sshman.GroupsComment, "keep groups as a comment on the Host line (comment) or in conf.d/<group> files (files)")
+	sshmanImport.Flags().String("on-conflict", sshman.ConflictFail, "when an alias exists: fail, skip the record, rename it to <alias>-N or overwrite the alias")
+	sshmanImport.Flags().BoolP("dry-run", "n", false, "only print what would be imported")
+	sshManCmd.AddCommand(sshmanImport)
+
+	sshmanConnect := &cobra.Command{
+		Use:   "connect",
+		Short: "Run ssh for the alias matching a query best [sshman connect web -- uptime]",
+		Long: "sshman connect [--dry-run] [query] [-- command...]\n\n" +
+			"The query is matched like list does, an alias equal to it first, then the aliases starting with it,\n" +
+			"containing it, whose values match it and holding its letters in order. When several aliases match\n" +
+			"equally well they are listed and nothing is run. -F is passed to ssh when -f is not ~/.ssh/config.\n" +
+			"Without a query the alias is chosen in the picker, see pick.",
+		RunE:              connectCmd,
+		Aliases:           []string{"c"},
+		ValidArgsFunction: completeFirstAlias,
+	}
+	sshmanConnect.Flags().BoolP("dry-run", "n", false, "only print the ssh command")
+	sshManCmd.AddCommand(sshmanConnect)
+
+	sshmanPick := &cobra.Command{
+		Use:   "pick",
+		Short: "Pick an alias in a fuzzy finder and connect to it [sshman pick]",
+		Long: "sshman pick\n\n" +
+			"Type to filter the aliases by alias, hostname, user or comment, the selected one is previewed on the right.\n" +
+			"  enter      connect with ssh\n" +
+			"  up/down    move, also ctrl-p/ctrl-n\n" +
+			"  ctrl-y     copy the alias to the clipboard\n" +
+			"  ctrl-e     open the file of the alias in $VISUAL or $EDITOR\n" +
+			"  ctrl-d     delete the alias, after y\n" +
+			"  esc        quit",
+		RunE: pickCmd,
+		Args: cobra.NoArgs,
+	}
+	sshManCmd.AddCommand(sshmanPick)
+
+	sshmanCheck := &cobra.Command{
+		Use:   "check",
+		Short: "Check that the aliases are reachable and accept the keys [sshman check web db]",
+		Long: "sshman check [aliases...] [--concurrency 4] [--timeout 5s] [-o json]\n\n" +
+			"Connects to every alias, or the given ones, through its ProxyJump hosts and reports whether the TCP\n" +
+			"connection succeeds, the banner and host key algorithm of the server, and whether it accepts the\n" +
+			"IdentityFile keys or those of the agent. Host keys are not checked against known_hosts and\n" +
+			"ProxyCommand is not supported. Exits with an error when an alias fails.",
+		RunE:              checkCmd,
+		ValidArgsFunction: completeAliases,
+	}
+	sshmanCheck.Flags().Int("concurrency", 4, "number of aliases checked at once")
+	sshmanCheck.Flags().Duration("timeout", 5*time.Second, "time the check of an alias may take")
+	sshmanCheck.Flags().StringP("output", "o", "", "print the results as json or yaml")
+	sshManCmd.AddCommand(sshmanCheck)
+
+	sshmanKnownHosts := &cobra.Command{
+		Use:   "known-hosts",
+		Short: "Manage the known_hosts entries of the aliases [sshman known-hosts list web]",
+		Long: "sshman known-hosts list|scan|remove|prune\n\n" +
+			"An alias is looked up in its UserKnownHostsFile files by its HostKeyAlias, or its HostName and Port\n" +
+			"as ssh does, hashed entries included.",
+		Aliases: []string{"kh"},
+	}
+	sshmanKnownHostsList := &cobra.Command{
+		Use:   "list",
+		Short: "List the known_hosts entries with the aliases they are for, or those of the given aliases [sshman known-hosts list web]",
+		Long:  "sshman known-hosts list [aliases...] [-o json]",
+		RunE:  knownHostsListCmd,
+		// every argument is an alias
+		ValidArgsFunction: completeAliases,
+	}
+	sshmanKnownHostsList.Flags().StringP("output", "o", "", "print the entries as json or yaml")
+	sshmanKnownHostsScan := &cobra.Command{
+		Use:   "scan",
+		Short: "Fetch the host keys of aliases and add the new ones to known_hosts [sshman known-hosts scan web]",
+		Long: "sshman known-hosts scan aliases... [--timeout 5s] [--replace] [-o json]\n\n" +
+			"The keys are fetched through the ProxyJump hosts, like ssh-keyscan does, and hashed if HashKnownHosts\n" +
+			"is set. A key that differs from the known one is reported and fails the command, it is replaced\n" +
+			"with --replace only: check it with the administrator of the host first.",
+		RunE:              knownHostsScanCmd,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeAliases,
+	}
+	sshmanKnownHostsScan.Flags().Duration("timeout", 5*time.Second, "time the scan of an alias may take")
+	sshmanKnownHostsScan.Flags().Bool("replace", false, "replace the known keys that changed")
+	sshmanKnownHostsScan.Flags().StringP("output", "o", "", "print the results as json or yaml")
+	sshmanKnownHostsRemove := &cobra.Command{
+		Use:               "remove",
+		Short:             "Remove the known_hosts entries of aliases, as ssh-keygen -R does [sshman known-hosts remove web]",
+		RunE:              knownHostsRemoveCmd,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeAliases,
+	}
+	sshmanKnownHostsPrune := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove the known_hosts entries that are for no alias [sshman known-hosts prune --dry-run]",
+		Long: "sshman known-hosts prune [--dry-run] [-o json]\n\n" +
+			"Removes the entries, hashed ones included, that are for no alias and no ProxyJump host. Hosts ssh\n" +
+			"connects to without an alias lose their entries too, check the list with --dry-run first.\n" +
+			"Entries with wildcards, @cert-authority and @revoked entries are kept.",
+		RunE: knownHostsPruneCmd,
+		Args: cobra.NoArgs,
+	}
+	sshmanKnownHostsPrune.Flags().BoolP("dry-run", "n", false, "only list the entries")
+	sshmanKnownHostsPrune.Flags().StringP("output", "o", "", "print the entries as json or yaml")
+	sshmanKnownHosts.AddCommand(sshmanKnownHostsList, sshmanKnownHostsScan, sshmanKnownHostsRemove, sshmanKnownHostsPrune)
+	sshManCmd.AddCommand(sshmanKnownHosts)
+
+	sshmanKey := &cobra.Command{
+		Use:   "key",
+		Short: "Manage the keys of the aliases [sshman key new web]",
+		Long:  "sshman key list|new|deploy|rotate",
+	}
+	sshmanKey.PersistentFlags().String("dir", os.Getenv("MANSSH_KEY_DIR"), "directory of the keys (default ~/.ssh)")
+	sshmanKey.MarkPersistentFlagDirname("dir")
+	sshmanKeyList := &cobra.Command{
+		Use:   "list",
+		Short: "List the keys of the key directory with the aliases using them [sshman key list --unused]",
+		Long: "sshman key list [--unused] [-o json]\n\n" +
+			"Prints the type, bits, SHA256 fingerprint, comment and passphrase protection of the private keys, public\n" +
+			"keys and certificates of the key directory, with the aliases using them as IdentityFile or\n" +
+			"CertificateFile in the config file and its Include files. ssh tries the default identities for the\n" +
+			"aliases without IdentityFile. The IdentityFile and CertificateFile of the aliases that do not exist\n" +
+			"are listed after the keys.",
+		RunE: keyListCmd,
+		Args: cobra.NoArgs,
+	}
+	sshmanKeyList.Flags().Bool("unused", false, "only list the keys no alias uses")
+	sshmanKeyList.Flags().StringP("output", "o", "", "print the keys as json or yaml")
+	sshmanKey.AddCommand(sshmanKeyList)
+	sshmanKeyNew := &cobra.Command{
+		Use:   "new",
+		Short: "Generate a key pair for an alias and make it its IdentityFile [sshman key new web --type ed25519]",
+		Long: "sshman key new alias [--type " + strings.Join(sshman.KeyTypes, "|") + "] [--bits N] [--comment text]\n\n" +
+			"The private key is written to <dir>/id_<type>_<alias> with mode 0600 and the public key next to it with\n" +
+			"the .pub suffix and mode 0644, existing files are never overwritten. The alias gets the key as\n" +
+			"IdentityFile and IdentitiesOnly yes.",
+		RunE:              keyNewCmd,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstAlias,
+	}
+	sshmanKeyNew.Flags().StringP("type", "t", sshman.KeyEd25519, "key type: "+strings.Join(sshman.KeyTypes, "|"))
+	sshmanKeyNew.Flags().IntP("bits", "b", 0, "bits of ecdsa (256|384|521) and rsa keys (default 256 and 3072)")
+	sshmanKeyNew.Flags().StringP("comment", "C", "", "comment of the key (default user@hostname)")
+	sshmanKeyNew.Flags().BoolP("pathshow", "p", pathShow, "display the file path of the alias")
+	sshmanKeyNew.Flags().StringP("output", "o", "", "print the key as json or yaml")
+	sshmanKeyNew.RegisterFlagCompletionFunc("type", cobra.FixedCompletions(sshman.KeyTypes, cobra.ShellCompDirectiveNoFileComp))
+	sshmanKey.AddCommand(sshmanKeyNew)
+	sshmanKeyDeploy := &cobra.Command{
+		Use:   "deploy",
+		Short: "Add a public key to the authorized_keys of an alias, as ssh-copy-id does [sshman key deploy web]",
+		Long: "sshman key deploy alias [--key path] [--accept-new] [--timeout 30s] [-o json]\n\n" +
+			"Logs in with the user, port, ProxyJump hosts and keys of the alias, or its password, and adds the key to\n" +
+			"~/.ssh/authorized_keys unless it is there already, with the modes sshd expects. Then checks that the key\n" +
+			"alone logs in. The key is the first IdentityFile of the alias with a .pub file by default.\n" +
+			"The host keys of the alias and its ProxyJump hosts must be in known_hosts, unless StrictHostKeyChecking\n" +
+			"allows it or --accept-new is given.",
+		RunE:              keyDeployCmd,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstAlias,
+	}
+	sshmanKeyDeploy.Flags().StringP("key", "k", "", "public key to deploy, or its private key (default the IdentityFile of the alias)")
+	sshmanKeyDeploy.Flags().Duration("timeout", 30*time.Second, "time the deployment may take")
+	sshmanKeyDeploy.Flags().Bool("accept-new", false, "trust and add to known_hosts the host keys that are not there yet")
+	sshmanKeyDeploy.Flags().StringP("output", "o", "", "print the result as json or yaml")
+	sshmanKeyDeploy.MarkFlagFilename("key")
+	sshmanKey.AddCommand(sshmanKeyDeploy)
+	sshmanKeyRotate := &cobra.Command{
+		Use:   "rotate",
+		Short: "Replace the key of aliases with a new one, here and on the servers [sshman key rotate --match 'web-*']",
+		Long: "sshman key rotate [aliases...] [--match pattern] [--resume] [--type ed25519] [--keep-old] [--accept-new] [-o json]\n\n" +
+			"For every alias: generates <dir>/id_<type>_<alias>-<date>, adds it to the remote authorized_keys logging in\n" +
+			"with the current key, checks that the new key alone logs in, replaces the IdentityFile of the alias with\n" +
+			"it in the file that sets it, then removes the old public key from authorized_keys. The old key files\n" +
+			"are left on disk. The step each alias reached is saved next to the config file until its rotation is\n" +
+			"done, running the command again for the alias, or with --resume, continues from there. Host keys are\n" +
+			"verified as key deploy does.",
+		RunE:              keyRotateCmd,
+		ValidArgsFunction: completeAliases,
+	}
+	sshmanKeyRotate.Flags().String("match", "", "rotate the aliases matching the ssh patterns, such as 'web-*,!web-old'")
+	sshmanKeyRotate.Flags().Bool("resume", false, "continue the rotations that did not finish")
+	sshmanKeyRotate.Flags().StringP("type", "t", sshman.KeyEd25519, "type of the new keys: "+strings.Join(sshman.KeyTypes, "|"))
+	sshmanKeyRotate.Flags().IntP("bits", "b", 0, "bits of ecdsa (256|384|521) and rsa keys (default 256 and 3072)")
+	sshmanKeyRotate.Flags().StringP("comment", "C", "", "comment of the new keys (default user@hostname)")
+	sshmanKeyRotate.Flags().Bool("keep-old", false, "leave the old key in the remote authorized_keys")
+	sshmanKeyRotate.Flags().Bool("accept-new", false, "trust and add to known_hosts the host keys that are not there yet")
+	sshmanKeyRotate.Flags().Duration("timeout", 30*time.Second, "time the rotation of an alias may take")
+	sshmanKeyRotate.Flags().StringP("output", "o", "", "print the results as json or yaml")
+	sshmanKeyRotate.RegisterFlagCompletionFunc("type", cobra.FixedCompletions(sshman.KeyTypes, cobra.ShellCompDirectiveNoFileComp))
+	sshmanKey.AddCommand(sshmanKeyRotate)
+	sshManCmd.AddCommand(sshmanKey)
+
+	sshmanCA := &cobra.Command{
+		Use:   "ca",
+		Short: "Sign the keys of the aliases with a local certificate authority [sshman ca sign web -n deploy -V 8h]",
+		Long:  "sshman ca init|sign",
+	}
+	sshmanCA.PersistentFlags().String("ca", os.Getenv("MANSSH_CA"), "private key of the certificate authority (default ~/.ssh/sshman_ca)")
+	sshmanCA.MarkPersistentFlagFilename("ca")
+	sshmanCAInit := &cobra.Command{
+		Use:   "init",
+		Short: "Generate the key of the certificate authority [sshman ca init]",
+		Long: "sshman ca init [--ca path] [--type ed25519] [--comment text]\n\n" +
+			"The key is written like key new does, it is never overwritten. Servers trust the certificates it signs\n" +
+			"with its public key in the TrustedUserCAKeys file of sshd_config.",
+		RunE: caInitCmd,
+		Args: cobra.NoArgs,
+	}
+	sshmanCAInit.Flags().StringP("type", "t", sshman.KeyEd25519, "key type: "+strings.Join(sshman.KeyTypes, "|"))
+	sshmanCAInit.Flags().IntP("bits", "b", 0, "bits of ecdsa (256|384|521) and rsa keys (default 256 and 3072)")
+	sshmanCAInit.Flags().StringP("comment", "C", "", "comment of the key (default sshman CA user@hostname)")
+	sshmanCAInit.Flags().StringP("output", "o", "", "print the key as json or yaml")
+	sshmanCAInit.RegisterFlagCompletionFunc("type", cobra.FixedCompletions(sshman.KeyTypes, cobra.ShellCompDirectiveNoFileComp))
+	sshmanCA.AddCommand(sshmanCAInit)
+	sshmanCASign := &cobra.Command{
+		Use:   "sign",
+		Short: "Sign the key of an alias and make the certificate its CertificateFile [sshman ca sign web -n deploy -V 8h]",
+		Long: "sshman ca sign alias [--key path] [-n principals] [-V 24h] [-O extension] [-I id] [-o json]\n\n" +
+			"Writes the user certificate next to the key with the -cert.pub suffix, replacing the previous one, and\n" +
+			"sets it as the CertificateFile of the alias. The key is the first IdentityFile of the alias with a .pub\n" +
+			"file by default, the principals its User. The certificate is valid from 5 minutes ago for the validity,\n" +
+			"such as 8h, 30d or 52w, with the extensions of ssh-keygen unless -O is given; -O clear gives none.\n" +
+			"sshman list shows the principals and expiry of the certificates of the aliases.",
+		RunE:              caSignCmd,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirstAlias,
+	}
+	sshmanCASign.Flags().StringP("key", "k", "", "public key to sign, or its private key (default the IdentityFile of the alias)")
+	sshmanCASign.Flags().StringSliceP("principals", "n", nil, "users the certificate is valid for (default the User of the alias)")
+	sshmanCASign.Flags().StringP("validity", "V", "24h", "how long the certificate is valid, such as 8h, 30d or 52w")
+	sshmanCASign.Flags().StringSliceP("extension", "O", nil, "extension, name or name=value, repeatable (default those of ssh-keygen)")
+	sshmanCASign.Flags().StringP("id", "I", "", "identity of the certificate (default the alias)")
+	sshmanCASign.Flags().BoolP("pathshow", "p", pathShow, "display the file path of the alias")
+	sshmanCASign.Flags().StringP("output", "o", "", "print the certificate as json or yaml")
+	sshmanCASign.MarkFlagFilename("key")
+	sshmanCASign.RegisterFlagCompletionFunc("extension", cobra.FixedCompletions(append([]string{"clear"}, sshman.DefaultExtensions...), cobra.ShellCompDirectiveNoFileComp))
+	sshmanCA.AddCommand(sshmanCASign)
+	sshManCmd.AddCommand(sshmanCA)
+
+	sshmanCompletion := &cobra.Command{
+		Use:   "completion",
+		Short: "Generate the completion script of a shell [sshman completion bash]",
+		Long: "sshman completion " + strings.Join(completionShells, "|") + "\n\n" +
+			"Completes the aliases of the config file, the keywords of -c key=value and get, and their values.\n\n" +
+			"  bash: source <(sshman completion bash)\n" +
+			"  zsh:  sshman completion zsh > \"${fpath[1]}/_sshman\"\n" +
+			"  fish: sshman completion fish > ~/.config/fish/completions/sshman.fish",
+		RunE:      completionCmd,
+		Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: completionShells,
+	}
+	sshManCmd.AddCommand(sshmanCompletion)
 }
 
 func Execute(args ...string) {
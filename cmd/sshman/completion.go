@@ -0,0 +1,121 @@
+package sshman
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sonnt85/sshman"
+	"github.com/sonnt85/sshman/sshconfig"
+	"github.com/spf13/cobra"
+)
+
+// completionShells shells of the completion command
+var completionShells = []string{"bash", "zsh", "fish"}
+
+func completionCmd(c *cobra.Command, args []string) error {
+	root := c.Root()
+	switch args[0] {
+	case "bash":
+		return root.GenBashCompletionV2(os.Stdout, true)
+	case "zsh":
+		return root.GenZshCompletion(os.Stdout)
+	case "fish":
+		return root.GenFishCompletion(os.Stdout, true)
+	}
+	return fmt.Errorf("unknown shell %q, expect one of %s", args[0], strings.Join(completionShells, ", "))
+}
+
+// completeAliases complete the aliases of the config file that are not in
+// args yet, with their connection string as description
+func completeAliases(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	hosts, err := sshman.List(path, sshman.ListOption{})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveError
+	}
+	given := map[string]bool{}
+	for _, arg := range args {
+		given[arg] = true
+	}
+	var aliases []string
+	for _, host := range hosts {
+		if given[host.Alias] || strings.ContainsAny(host.Alias, "*?!") || !strings.HasPrefix(host.Alias, toComplete) {
+			continue
+		}
+		user, hostname, port := host.Connection()
+		if hostname == "" {
+			hostname = host.Alias
+		}
+		aliases = append(aliases, fmt.Sprintf("%s\t%s@%s:%s", host.Alias, user, hostname, port))
+	}
+	return aliases, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeFirstAlias complete an alias as the first argument only
+func completeFirstAlias(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeAliases(c, args, toComplete)
+}
+
+// completeGet complete the alias then the keyword of get
+func completeGet(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		return completeAliases(c, args, toComplete)
+	case 1:
+		return keywordNames(toComplete, ""), cobra.ShellCompDirectiveNoFileComp
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeConfig complete the key=value of --config: the keyword, then the
+// values a keyword with a fixed set of values accepts
+func completeConfig(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	key, value, found := strings.Cut(toComplete, "=")
+	if !found {
+		return keywordNames(toComplete, "="), cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+	}
+	spec := sshconfig.LookupKeyword(key)
+	if spec == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var values []string
+	for _, v := range keywordValues(spec) {
+		if strings.HasPrefix(strings.ToLower(v), strings.ToLower(value)) {
+			values = append(values, key+"="+v)
+		}
+	}
+	return values, cobra.ShellCompDirectiveNoFileComp
+}
+
+// keywordNames return the keywords in use starting with prefix, compared
+// without case, followed by suffix. They are lower case unless prefix is
+// not, as sshman writes keys.
+func keywordNames(prefix, suffix string) []string {
+	var names []string
+	for _, spec := range sshconfig.Keywords(sshconfig.Version{}) {
+		switch strings.ToLower(spec.Name) {
+		case "host", "match", "include":
+			continue
+		}
+		if spec.IsDeprecated(sshconfig.Version{}) || !strings.HasPrefix(strings.ToLower(spec.Name), strings.ToLower(prefix)) {
+			continue
+		}
+		name := spec.Name
+		if prefix == strings.ToLower(prefix) {
+			name = strings.ToLower(name)
+		}
+		names = append(names, name+suffix+"\t"+spec.Type.String())
+	}
+	return names
+}
+
+// keywordValues the values spec accepts that can be listed
+func keywordValues(spec *sshconfig.KeywordSpec) []string {
+	if spec.Type == sshconfig.TypeYesNo {
+		return []string{"yes", "no"}
+	}
+	return spec.Enum
+}
@@ -0,0 +1,40 @@
+package sshman
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompletion(t *testing.T) {
+	defer func(p string) { path = p }(path)
+	path = filepath.Join(t.TempDir(), "config")
+	require.Nil(t, os.WriteFile(path, []byte("Host web\n    HostName 10.0.0.1\n    User root\nHost db *.internal\n    Port 2222\n"), 0600))
+
+	aliases, directive := completeAliases(nil, nil, "")
+	require.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+	require.Len(t, aliases, 2)
+	require.Contains(t, aliases, "web\troot@10.0.0.1:22")
+
+	aliases, _ = completeAliases(nil, []string{"web"}, "")
+	require.Len(t, aliases, 1)
+	require.Regexp(t, "^db\t", aliases[0])
+
+	keywords, _ := completeGet(nil, []string{"web"}, "proxyj")
+	require.Equal(t, []string{"proxyjump\tlist"}, keywords)
+	keywords, _ = completeGet(nil, []string{"web"}, "ProxyJ")
+	require.Equal(t, []string{"ProxyJump\tlist"}, keywords)
+
+	keywords, directive = completeConfig(nil, nil, "stricthost")
+	require.Equal(t, []string{"stricthostkeychecking=\tenum"}, keywords)
+	require.Equal(t, cobra.ShellCompDirectiveNoFileComp|cobra.ShellCompDirectiveNoSpace, directive)
+	values, _ := completeConfig(nil, nil, "stricthostkeychecking=a")
+	require.Equal(t, []string{"stricthostkeychecking=ask", "stricthostkeychecking=accept-new"}, values)
+	values, _ = completeConfig(nil, nil, "Compression=")
+	require.Equal(t, []string{"Compression=yes", "Compression=no"}, values)
+	values, _ = completeConfig(nil, nil, "hostname=")
+	require.Empty(t, values)
+}
@@ -0,0 +1,48 @@
+package sshman
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sonnt85/sshman"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the stub ssh is a shell script")
+	}
+	defer func(p string) { path = p }(path)
+	dir := t.TempDir()
+	path = filepath.Join(dir, "config")
+	require.Nil(t, os.WriteFile(path, []byte("Host web1\n    HostName 10.0.0.1\nHost web2\n    HostName 10.0.0.2\nHost db\n    HostName 10.0.0.3\n"), 0600))
+
+	// the stub records its arguments, one per line
+	out := filepath.Join(dir, "args")
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "ssh"), []byte("#!/bin/sh\nfor a in \"$@\"; do echo \"$a\"; done > "+out+"\n"), 0755))
+	t.Setenv("PATH", dir)
+
+	require.Nil(t, ConnectSSH("db", []string{"uptime", "-p"}, false, true))
+	data, err := os.ReadFile(out)
+	require.Nil(t, err)
+	require.Equal(t, []string{"-F", path, "db", "uptime", "-p"}, strings.Fields(string(data)))
+
+	require.Nil(t, os.Remove(out))
+	require.Nil(t, ConnectSSH("web2", nil, true, true))
+	_, err = os.Stat(out)
+	require.True(t, os.IsNotExist(err), "dry-run must not run ssh")
+
+	err = ConnectSSH("web", nil, false, true)
+	var ambiguous *sshman.AmbiguousError
+	require.True(t, errors.As(err, &ambiguous), "%v", err)
+	require.Len(t, ambiguous.Matches, 2)
+
+	require.Equal(t, []string{"ssh", "-F", path, "db"}, sshCommand("db", nil))
+	path = filepath.Join(sshman.GetHomeDir(), ".ssh", "config")
+	require.Equal(t, []string{"ssh", "db", "ls"}, sshCommand("db", []string{"ls"}))
+	require.Equal(t, `ssh -F '/tmp/my config' db 'echo $HOME'`, shellJoin([]string{"ssh", "-F", "/tmp/my config", "db", "echo $HOME"}))
+}
@@ -0,0 +1,195 @@
+package sshman
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/fatih/color"
+	"github.com/sonnt85/sshman"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// setKeyDir set the directory of the keys from --dir
+func setKeyDir(c *cobra.Command) {
+	sshman.KeyDir, _ = c.Flags().GetString("dir")
+}
+
+func KeyListSSH(unused bool) error {
+	inventory, err := sshman.ListKeys(path)
+	if err != nil {
+		return err
+	}
+	if unused {
+		keys := []*sshman.KeyInfo{}
+		for _, k := range inventory.Keys {
+			if k.Unused() {
+				keys = append(keys, k)
+			}
+		}
+		inventory.Keys = keys
+	}
+	if OutputFormat != "" {
+		return encode(os.Stdout, inventory)
+	}
+	printKeys(inventory)
+	return nil
+}
+
+func keyListCmd(c *cobra.Command, args []string) error {
+	if err := setEncodeOutput(c); err != nil {
+		return err
+	}
+	setKeyDir(c)
+	unused, _ := c.Flags().GetBool("unused")
+	c.SilenceUsage = true
+	return KeyListSSH(unused)
+}
+
+func KeyNewSSH(alias string, o sshman.KeyOption, pathShowFlag bool) error {
+	key, err := sshman.NewKey(path, alias, o)
+	if err != nil {
+		if OutputFormat == "" {
+			fmt.Print(sshman.ErrorFlag)
+		}
+		return err
+	}
+	if OutputFormat != "" {
+		return encode(os.Stdout, key)
+	}
+	fmt.Printf("%s %s key %s written to %s\n\n", sshman.SuccessFlag, key.Type, key.Fingerprint, shortPath(key.Path))
+	printHost(pathShowFlag, key.Host)
+	return nil
+}
+
+func keyNewCmd(c *cobra.Command, args []string) error {
+	if err := setEncodeOutput(c); err != nil {
+		return err
+	}
+	setKeyDir(c)
+	o := sshman.KeyOption{}
+	o.Type, _ = c.Flags().GetString("type")
+	o.Bits, _ = c.Flags().GetInt("bits")
+	o.Comment, _ = c.Flags().GetString("comment")
+	pathShowFlag, _ := c.Flags().GetBool("pathshow")
+	c.SilenceUsage = true
+	return KeyNewSSH(args[0], o, pathShowFlag)
+}
+
+// askPassword read a password from the terminal without echo, after prompt
+func askPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("a password is needed and stdin is not a terminal")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(password), err
+}
+
+func KeyDeploySSH(alias string, o sshman.DeployOption) error {
+	r, err := sshman.DeployKey(path, alias, o)
+	if OutputFormat != "" && r != nil {
+		if err := encode(os.Stdout, r); err != nil {
+			return err
+		}
+	} else if r != nil {
+		state := "added to"
+		if !r.Added {
+			state = "already in"
+		}
+		if r.Added || r.Verified {
+			fmt.Printf("%s %s %s %s authorized_keys of %s (%s)\n", sshman.SuccessFlag, shortPath(r.Key), r.Fingerprint, state, color.MagentaString(r.Alias), r.Address)
+		}
+		if r.Verified {
+			fmt.Printf("%s the key alone logs in\n", sshman.SuccessFlag)
+		}
+	}
+	return err
+}
+
+func keyDeployCmd(c *cobra.Command, args []string) error {
+	if err := setEncodeOutput(c); err != nil {
+		return err
+	}
+	o := sshman.DeployOption{Password: askPassword}
+	o.Key, _ = c.Flags().GetString("key")
+	o.Timeout, _ = c.Flags().GetDuration("timeout")
+	o.AcceptNew, _ = c.Flags().GetBool("accept-new")
+	c.SilenceUsage = true
+	return KeyDeploySSH(args[0], o)
+}
+
+func KeyRotateSSH(aliases []string, o sshman.RotateOption) error {
+	results, err := sshman.RotateKeys(path, aliases, o)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	if OutputFormat != "" {
+		if err := encode(os.Stdout, results); err != nil {
+			return err
+		}
+	} else {
+		printRotate(results)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d alias(es) failed the rotation, run sshman key rotate --resume to continue", failed, len(results))
+	}
+	return nil
+}
+
+func keyRotateCmd(c *cobra.Command, args []string) error {
+	if err := setEncodeOutput(c); err != nil {
+		return err
+	}
+	setKeyDir(c)
+	match, _ := c.Flags().GetString("match")
+	resume, _ := c.Flags().GetBool("resume")
+	var aliases []string
+	add := func(names ...string) {
+		for _, alias := range names {
+			if !slices.Contains(aliases, alias) {
+				aliases = append(aliases, alias)
+			}
+		}
+	}
+	add(args...)
+	if match != "" {
+		matched, err := sshman.MatchAliases(path, match)
+		if err != nil {
+			return err
+		}
+		add(matched...)
+	}
+	if resume {
+		pending, err := sshman.PendingRotations(path)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 && len(aliases) == 0 {
+			return errors.New("no rotation to resume")
+		}
+		add(pending...)
+	}
+	if len(aliases) == 0 {
+		return errors.New("give the aliases, --match or --resume")
+	}
+	o := sshman.RotateOption{Password: askPassword}
+	o.Key.Type, _ = c.Flags().GetString("type")
+	o.Key.Bits, _ = c.Flags().GetInt("bits")
+	o.Key.Comment, _ = c.Flags().GetString("comment")
+	o.KeepOld, _ = c.Flags().GetBool("keep-old")
+	o.AcceptNew, _ = c.Flags().GetBool("accept-new")
+	o.Timeout, _ = c.Flags().GetDuration("timeout")
+	c.SilenceUsage = true
+	return KeyRotateSSH(aliases, o)
+}
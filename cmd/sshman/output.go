@@ -0,0 +1,159 @@
+package sshman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sonnt85/sshman"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of the --output flag
+const (
+	OutputJSON     = "json"
+	OutputYAML     = "yaml"
+	OutputTSV      = "tsv"
+	OutputTemplate = "template"
+)
+
+var outputFormats = []string{OutputJSON, OutputYAML, OutputTSV, OutputTemplate}
+
+// addOutputFlags add the --output and --format flags to cmd
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", "", "print machine readable output: "+strings.Join(outputFormats, "|"))
+	cmd.Flags().String("format", "", `text/template executed for every alias, e.g. '{{.Alias}}\t{{get . "hostname"}}', implies --output template`)
+}
+
+// setOutput set OutputFormat and FormatTemplate from the flags of c
+func setOutput(c *cobra.Command) error {
+	OutputFormat, _ = c.Flags().GetString("output")
+	FormatTemplate, _ = c.Flags().GetString("format")
+	if OutputFormat == "" && FormatTemplate != "" {
+		OutputFormat = OutputTemplate
+	}
+	switch OutputFormat {
+	case "", OutputJSON, OutputYAML, OutputTSV:
+		if FormatTemplate != "" {
+			return fmt.Errorf("--format can not be used with --output %s", OutputFormat)
+		}
+	case OutputTemplate:
+		if FormatTemplate == "" {
+			return fmt.Errorf("--output template needs a --format template")
+		}
+		// fail before a command changes the config
+		if _, err := sshman.ParseTemplate(FormatTemplate); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown output %q, expect one of %s", OutputFormat, strings.Join(outputFormats, ", "))
+	}
+	return nil
+}
+
+// setEncodeOutput set OutputFormat from the --output flag of c, for the
+// commands that print json or yaml only
+func setEncodeOutput(c *cobra.Command) error {
+	OutputFormat, _ = c.Flags().GetString("output")
+	if OutputFormat != "" && OutputFormat != OutputJSON && OutputFormat != OutputYAML {
+		return fmt.Errorf("unknown output %q, expect json or yaml", OutputFormat)
+	}
+	return nil
+}
+
+// writeHosts write hosts in OutputFormat to w. json and yaml print a list,
+// or a single object if single is set.
+func writeHosts(w io.Writer, hosts []*sshman.HostConfig, single bool) error {
+	switch OutputFormat {
+	case OutputTSV:
+		fmt.Fprintln(w, strings.Join([]string{"alias", "user", "host", "port", "paths", "own"}, "\t"))
+		for _, host := range hosts {
+			out := host.Output()
+			var own []string
+			for _, k := range sshman.SortKeys(out.Own) {
+				for _, v := range out.Own[k] {
+					own = append(own, k+"="+v)
+				}
+			}
+			fmt.Fprintln(w, tsvLine(out.Alias, out.Connection.User, out.Connection.Host, out.Connection.Port,
+				strings.Join(out.Paths, ","), strings.Join(own, ",")))
+		}
+		return nil
+	case OutputTemplate:
+		return executeTemplate(w, hosts)
+	}
+	outs := make([]*sshman.HostOutput, 0, len(hosts))
+	for _, host := range hosts {
+		outs = append(outs, host.Output())
+	}
+	if single && len(outs) == 1 {
+		return encode(w, outs[0])
+	}
+	return encode(w, outs)
+}
+
+// writeOption write the option key of host in OutputFormat to w
+func writeOption(w io.Writer, host *sshman.HostConfig, key string) error {
+	out := host.Option(key)
+	if out == nil {
+		return fmt.Errorf("Missing key: %s", key)
+	}
+	switch OutputFormat {
+	case OutputTSV:
+		fmt.Fprintln(w, strings.Join([]string{"alias", "key", "value", "source"}, "\t"))
+		for i, v := range out.Values {
+			fmt.Fprintln(w, tsvLine(out.Alias, out.Key, v, out.Sources[i]))
+		}
+		return nil
+	case OutputTemplate:
+		return executeTemplate(w, []*sshman.HostConfig{host})
+	}
+	return encode(w, out)
+}
+
+func encode(w io.Writer, v interface{}) error {
+	if OutputFormat == OutputYAML {
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// executeTemplate execute FormatTemplate for every host, each output ends
+// with a newline
+func executeTemplate(w io.Writer, hosts []*sshman.HostConfig) error {
+	tmpl, err := sshman.ParseTemplate(FormatTemplate)
+	if err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, host); err != nil {
+			return err
+		}
+		line := buf.String()
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tsvLine join fields with tabs, tabs and newlines in them become spaces
+func tsvLine(fields ...string) string {
+	for i, f := range fields {
+		fields[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(f)
+	}
+	return strings.Join(fields, "\t")
+}
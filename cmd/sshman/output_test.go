@@ -0,0 +1,79 @@
+package sshman
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sonnt85/sshman"
+	"github.com/sonnt85/sshman/sshconfig"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func outputHost() *sshman.HostConfig {
+	return &sshman.HostConfig{
+		Alias:          "web",
+		Path:           "/etc/ssh/config",
+		PathMap:        map[string][]*sshconfig.Host{"/etc/ssh/config": nil},
+		OwnConfig:      map[string]string{"hostname": "10.0.0.1", "identityfile": "~/.ssh/id web"},
+		ImplicitConfig: map[string]string{"user": "root", "port": "22"},
+	}
+}
+
+func TestWriteHosts(t *testing.T) {
+	defer func() { OutputFormat, FormatTemplate = "", "" }()
+	hosts := []*sshman.HostConfig{outputHost()}
+
+	var buf bytes.Buffer
+	OutputFormat = OutputJSON
+	require.Nil(t, writeHosts(&buf, hosts, false))
+	var outs []*sshman.HostOutput
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &outs))
+	require.Equal(t, 1, len(outs))
+	require.Equal(t, "10.0.0.1", outs[0].Connection.Host)
+	require.Equal(t, []string{"root"}, outs[0].Inherited["user"])
+
+	buf.Reset()
+	OutputFormat = OutputYAML
+	require.Nil(t, writeHosts(&buf, hosts, true))
+	require.True(t, strings.HasPrefix(buf.String(), "alias: web\npaths:\n  - /etc/ssh/config\n"), buf.String())
+
+	buf.Reset()
+	OutputFormat = OutputTSV
+	require.Nil(t, writeHosts(&buf, hosts, false))
+	require.Equal(t, "alias\tuser\thost\tport\tpaths\town\n"+
+		"web\troot\t10.0.0.1\t22\t/etc/ssh/config\thostname=10.0.0.1,identityfile=~/.ssh/id web\n", buf.String())
+
+	buf.Reset()
+	OutputFormat, FormatTemplate = OutputTemplate, "{{.Alias}} {{.ConnectionStr}}"
+	require.Nil(t, writeHosts(&buf, hosts, false))
+	require.Equal(t, "web root@10.0.0.1:22\n", buf.String())
+
+	buf.Reset()
+	FormatTemplate = `{{.Alias}}\t{{own . "HostName"}}\t{{inherited . "user"}}\t{{join (files .) ","}}\t{{connection .}}`
+	require.Nil(t, writeHosts(&buf, hosts, false))
+	require.Equal(t, "web\t10.0.0.1\troot\t/etc/ssh/config\troot@10.0.0.1:22\n", buf.String())
+}
+
+func TestSetOutput(t *testing.T) {
+	defer func() { OutputFormat, FormatTemplate = "", "" }()
+	for _, args := range [][]string{
+		{"--output", "xml"},
+		{"--output", "template"},
+		{"--format", "{{.Alias"},
+		{"--output", "json", "--format", "{{.Alias}}"},
+	} {
+		cmd := &cobra.Command{Use: "list"}
+		addOutputFlags(cmd)
+		require.Nil(t, cmd.Flags().Parse(args))
+		require.NotNil(t, setOutput(cmd), args)
+	}
+
+	cmd := &cobra.Command{Use: "list"}
+	addOutputFlags(cmd)
+	require.Nil(t, cmd.Flags().Parse([]string{"--format", "{{.Alias}}"}))
+	require.Nil(t, setOutput(cmd))
+	require.Equal(t, OutputTemplate, OutputFormat)
+}
@@ -0,0 +1,414 @@
+package sshman
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sonnt85/sshman"
+	"golang.org/x/term"
+)
+
+// What the picker was left with
+const (
+	pickQuit = iota
+	pickConnect
+	pickEdit
+)
+
+const pickHelp = "enter connect  ^y copy alias  ^e edit  ^d delete  esc quit"
+
+// picker a fuzzy finder over the aliases, drawn on a terminal of width x
+// height
+type picker struct {
+	hosts []*sshman.HostConfig
+	// total the number of aliases without wildcards
+	total   int
+	query   []rune
+	matches []*sshman.HostConfig
+	cursor  int
+	offset  int
+	// status replaces the help line until the next key
+	status string
+	// confirm waiting for y to delete the selected alias
+	confirm bool
+	out     io.Writer
+	size    func() (width, height int)
+}
+
+func newPicker(hosts []*sshman.HostConfig, out io.Writer, size func() (int, int)) *picker {
+	p := &picker{out: out, size: size}
+	p.setHosts(hosts)
+	return p
+}
+
+// setHosts replace the hosts, matched against the current query
+func (p *picker) setHosts(hosts []*sshman.HostConfig) {
+	p.hosts = hosts
+	p.total = 0
+	for _, host := range hosts {
+		if !strings.ContainsAny(host.Alias, "*?!") {
+			p.total++
+		}
+	}
+	p.filter()
+}
+
+// filter match the hosts against the query, every alias in order when it
+// is empty
+func (p *picker) filter() {
+	p.matches = p.matches[:0]
+	if len(p.query) == 0 {
+		for _, host := range p.hosts {
+			if !strings.ContainsAny(host.Alias, "*?!") {
+				p.matches = append(p.matches, host)
+			}
+		}
+		sort.Slice(p.matches, func(i, j int) bool { return p.matches[i].Alias < p.matches[j].Alias })
+	} else {
+		for _, m := range sshman.Rank(p.hosts, string(p.query)) {
+			p.matches = append(p.matches, m.Host)
+		}
+	}
+	p.cursor, p.offset = 0, 0
+}
+
+// selected the alias under the cursor, nil if nothing matches
+func (p *picker) selected() *sshman.HostConfig {
+	if p.cursor < len(p.matches) {
+		return p.matches[p.cursor]
+	}
+	return nil
+}
+
+func (p *picker) move(delta int) {
+	p.cursor += delta
+	if p.cursor >= len(p.matches) {
+		p.cursor = len(p.matches) - 1
+	}
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+}
+
+// run read keys from in until an alias is picked or the picker is left
+func (p *picker) run(in io.Reader) (int, *sshman.HostConfig, error) {
+	buf := make([]byte, 256)
+	for {
+		p.render()
+		n, err := in.Read(buf)
+		if n == 0 && err != nil {
+			if err == io.EOF {
+				return pickQuit, nil, nil
+			}
+			return pickQuit, nil, err
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			action, err := p.handle(key)
+			if err != nil {
+				p.status = err.Error()
+			}
+			if action != -1 {
+				return action, p.selected(), nil
+			}
+		}
+	}
+}
+
+// handle act on a key, it returns the action that leaves the picker or -1
+func (p *picker) handle(key string) (int, error) {
+	p.status = ""
+	if p.confirm {
+		p.confirm = false
+		if key != "y" && key != "Y" {
+			return -1, nil
+		}
+		return -1, p.delete()
+	}
+	switch key {
+	case "enter":
+		if p.selected() != nil {
+			return pickConnect, nil
+		}
+	case "esc", "ctrl-c", "ctrl-g":
+		return pickQuit, nil
+	case "up", "ctrl-p", "ctrl-k":
+		p.move(-1)
+	case "down", "ctrl-n", "ctrl-j", "tab":
+		p.move(1)
+	case "pgup":
+		p.move(-p.rows())
+	case "pgdown":
+		p.move(p.rows())
+	case "backspace":
+		if len(p.query) > 0 {
+			p.query = p.query[:len(p.query)-1]
+			p.filter()
+		}
+	case "ctrl-u":
+		p.query = p.query[:0]
+		p.filter()
+	case "ctrl-w":
+		q := strings.TrimRight(string(p.query), " ")
+		p.query = []rune(q[:strings.LastIndex(q, " ")+1])
+		p.filter()
+	case "ctrl-y":
+		if host := p.selected(); host != nil {
+			// OSC 52 asks the terminal to set the clipboard
+			fmt.Fprintf(p.out, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(host.Alias)))
+			p.status = "copied " + host.Alias
+		}
+	case "ctrl-e":
+		if p.selected() != nil {
+			return pickEdit, nil
+		}
+	case "ctrl-d":
+		if host := p.selected(); host != nil {
+			p.confirm = true
+			p.status = fmt.Sprintf("delete %s? [y/N]", host.Alias)
+		}
+	default:
+		if utf8.RuneCountInString(key) == 1 {
+			p.query = append(p.query, []rune(key)...)
+			p.filter()
+		}
+	}
+	return -1, nil
+}
+
+// delete remove the selected alias from the config files
+func (p *picker) delete() error {
+	alias := p.selected().Alias
+	if _, err := sshman.Delete(path, alias); err != nil {
+		return err
+	}
+	hosts, err := sshman.List(path, sshman.ListOption{})
+	if err != nil {
+		return err
+	}
+	cursor := p.cursor
+	p.setHosts(hosts)
+	p.move(cursor)
+	p.status = "deleted " + alias
+	return nil
+}
+
+// rows the number of aliases shown at once
+func (p *picker) rows() int {
+	_, height := p.size()
+	return max(height-3, 1)
+}
+
+// render draw the query line, the aliases next to the preview of the
+// selected one, and the help line
+func (p *picker) render() {
+	width, _ := p.size()
+	rows := p.rows()
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.cursor >= p.offset+rows {
+		p.offset = p.cursor - rows + 1
+	}
+	left := max(min(width*2/5, 48), 16)
+	var preview []string
+	if host := p.selected(); host != nil {
+		var buf bytes.Buffer
+		fprintHost(&buf, true, host)
+		preview = strings.Split(strings.ReplaceAll(buf.String(), "\t", "  "), "\n")
+		if comment := host.Comment(); comment != "" {
+			// under the alias line
+			preview = append(preview[:1], append([]string{"    # " + comment}, preview[1:]...)...)
+		}
+	}
+
+	var b strings.Builder
+	// every line is cleared to its end instead of clearing the screen,
+	// which flickers
+	b.WriteString("\x1b[H")
+	fmt.Fprintf(&b, "> %s\x1b[7m \x1b[0m\x1b[K\r\n", clip(string(p.query), width-3))
+	fmt.Fprintf(&b, "\x1b[2m  %d/%d\x1b[0m\x1b[K\r\n", len(p.matches), p.total)
+	for i := 0; i < rows; i++ {
+		entry := ""
+		if n := p.offset + i; n < len(p.matches) {
+			host := p.matches[n]
+			_, hostname, _ := host.Connection()
+			entry = clip(fmt.Sprintf("  %-*s %s", 16, host.Alias, hostname), left)
+			if n == p.cursor {
+				entry = "\x1b[7m" + entry + "\x1b[0m"
+			}
+		} else {
+			entry = strings.Repeat(" ", left)
+		}
+		b.WriteString(entry)
+		if i < len(preview) {
+			b.WriteString(" │ " + clip(preview[i], width-left-3))
+		} else {
+			b.WriteString(" │")
+		}
+		b.WriteString("\x1b[K\r\n")
+	}
+	status := p.status
+	if status == "" {
+		status = pickHelp
+	}
+	fmt.Fprintf(&b, "\x1b[2m%s\x1b[0m\x1b[J", clip(status, width))
+	io.WriteString(p.out, b.String())
+}
+
+// clip cut s to width visible characters and pad it with spaces, escape
+// sequences are kept and take no room
+func clip(s string, width int) string {
+	var b strings.Builder
+	visible := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' {
+			// CSI sequences end with a letter
+			j := i + 1
+			for j < len(s) && !(s[j] >= 'A' && s[j] <= 'Z' || s[j] >= 'a' && s[j] <= 'z') {
+				j++
+			}
+			j = min(j+1, len(s))
+			b.WriteString(s[i:j])
+			i = j
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if visible < width {
+			b.WriteRune(r)
+			visible++
+		}
+		i += size
+	}
+	if visible < width {
+		b.WriteString(strings.Repeat(" ", width-visible))
+	}
+	return b.String() + "\x1b[0m"
+}
+
+// parseKeys split what the terminal sent into keys: a character, or the
+// name of a control or escape sequence such as up or ctrl-d
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		switch c := b[0]; {
+		case c == 0x1b:
+			key, n := parseEscape(b)
+			keys = append(keys, key)
+			b = b[n:]
+			continue
+		case c == '\r':
+			keys = append(keys, "enter")
+		case c == '\t':
+			keys = append(keys, "tab")
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, "backspace")
+		case c < 0x20:
+			keys = append(keys, "ctrl-"+string(rune('a'+c-1)))
+		default:
+			r, size := utf8.DecodeRune(b)
+			if r != utf8.RuneError {
+				keys = append(keys, string(r))
+			}
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+// escapeKeys the escape sequences of the keys the picker uses
+var escapeKeys = map[string]string{
+	"[A": "up", "[B": "down", "OA": "up", "OB": "down",
+	"[5~": "pgup", "[6~": "pgdown",
+}
+
+// parseEscape parse the escape sequence at the start of b, a lone ESC is
+// the esc key
+func parseEscape(b []byte) (string, int) {
+	if len(b) < 2 || (b[1] != '[' && b[1] != 'O') {
+		return "esc", 1
+	}
+	n := 2
+	for n < len(b) && (b[n] < 0x40 || b[n] > 0x7e) {
+		n++
+	}
+	n = min(n+1, len(b))
+	if key, ok := escapeKeys[string(b[1:n])]; ok {
+		return key, n
+	}
+	return "", n
+}
+
+// pickHost open the picker on the terminal, it returns the action and the
+// alias it was left with
+func pickHost() (int, *sshman.HostConfig, error) {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return pickQuit, nil, errors.New("pick needs a terminal, use list or connect <query> instead")
+	}
+	hosts, err := sshman.List(path, sshman.ListOption{})
+	if err != nil {
+		return pickQuit, nil, err
+	}
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return pickQuit, nil, err
+	}
+	defer term.Restore(in, state)
+	// alternate screen, cursor hidden
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+	size := func() (int, int) {
+		width, height, err := term.GetSize(out)
+		if err != nil {
+			return 80, 24
+		}
+		return width, height
+	}
+	return newPicker(hosts, os.Stdout, size).run(os.Stdin)
+}
+
+// editHost open the file declaring host in $VISUAL or $EDITOR, at its Host
+// line
+func editHost(host *sshman.HostConfig) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := strings.Fields(editor)
+	if hosts := host.PathMap[host.Path]; len(hosts) > 0 && hosts[0] != nil {
+		args = append(args, "+"+strconv.Itoa(hosts[0].Pos().Line))
+	}
+	cmd := exec.Command(args[0], append(args[1:], host.Path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// PickSSH let the user pick an alias in a fuzzy finder, then connect to it
+// with the remote command, or edit it
+func PickSSH(command []string, dryRun bool) error {
+	action, host, err := pickHost()
+	if err != nil {
+		return err
+	}
+	switch action {
+	case pickConnect:
+		return ConnectSSH(host.Alias, command, dryRun)
+	case pickEdit:
+		return editHost(host)
+	}
+	return nil
+}
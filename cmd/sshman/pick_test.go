@@ -0,0 +1,101 @@
+package sshman
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sonnt85/sshman"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeys(t *testing.T) {
+	require.Equal(t, []string{"w", "é", "up", "down", "enter", "backspace", "ctrl-d", "esc", "pgdown"},
+		parseKeys([]byte("wé\x1b[A\x1bOB\r\x7f\x04\x1b\x1b[6~")))
+}
+
+// keyReader returns one chunk per Read, as a terminal sends a key at a time
+type keyReader []string
+
+func (r *keyReader) Read(b []byte) (int, error) {
+	if len(*r) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, (*r)[0])
+	*r = (*r)[1:]
+	return n, nil
+}
+
+func TestPicker(t *testing.T) {
+	defer func(p string) { path = p }(path)
+	path = filepath.Join(t.TempDir(), "config")
+	require.Nil(t, os.WriteFile(path, []byte(`Host web1 # frontend
+    HostName 10.0.0.1
+Host web2
+    HostName 10.0.0.2
+    User deploy
+Host db
+    HostName 10.0.0.3
+`), 0600))
+	hosts, err := sshman.List(path, sshman.ListOption{})
+	require.Nil(t, err)
+	size := func() (int, int) { return 80, 10 }
+	run := func(keys ...string) (int, *sshman.HostConfig, string) {
+		var out bytes.Buffer
+		in := keyReader(keys)
+		action, host, err := newPicker(hosts, &out, size).run(&in)
+		require.Nil(t, err)
+		return action, host, out.String()
+	}
+
+	action, host, out := run("web\x1b[B\r")
+	require.Equal(t, pickConnect, action)
+	require.Equal(t, "web2", host.Alias)
+	require.Contains(t, out, "10.0.0.2")
+
+	// users and comments are matched too
+	_, host, _ = run("deploy\r")
+	require.Equal(t, "web2", host.Alias)
+	_, host, out = run("frontend", "\r")
+	require.Equal(t, "web1", host.Alias)
+	require.Contains(t, out, "# frontend")
+	require.Contains(t, out, "1/3")
+
+	action, _, _ = run("zzz", "\r", "\x1b")
+	require.Equal(t, pickQuit, action)
+
+	action, host, _ = run("db\x05")
+	require.Equal(t, pickEdit, action)
+	require.Equal(t, "db", host.Alias)
+
+	_, _, out = run("db", "\x19", "\x1b")
+	require.Contains(t, out, "\x1b]52;c;ZGI=\a")
+	require.Contains(t, out, "copied db")
+
+	// delete asks first
+	_, _, out = run("db", "\x04", "n", "\x04", "y", "\x1b")
+	require.Contains(t, out, "delete db? [y/N]")
+	require.Contains(t, out, "deleted db")
+	data, err := os.ReadFile(path)
+	require.Nil(t, err)
+	require.NotContains(t, string(data), "Host db")
+
+	// the query is kept after a delete
+	hosts, err = sshman.List(path, sshman.ListOption{})
+	require.Nil(t, err)
+	p := newPicker(hosts, io.Discard, size)
+	in := keyReader{"web", "\x04", "y"}
+	_, _, err = p.run(&in)
+	require.Nil(t, err)
+	require.Equal(t, "web", string(p.query))
+	require.Len(t, p.matches, 1)
+	require.Equal(t, "web2", p.selected().Alias)
+	require.Equal(t, 1, p.total)
+}
+
+func TestClip(t *testing.T) {
+	require.Equal(t, "ab\x1b[0m", clip("abc", 2))
+	require.Equal(t, "\x1b[35mab\x1b[0m  \x1b[0m", clip("\x1b[35mab\x1b[0m", 4))
+}
@@ -2,11 +2,15 @@ package sshman
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/sonnt85/sshman"
+	"github.com/sonnt85/sshman/sshconfig"
 )
 
 //func printErrorWithHelp(c *cli.Context, err error) error {
@@ -44,40 +48,376 @@ func printHosts(showPath bool, hosts []*sshman.HostConfig) {
 }
 
 func printHost(showPath bool, host *sshman.HostConfig) {
-
 	if host == nil || DisablePrintHost {
 		return
 	}
-	fmt.Printf("\t%s", color.MagentaString(host.Alias))
+	fprintHost(os.Stdout, showPath, host)
+}
+
+// fprintHost writes host to w the way printHost prints it
+func fprintHost(w io.Writer, showPath bool, host *sshman.HostConfig) {
+	fmt.Fprintf(w, "\t%s", color.MagentaString(host.Alias))
 	if showPath && len(host.PathMap) > 0 {
 
 		var paths []string
 		for path := range host.PathMap {
-			if homeDir := sshman.GetHomeDir(); strings.HasPrefix(path, homeDir) {
-				path = strings.Replace(path, homeDir, "~", 1)
-			}
-			paths = append(paths, path)
+			paths = append(paths, shortPath(path))
 		}
 		sort.Strings(paths)
-		fmt.Printf("(%s)", strings.Join(paths, " "))
+		fmt.Fprintf(w, "(%s)", strings.Join(paths, " "))
 	}
-	if connect := host.ConnectionStr(); connect != "" {
-		fmt.Printf(" -> %s", connect)
+	if host.Display() {
+		fmt.Fprintf(w, " -> %s", connectionStr(host))
+	}
+	fmt.Fprintln(w)
+	if ShowSource {
+		for _, setting := range host.Settings {
+			line := fmt.Sprintf("\t    %s = %s %s\n", setting.Key, setting.Value, explain(setting))
+			if host.IsOwn(setting) {
+				fmt.Fprint(w, color.CyanString("%s", line))
+			} else {
+				fmt.Fprint(w, line)
+			}
+		}
+		fprintCerts(w, host)
+		fmt.Fprintln(w)
+		return
 	}
-	fmt.Println()
 	for _, key := range sshman.SortKeys(host.OwnConfig) {
 		value := host.OwnConfig[key]
-		if value == "" {
+		if value == "" || (host.Display() && connectionKeys[key]) {
 			continue
 		}
-		color.Cyan("\t    %s = %s\n", key, value)
+		fmt.Fprint(w, color.CyanString("\t    %s = %s\n", key, value))
 	}
 	for _, key := range sshman.SortKeys(host.ImplicitConfig) {
 		value := host.ImplicitConfig[key]
-		if value == "" {
+		if value == "" || (host.Display() && connectionKeys[key]) {
 			continue
 		}
-		fmt.Printf("\t    %s = %s\n", key, value)
+		fmt.Fprintf(w, "\t    %s = %s\n", key, value)
+	}
+	fprintCerts(w, host)
+	fmt.Fprintln(w)
+}
+
+// fprintCerts writes the certificates of host with their principals and
+// expiry, the expired and expiring ones highlighted
+func fprintCerts(w io.Writer, host *sshman.HostConfig) {
+	for _, c := range host.Certificates() {
+		fmt.Fprintf(w, "\t    certificate %s: %s\n", shortPath(c.Path), certSummary(c))
+	}
+}
+
+// certSummary return the principals and expiry of c
+func certSummary(c *sshman.CertInfo) string {
+	if c.Error != "" {
+		return color.RedString(c.Error)
+	}
+	const layout = "2006-01-02 15:04"
+	var expiry string
+	switch c.State {
+	case sshman.CertExpired:
+		expiry = color.RedString("expired %s", c.ValidBefore.Format(layout))
+	case sshman.CertExpiring:
+		expiry = color.YellowString("expires %s, in %s", c.ValidBefore.Format(layout), time.Until(c.ValidBefore).Round(time.Minute))
+	case sshman.CertNotYetValid:
+		expiry = color.YellowString("valid from %s", c.ValidAfter.Format(layout))
+	default:
+		expiry = "never expires"
+		if !c.ValidBefore.IsZero() {
+			expiry = "expires " + c.ValidBefore.Format(layout)
+		}
+	}
+	return fmt.Sprintf("principals %s, %s", orDash(strings.Join(c.Principals, ",")), expiry)
+}
+
+// connectionKeys the options shown in the connection string
+var connectionKeys = map[string]bool{"user": true, "hostname": true, "port": true}
+
+// connectionStr return the connection string of host, own values in green
+func connectionStr(host *sshman.HostConfig) string {
+	user, hostname, port := host.Connection()
+	paint := func(key, value string) string {
+		if _, ok := host.OwnConfig[key]; ok {
+			return color.GreenString(value)
+		}
+		return value
+	}
+	return fmt.Sprintf("%s%s%s%s%s", paint("user", user), color.GreenString("@"),
+		paint("hostname", hostname), color.GreenString(":"), paint("port", port))
+}
+
+// shortPath replace the home directory prefix of path with ~
+func shortPath(path string) string {
+	if homeDir := sshman.GetHomeDir(); homeDir != "" && strings.HasPrefix(path, homeDir) {
+		path = strings.Replace(path, homeDir, "~", 1)
+	}
+	return path
+}
+
+// explain return where the setting comes from, like "(from ~/.ssh/config:14)"
+func explain(setting *sshconfig.Setting) string {
+	origin := sshman.Origin(setting)
+	if setting.Source.File == "" {
+		return fmt.Sprintf("(%s)", origin)
+	}
+	return fmt.Sprintf("(from %s)", shortPath(origin))
+}
+
+// printPlan prints the changes of a sync plan the way terraform does: + for
+// additions, ~ for changes, - for removals and ! for conflicts.
+func printPlan(plan *sshman.Plan) {
+	if plan.Include {
+		fmt.Printf("  %s Include %s in %s\n", color.GreenString("+"), shortPath(plan.Target), shortPath(path))
+	}
+	for _, item := range plan.Items {
+		switch item.Action {
+		case sshman.PlanAdd:
+			fmt.Printf("  %s %s\n", color.GreenString("+"), color.MagentaString(item.Alias))
+		case sshman.PlanChange:
+			fmt.Printf("  %s %s\n", color.YellowString("~"), color.MagentaString(item.Alias))
+		case sshman.PlanRemove:
+			fmt.Printf("  %s %s\n", color.RedString("-"), color.MagentaString(item.Alias))
+		case sshman.PlanConflict:
+			fmt.Printf("  %s %s declared in %s\n", color.RedString("!"), color.MagentaString(item.Alias), strings.Join(shortPaths(item.Paths), " "))
+		}
+		for _, c := range item.Changes {
+			switch {
+			case c.Old == "":
+				fmt.Printf("      %s %s = %s\n", color.GreenString("+"), c.Key, c.New)
+			case c.New == "":
+				fmt.Printf("      %s %s = %s\n", color.RedString("-"), c.Key, c.Old)
+			default:
+				fmt.Printf("      %s %s = %s -> %s\n", color.YellowString("~"), c.Key, c.Old, c.New)
+			}
+		}
+	}
+	fmt.Printf("\nPlan: %d to add, %d to change, %d to remove.\n",
+		plan.Count(sshman.PlanAdd), plan.Count(sshman.PlanChange), plan.Count(sshman.PlanRemove))
+}
+
+// printImport prints what an import does with every record, with the file
+// the aliases go to
+func printImport(results []*sshman.ImportResult) {
+	for _, result := range results {
+		ao := result.Option
+		switch result.Action {
+		case sshman.ImportSkip:
+			fmt.Printf("  %s %s exists in %s, skipped\n", color.YellowString("="), color.MagentaString(result.Record), strings.Join(shortPaths(result.Paths), " "))
+			continue
+		case sshman.ImportOverwrite:
+			fmt.Printf("  %s %s", color.YellowString("~"), color.MagentaString(ao.Alias))
+		case sshman.ImportRename:
+			fmt.Printf("  %s %s (renamed from %s)", color.GreenString("+"), color.MagentaString(ao.Alias), result.Record)
+		default:
+			fmt.Printf("  %s %s", color.GreenString("+"), color.MagentaString(ao.Alias))
+		}
+		if ao.Path != "" && ao.Path != path {
+			fmt.Printf("(%s)", shortPath(ao.Path))
+		}
+		if hostname := ao.Config["hostname"]; hostname != "" {
+			fmt.Printf(" -> %s", hostname)
+		}
+		if ao.Comment != "" {
+			fmt.Printf(" # %s", ao.Comment)
+		}
+		fmt.Println()
+		for _, warning := range ao.Warnings {
+			fmt.Printf("    %s %s\n", color.YellowString("warning:"), warning)
+		}
+	}
+}
+
+func shortPaths(paths []string) []string {
+	var short []string
+	for _, p := range paths {
+		short = append(short, shortPath(p))
+	}
+	return short
+}
+
+// printDiagnostics prints the diagnostics of lint as file:line: severity: message
+func printDiagnostics(diagnostics []*sshman.Diagnostic) {
+	for _, d := range diagnostics {
+		severity := color.YellowString(d.Severity)
+		if d.Severity == sshman.SeverityError {
+			severity = color.RedString(d.Severity)
+		}
+		fmt.Printf("%s:%d: %s: %s [%s]\n", d.File, d.Line, severity, d.Message, d.Check)
+	}
+}
+
+// printKeywords prints a line for every keyword: name, kind of value, allowed
+// values and default, and the releases that added or deprecated it
+func printKeywords(keywords []*sshconfig.KeywordSpec, version sshconfig.Version) {
+	for _, k := range keywords {
+		values := k.Type.String()
+		if len(k.Enum) > 0 {
+			if k.Type == sshconfig.TypeEnum {
+				values = strings.Join(k.Enum, "|")
+			} else {
+				values += "|" + strings.Join(k.Enum, "|")
+			}
+		}
+		if k.Multi {
+			values += ", repeatable"
+		}
+		var notes []string
+		if k.Default != "" {
+			notes = append(notes, "default "+k.Default)
+		}
+		if !k.Since.IsZero() {
+			notes = append(notes, "since "+k.Since.String())
+		}
+		line := fmt.Sprintf("%-34s %-36s %s", k.Name, values, strings.Join(notes, ", "))
+		if k.IsDeprecated(version) {
+			line = color.YellowString("%-34s deprecated since %s: %s", k.Name, k.Deprecated, k.Note)
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
+
+// printMatches prints the aliases matching a query, best first
+func printMatches(matches []*sshman.AliasMatch) {
+	for _, m := range matches {
+		fmt.Printf("  %s -> %s\n", color.MagentaString(m.Host.Alias), connectionStr(m.Host))
+	}
+}
+
+// shellJoin join args into a command line the shell splits back into args
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`!*?[]{}()<>|&;#~") {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// printCheck prints a line for every alias checked: address, reachability,
+// banner, host key algorithm and authentication, and the error if any
+func printCheck(results []*sshman.CheckResult) {
+	fmt.Printf("%-20s %-28s %-9s %-28s %-20s %-7s %s\n", "ALIAS", "ADDRESS", "TCP", "BANNER", "HOST KEY", "AUTH", "TIME")
+	for _, r := range results {
+		address := r.Address
+		if len(r.Via) > 0 {
+			address += " via " + strings.Join(r.Via, ",")
+		}
+		tcp := color.RedString("%-9s", "no")
+		if r.Reachable {
+			tcp = color.GreenString("%-9s", "yes")
+		}
+		auth := color.RedString("%-7s", r.Auth)
+		switch r.Auth {
+		case sshman.AuthOK:
+			auth = color.GreenString("%-7s", r.Auth)
+		case "":
+			auth = fmt.Sprintf("%-7s", "-")
+		}
+		fmt.Printf("%-20s %-28s %s %-28s %-20s %s %dms\n", r.Alias, address, tcp, orDash(r.Banner), orDash(r.HostKey), auth, r.Duration)
+		if r.Error != "" {
+			fmt.Printf("  %s %s\n", sshman.ErrorFlag, r.Error)
+		}
+	}
+}
+
+// orDash return s, or - if it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// printKnownHosts prints a line for every known_hosts entry: file:line, hosts,
+// key type and fingerprint, and the aliases it is for
+func printKnownHosts(known []*sshman.KnownHost) {
+	for _, kh := range known {
+		hosts := strings.Join(kh.Hosts, ",")
+		if kh.Hashed {
+			hosts = color.New(color.Faint).Sprint("(hashed)")
+		}
+		if kh.Marker != "" {
+			hosts = kh.Marker + " " + hosts
+		}
+		location := shortPath(kh.File)
+		if kh.Line > 0 {
+			location = fmt.Sprintf("%s:%d", location, kh.Line)
+		}
+		aliases := color.YellowString("no alias")
+		if len(kh.Aliases) > 0 {
+			aliases = color.MagentaString(strings.Join(kh.Aliases, ","))
+		}
+		fmt.Printf("%s %s %s %s -> %s\n", location, hosts, kh.KeyType, kh.Fingerprint, aliases)
+	}
+}
+
+// printScan prints the host keys a scan added, found already known and found
+// changed
+func printScan(r *sshman.ScanResult, replace bool) {
+	fmt.Printf("%s %s\n", color.MagentaString(r.Alias), r.Address)
+	for _, kh := range r.Known {
+		fmt.Printf("  known    %s %s\n", kh.KeyType, kh.Fingerprint)
+	}
+	for _, kh := range r.Added {
+		fmt.Printf("  %s %s %s\n", color.GreenString("added  "), kh.KeyType, kh.Fingerprint)
+	}
+	for _, kh := range r.Changed {
+		state := color.RedString("changed")
+		if replace {
+			state = color.YellowString("replaced")
+		}
+		fmt.Printf("  %s %s %s, %s:%d\n", state, kh.KeyType, kh.Fingerprint, shortPath(kh.File), kh.Line)
+	}
+}
+
+// printKeys prints a line for every key: path, type and bits, fingerprint,
+// comment and the aliases using it, then the key files the aliases miss
+func printKeys(inventory *sshman.KeyInventory) {
+	for _, k := range inventory.Keys {
+		if k.Error != "" && k.Type == "" {
+			fmt.Printf("%s %s\n", shortPath(k.Path), color.RedString(k.Error))
+			continue
+		}
+		line := fmt.Sprintf("%s %s %d %s %s", shortPath(k.Path), k.Type, k.Bits, k.Fingerprint, orDash(k.Comment))
+		if k.Encrypted {
+			line += " " + color.CyanString("(encrypted)")
+		}
+		users := color.YellowString("unused")
+		if len(k.Aliases) > 0 {
+			users = color.MagentaString(strings.Join(k.Aliases, ","))
+		} else if len(k.References) > 0 {
+			users = "no alias, " + strings.Join(shortPaths(k.References), ",")
+		}
+		fmt.Printf("%s -> %s\n", line, users)
+		if k.Error != "" {
+			fmt.Printf("  %s\n", color.RedString(k.Error))
+		}
+	}
+	if len(inventory.Missing) > 0 {
+		fmt.Println()
+	}
+	for _, m := range inventory.Missing {
+		fmt.Printf("%s%s %s %s does not exist (%s)\n", sshman.ErrorFlag, color.MagentaString(m.Alias), m.Keyword, m.Value, shortPath(m.Source))
+	}
+}
+
+// printRotate prints the new key of every alias rotated, or the step its
+// rotation stopped after
+func printRotate(results []*sshman.RotateResult) {
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Printf("%s%s %s, stopped after step %s\n", sshman.ErrorFlag, color.MagentaString(r.Alias), color.RedString(r.Error), orDash(r.Step))
+			continue
+		}
+		fmt.Printf("%s%s %s %s replaces %s in %s\n", sshman.SuccessFlag, color.MagentaString(r.Alias), shortPath(r.NewKey), r.Fingerprint, shortPath(r.OldKey), shortPath(r.File))
+		if r.Removed {
+			fmt.Printf("  the old key is removed from authorized_keys of %s\n", r.Address)
+		} else if r.Kept != "" {
+			fmt.Printf("  the old key is kept in authorized_keys of %s: %s\n", r.Address, r.Kept)
+		}
 	}
-	fmt.Println()
 }
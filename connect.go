@@ -0,0 +1,120 @@
+package sshman
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Scores of an AliasMatch, the better the match the higher
+const (
+	ScoreExact       = 100
+	ScoreExactFold   = 90
+	ScorePrefix      = 80
+	ScoreSubstring   = 60
+	ScoreValue       = 40
+	ScoreSubsequence = 20
+)
+
+// AliasMatch an alias matching a query
+type AliasMatch struct {
+	Host *HostConfig
+	// Score how well the alias matches, one of the Score constants
+	Score int
+}
+
+// AmbiguousError the query of FindAlias matches several aliases equally well
+type AmbiguousError struct {
+	Query string
+	// Matches every match, best first
+	Matches []*AliasMatch
+}
+
+func (e *AmbiguousError) Error() string {
+	var aliases []string
+	for _, m := range e.Matches {
+		aliases = append(aliases, m.Host.Alias)
+	}
+	return fmt.Sprintf("%q matches several aliases: %s", e.Query, strings.Join(aliases, ", "))
+}
+
+// Rank return the hosts matching query, best first. An alias equal to query
+// ranks first, then the aliases starting with it, containing it, whose
+// values or comment match it as `sshman list` does, and those holding its
+// characters in order. Aliases with wildcards are skipped.
+func Rank(hosts []*HostConfig, query string) []*AliasMatch {
+	var matches []*AliasMatch
+	for _, host := range hosts {
+		if strings.ContainsAny(host.Alias, "*?!") {
+			continue
+		}
+		if score := matchScore(host, query); score > 0 {
+			matches = append(matches, &AliasMatch{Host: host, Score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if len(a.Host.Alias) != len(b.Host.Alias) {
+			return len(a.Host.Alias) < len(b.Host.Alias)
+		}
+		return a.Host.Alias < b.Host.Alias
+	})
+	return matches
+}
+
+func matchScore(host *HostConfig, query string) int {
+	alias, lquery := strings.ToLower(host.Alias), strings.ToLower(query)
+	switch {
+	case host.Alias == query:
+		return ScoreExact
+	case alias == lquery:
+		return ScoreExactFold
+	case strings.HasPrefix(alias, lquery):
+		return ScorePrefix
+	case strings.Contains(alias, lquery):
+		return ScoreSubstring
+	}
+	values := []string{host.Alias, host.Comment()}
+	for _, v := range host.OwnConfig {
+		values = append(values, v)
+	}
+	if Query(values, []string{query}, true) {
+		return ScoreValue
+	}
+	if subsequence(alias, lquery) {
+		return ScoreSubsequence
+	}
+	return 0
+}
+
+// subsequence whether the characters of sub appear in s in order
+func subsequence(s, sub string) bool {
+	for _, c := range sub {
+		i := strings.IndexRune(s, c)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(c)):]
+	}
+	return true
+}
+
+// FindAlias return the alias of the config file p matching query best. It
+// returns an *AmbiguousError if several aliases match equally well.
+func FindAlias(p, query string) (*HostConfig, error) {
+	hosts, err := List(p, ListOption{})
+	if err != nil {
+		return nil, err
+	}
+	matches := Rank(hosts, query)
+	switch {
+	case len(matches) == 0:
+		return nil, fmt.Errorf("no alias matches %q", query)
+	case len(matches) > 1 && matches[1].Score == matches[0].Score:
+		return nil, &AmbiguousError{Query: query, Matches: matches}
+	}
+	return matches[0].Host, nil
+}
@@ -0,0 +1,49 @@
+package sshman
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRank(t *testing.T) {
+	hosts := []*HostConfig{
+		{Alias: "web-prod", OwnConfig: map[string]string{"hostname": "10.0.0.1"}},
+		{Alias: "web", OwnConfig: map[string]string{"hostname": "10.0.0.2"}},
+		{Alias: "prod-db", OwnConfig: map[string]string{"hostname": "db.example.com"}},
+		{Alias: "*.example.com", OwnConfig: map[string]string{"user": "web"}},
+	}
+	aliases := func(matches []*AliasMatch) []string {
+		var list []string
+		for _, m := range matches {
+			list = append(list, m.Host.Alias)
+		}
+		return list
+	}
+	require.Equal(t, []string{"web", "web-prod"}, aliases(Rank(hosts, "web")))
+	require.Equal(t, ScoreExact, Rank(hosts, "web")[0].Score)
+	require.Equal(t, []string{"prod-db", "web-prod"}, aliases(Rank(hosts, "prod")))
+	require.Equal(t, []string{"prod-db"}, aliases(Rank(hosts, "example")))
+	require.Equal(t, []string{"web-prod"}, aliases(Rank(hosts, "wpd")))
+	require.Empty(t, Rank(hosts, "mail"))
+}
+
+func TestFindAlias(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config")
+	require.Nil(t, os.WriteFile(p, []byte("Host web1\n    HostName 10.0.0.1\nHost web2\n    HostName 10.0.0.2\nHost db\n    HostName 10.0.0.3\n"), 0600))
+
+	host, err := FindAlias(p, "DB")
+	require.Nil(t, err)
+	require.Equal(t, "db", host.Alias)
+
+	_, err = FindAlias(p, "web")
+	var ambiguous *AmbiguousError
+	require.True(t, errors.As(err, &ambiguous))
+	require.Equal(t, `"web" matches several aliases: web1, web2`, err.Error())
+
+	_, err = FindAlias(p, "mail")
+	require.NotNil(t, err)
+}
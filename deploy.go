@@ -0,0 +1,275 @@
+package sshman
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// DeployOption options for DeployKey
+type DeployOption struct {
+	// Key the public key to deploy, or its private key next to it, the first
+	// IdentityFile of the alias with a public key if empty
+	Key string
+	// Password ask for the password of the alias with prompt when the server
+	// does not accept a key yet, no password is tried if nil
+	Password func(prompt string) (string, error)
+	// Timeout the time the deployment may take, 30s if not set
+	Timeout time.Duration
+	// AcceptNew trust and record the host keys that are not in known_hosts
+	// yet, changed keys are refused still
+	AcceptNew bool
+}
+
+// DeployResult what DeployKey did for an alias
+type DeployResult struct {
+	Alias   string `json:"alias" yaml:"alias"`
+	Address string `json:"address" yaml:"address"`
+	// Key the public key file deployed
+	Key         string `json:"key" yaml:"key"`
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+	// Added false if authorized_keys had the key already
+	Added bool `json:"added" yaml:"added"`
+	// Verified whether the server accepts the key alone afterwards
+	Verified bool `json:"verified" yaml:"verified"`
+}
+
+// publicKeyFile read the public key of key, a public key file or a private
+// key with its public key next to it, and return the path of the public key
+// and its authorized_keys line
+func publicKeyFile(key string) (string, ssh.PublicKey, string, error) {
+	pubPath := key
+	if !strings.HasSuffix(key, ".pub") {
+		pubPath = key + ".pub"
+	}
+	data, err := os.ReadFile(pubPath)
+	if err != nil {
+		return "", nil, "", err
+	}
+	pub, comment, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("%s: %v", pubPath, err)
+	}
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if comment != "" {
+		line += " " + comment
+	}
+	return pubPath, pub, line, nil
+}
+
+// deployKeyPath the key DeployKey deploys for host by default: its first
+// IdentityFile with a public key
+func deployKeyPath(host *HostConfig) (string, error) {
+	for _, file := range host.Values("identityfile") {
+		if path, ok := identityPath(file); ok {
+			if _, err := os.Stat(path + ".pub"); err == nil {
+				return path, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("alias[%s] has no IdentityFile with a public key, give the key or run key new first", host.Alias)
+}
+
+// keySigner the signer of the private key of pub, read from privPath or
+// taken from the agent when the file is encrypted or missing
+func keySigner(privPath string, pub ssh.PublicKey) (ssh.Signer, func(), error) {
+	if data, err := os.ReadFile(privPath); err == nil {
+		signer, err := ssh.ParsePrivateKey(data)
+		if err == nil {
+			if !bytes.Equal(signer.PublicKey().Marshal(), pub.Marshal()) {
+				return nil, nil, fmt.Errorf("%s does not match its public key", privPath)
+			}
+			return signer, func() {}, nil
+		}
+		var missing *ssh.PassphraseMissingError
+		if !errors.As(err, &missing) {
+			return nil, nil, fmt.Errorf("%s: %v", privPath, err)
+		}
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			signers, _ := agent.NewClient(conn).Signers()
+			for _, signer := range signers {
+				if bytes.Equal(signer.PublicKey().Marshal(), pub.Marshal()) {
+					return signer, func() { conn.Close() }, nil
+				}
+			}
+			conn.Close()
+		}
+	}
+	return nil, nil, fmt.Errorf("the private key of %s is encrypted or missing and not in the agent", privPath)
+}
+
+// passwordMethods the password and keyboard-interactive auth methods asking
+// for the password of user with ask
+func passwordMethods(user, addr string, ask func(prompt string) (string, error)) []ssh.AuthMethod {
+	if ask == nil {
+		return nil
+	}
+	password := ssh.PasswordCallback(func() (string, error) {
+		return ask(fmt.Sprintf("%s@%s's password: ", user, addr))
+	})
+	interactive := ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i, q := range questions {
+			var err error
+			if answers[i], err = ask(q); err != nil {
+				return nil, err
+			}
+		}
+		return answers, nil
+	})
+	return []ssh.AuthMethod{ssh.RetryableAuthMethod(password, 3), interactive}
+}
+
+// runRemote run command on the server of client and return its output
+func runRemote(client *ssh.Client, command string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	var stdout, stderr bytes.Buffer
+	session.Stdout, session.Stderr = &stdout, &stderr
+	if err := session.Run(command); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%v: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// shellQuote quote s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// keyBlob the type and base64 fields of the authorized_keys line of key, the
+// part that stays the same whatever the options and comment
+func keyBlob(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+// authorizeScript the shell script appending line to ~/.ssh/authorized_keys
+// unless it has the key already, as ssh-copy-id does. It prints added or
+// present.
+func authorizeScript(key ssh.PublicKey, line string) string {
+	return `cd || exit 1
+umask 077
+mkdir -p .ssh && chmod 700 .ssh && touch .ssh/authorized_keys && chmod 600 .ssh/authorized_keys || exit 1
+if grep -qF ` + shellQuote(keyBlob(key)) + ` .ssh/authorized_keys; then echo present; exit 0; fi
+[ -z "$(tail -c 1 .ssh/authorized_keys)" ] || echo >> .ssh/authorized_keys
+echo ` + shellQuote(line) + ` >> .ssh/authorized_keys && echo added`
+}
+
+// aliasConn a connection to an alias through its ProxyJump hosts
+type aliasConn struct {
+	host   *HostConfig
+	target *endpoint
+	jump   *ssh.Client
+	close  func()
+}
+
+// dialAlias reach the ProxyJump hosts of an alias of the config file p, the
+// alias itself is dialed by login. The host keys are checked as check says.
+func dialAlias(ctx context.Context, p, alias string, check hostKeyCheck) (*aliasConn, error) {
+	host, err := Resolve(p, alias)
+	if err != nil {
+		return nil, err
+	}
+	if pc := host.Get("proxycommand"); pc != "" && !strings.EqualFold(pc, "none") {
+		return nil, fmt.Errorf("%s: ProxyCommand is not supported", alias)
+	}
+	jump, _, closeJumps, err := jumpClient(ctx, p, host, check)
+	if err != nil {
+		return nil, err
+	}
+	target := newEndpoint(host)
+	target.hostKeys = target.hostKeyCallback(check)
+	return &aliasConn{host: host, target: target, jump: jump, close: closeJumps}, nil
+}
+
+// login connect and authenticate to the alias, with the keys ssh offers and
+// the extra methods, or with auth only if it is not nil
+func (ac *aliasConn) login(ctx context.Context, auth []ssh.AuthMethod, extra ...ssh.AuthMethod) (*ssh.Client, error) {
+	conn, err := dial(ctx, ac.jump, ac.target.addr)
+	if err != nil {
+		return nil, err
+	}
+	var hs *handshakeResult
+	if auth != nil {
+		hs = handshakeAuth(ctx, conn, ac.target, auth)
+	} else {
+		hs = handshake(ctx, conn, ac.target, extra...)
+	}
+	return hs.client, hs.err
+}
+
+// DeployKey add a public key to ~/.ssh/authorized_keys of an alias of the
+// config file p, as ssh-copy-id does, logging in with the keys of the alias
+// or its password. The key is added once, with the mode sshd expects, then
+// the login with this key alone is checked. The host keys of the alias and
+// its jump hosts must be in known_hosts, see o.AcceptNew.
+func DeployKey(p, alias string, o DeployOption) (*DeployResult, error) {
+	if o.Timeout <= 0 {
+		o.Timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), o.Timeout)
+	defer cancel()
+	check := hostKeysVerified
+	if o.AcceptNew {
+		check = hostKeysAcceptNew
+	}
+	ac, err := dialAlias(ctx, p, alias, check)
+	if err != nil {
+		return nil, err
+	}
+	defer ac.close()
+
+	key := o.Key
+	if key == "" {
+		if key, err = deployKeyPath(ac.host); err != nil {
+			return nil, err
+		}
+	} else if path, ok := identityPath(key); ok {
+		key = path
+	}
+	pubPath, pub, line, err := publicKeyFile(key)
+	if err != nil {
+		return nil, err
+	}
+	r := &DeployResult{Alias: alias, Address: ac.target.addr, Key: pubPath, Fingerprint: ssh.FingerprintSHA256(pub)}
+
+	client, err := ac.login(ctx, nil, passwordMethods(ac.target.user, ac.target.addr, o.Password)...)
+	if err != nil {
+		return r, err
+	}
+	out, err := runRemote(client, authorizeScript(pub, line))
+	client.Close()
+	if err != nil {
+		return r, fmt.Errorf("cannot update authorized_keys: %v", err)
+	}
+	r.Added = out == "added"
+
+	signer, closeSigner, err := keySigner(strings.TrimSuffix(pubPath, ".pub"), pub)
+	if err != nil {
+		return r, fmt.Errorf("the key is deployed but the login with it cannot be checked: %v", err)
+	}
+	defer closeSigner()
+	client, err = ac.login(ctx, []ssh.AuthMethod{ssh.PublicKeys(signer)})
+	if err != nil {
+		return r, fmt.Errorf("the key is deployed but the server does not accept it: %v", err)
+	}
+	client.Close()
+	r.Verified = true
+	return r, nil
+}
@@ -0,0 +1,120 @@
+package sshman
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sonnt85/sshman/knownhosts"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestDeployKey(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	dir := t.TempDir()
+	home := filepath.Join(dir, "home")
+	require.Nil(t, os.MkdirAll(filepath.Join(home, ".ssh"), 0755))
+	// an authorized_keys without a final newline
+	other := writeTestKey(t, filepath.Join(dir, "other"))
+	existing := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(other.PublicKey())))
+	require.Nil(t, os.WriteFile(filepath.Join(home, ".ssh", "authorized_keys"), []byte(existing), 0644))
+	key := writeTestKey(t, filepath.Join(dir, "id_web"))
+
+	server := newTestServer(t, testServerOption{Password: "secret", Home: home})
+	jump := testServer(t, key.PublicKey())
+	host, port, _ := net.SplitHostPort(server)
+	jumpHost, jumpPort, _ := net.SplitHostPort(jump)
+	p := filepath.Join(dir, "config")
+	config := fmt.Sprintf(`Host web
+    HostName %[1]s
+    Port %[2]s
+    User deploy
+    IdentityFile %[3]s/id_web
+    ProxyJump bastion
+Host bastion
+    HostName %[4]s
+    Port %[5]s
+    IdentityFile %[3]s/id_web
+Host *
+    UserKnownHostsFile %[3]s/known_hosts
+`, host, port, dir, jumpHost, jumpPort)
+	require.Nil(t, os.WriteFile(p, []byte(config), 0600))
+
+	asked := 0
+	password := func(prompt string) (string, error) {
+		asked++
+		require.Equal(t, "deploy@"+server+"'s password: ", prompt)
+		return "secret", nil
+	}
+
+	// the host keys are not known yet
+	kh := filepath.Join(dir, "known_hosts")
+	_, err := DeployKey(p, "web", DeployOption{Password: password})
+	require.ErrorContains(t, err, "the host key of "+knownhosts.Address(jumpHost, jumpPort)+" is unknown")
+	require.Equal(t, 0, asked)
+	_, err = os.Stat(kh)
+	require.True(t, os.IsNotExist(err))
+
+	// no password, no key accepted yet, the host keys are recorded
+	_, err = DeployKey(p, "web", DeployOption{AcceptNew: true})
+	require.NotNil(t, err)
+	known, err := ListKnownHosts(p)
+	require.Nil(t, err)
+	require.Len(t, known, 2)
+
+	r, err := DeployKey(p, "web", DeployOption{Password: password})
+	require.Nil(t, err)
+	require.Equal(t, 1, asked)
+	require.True(t, r.Added)
+	require.True(t, r.Verified)
+	require.Equal(t, filepath.Join(dir, "id_web.pub"), r.Key)
+	require.Equal(t, ssh.FingerprintSHA256(key.PublicKey()), r.Fingerprint)
+
+	data, err := os.ReadFile(filepath.Join(home, ".ssh", "authorized_keys"))
+	require.Nil(t, err)
+	require.Equal(t, existing+"\n"+strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key.PublicKey())))+"\n", string(data))
+	for name, mode := range map[string]os.FileMode{".ssh": 0700, ".ssh/authorized_keys": 0600} {
+		info, err := os.Stat(filepath.Join(home, name))
+		require.Nil(t, err)
+		require.Equal(t, mode, info.Mode().Perm(), name)
+	}
+
+	// the key logs in now, it is not added twice
+	r, err = DeployKey(p, "web", DeployOption{Password: password})
+	require.Nil(t, err)
+	require.Equal(t, 1, asked)
+	require.False(t, r.Added)
+	require.True(t, r.Verified)
+	again, err := os.ReadFile(filepath.Join(home, ".ssh", "authorized_keys"))
+	require.Nil(t, err)
+	require.Equal(t, data, again)
+
+	// a key given by its public key file
+	second := writeTestKey(t, filepath.Join(dir, "second"))
+	r, err = DeployKey(p, "web", DeployOption{Key: filepath.Join(dir, "second.pub")})
+	require.Nil(t, err)
+	require.True(t, r.Added)
+	require.True(t, r.Verified)
+	require.Equal(t, ssh.FingerprintSHA256(second.PublicKey()), r.Fingerprint)
+
+	_, err = DeployKey(p, "web", DeployOption{Key: filepath.Join(dir, "missing")})
+	require.True(t, errors.Is(err, os.ErrNotExist))
+
+	// a changed host key is refused, unless StrictHostKeyChecking is no
+	f, err := knownhosts.Load(kh)
+	require.Nil(t, err)
+	f.Remove(knownhosts.Address(host, port))
+	f.Add(knownhosts.Address(host, port), other.PublicKey(), false)
+	require.Nil(t, os.WriteFile(kh, f.Bytes(), 0600))
+	_, err = DeployKey(p, "web", DeployOption{AcceptNew: true})
+	require.ErrorContains(t, err, "the host key of "+knownhosts.Address(host, port)+" has changed")
+	require.Nil(t, os.WriteFile(p, []byte("Host web\n    StrictHostKeyChecking no\n"+config), 0600))
+	r, err = DeployKey(p, "web", DeployOption{})
+	require.Nil(t, err)
+	require.True(t, r.Verified)
+}
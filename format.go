@@ -0,0 +1,75 @@
+package sshman
+
+import (
+	"os"
+	"sort"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// FormatOption options for Format
+type FormatOption struct {
+	// Check only report the files that are not formatted, without writing them
+	Check bool
+}
+
+// FormatResult a config file whose formatting changed
+type FormatResult struct {
+	// Path file path
+	Path string
+	// Original contents before formatting
+	Original string
+	// Formatted contents after formatting
+	Formatted string
+}
+
+// Diff return the unified diff between the original and formatted contents
+func (fr *FormatResult) Diff() string {
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(fr.Original),
+		B:        difflib.SplitLines(fr.Formatted),
+		FromFile: fr.Path,
+		ToFile:   fr.Path,
+		Context:  3,
+	})
+	return diff
+}
+
+// Format canonicalise the formatting of the config file p and of every file
+// in its Include tree, see sshconfig.Config.Format. It returns the files
+// whose formatting changed, or would change when fo.Check is set.
+func Format(p string, fo FormatOption) ([]*FormatResult, error) {
+	if !fo.Check {
+		unlock, err := lockConfig(p)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	configMap, _, err := parseConfig(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*FormatResult
+	for fp, cfg := range configMap {
+		original, err := os.ReadFile(fp)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		fr := &FormatResult{Path: fp, Original: string(original), Formatted: cfg.Format()}
+		if fr.Original == fr.Formatted {
+			continue
+		}
+		if !fo.Check {
+			if err := writeFile(fp, fr.Formatted, backupDir(p)); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, fr)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+	return results, nil
+}
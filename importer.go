@@ -0,0 +1,233 @@
+package sshman
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Importer turn the records of a file exported by another tool into the
+// aliases to add
+type Importer interface {
+	// Name the format name, as given to sshman import --from
+	Name() string
+	// Import read the records of r. The groups of a record, if the format
+	// has any, are kept in a "groups: a,b" Comment.
+	Import(r io.Reader) ([]*AddOption, error)
+}
+
+var importers = map[string]Importer{}
+
+// RegisterImporter make im available to GetImporter under its name
+func RegisterImporter(im Importer) {
+	importers[im.Name()] = im
+}
+
+// GetImporter return the importer of the format name
+func GetImporter(name string) (Importer, error) {
+	im, ok := importers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown import format %q, expect one of %s", name, strings.Join(Importers(), ", "))
+	}
+	return im, nil
+}
+
+// Importers return the names of the registered importers, sorted
+func Importers() []string {
+	var names []string
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Group modes of ImportOption
+const (
+	// GroupsComment record the groups of a host in a "groups: a,b" comment on
+	// its Host line
+	GroupsComment = "comment"
+	// GroupsFiles add the hosts of a group to a conf.d/<group> file next to
+	// the config file, included from it
+	GroupsFiles = "files"
+)
+
+// Conflict policies of ImportOption, for records whose alias exists already
+const (
+	// ConflictFail fail the import, nothing is added
+	ConflictFail = "fail"
+	// ConflictSkip keep the existing alias and drop the record
+	ConflictSkip = "skip"
+	// ConflictRename add the record as <alias>-2, <alias>-3, ...
+	ConflictRename = "rename"
+	// ConflictOverwrite delete the existing alias and add the record
+	ConflictOverwrite = "overwrite"
+)
+
+// Actions of an ImportResult
+const (
+	ImportAdd       = "add"
+	ImportSkip      = "skip"
+	ImportRename    = "rename"
+	ImportOverwrite = "overwrite"
+)
+
+// ImportOption options for Import
+type ImportOption struct {
+	// Groups how groups are kept, GroupsComment if empty
+	Groups string
+	// OnConflict what to do with a record whose alias exists, ConflictFail if
+	// empty
+	OnConflict string
+	// DryRun only report what would be done
+	DryRun bool
+}
+
+// ImportResult what Import did with a record
+type ImportResult struct {
+	// Action ImportAdd, or how a conflict was solved
+	Action string
+	// Record alias of the record
+	Record string
+	// Alias the record is added as, differs from Record when renamed
+	Alias string
+	// Paths files declaring the existing alias on a conflict
+	Paths []string
+	// Option the alias added
+	Option *AddOption
+}
+
+// Import add the records im reads from r to the config file p, in one
+// transaction. Aliases colliding with existing ones, or with earlier
+// records, are handled according to o.OnConflict.
+func Import(p string, im Importer, r io.Reader, o ImportOption) ([]*ImportResult, error) {
+	if o.Groups == "" {
+		o.Groups = GroupsComment
+	}
+	if o.Groups != GroupsComment && o.Groups != GroupsFiles {
+		return nil, fmt.Errorf("unknown groups mode %q, expect %s or %s", o.Groups, GroupsComment, GroupsFiles)
+	}
+	if o.OnConflict == "" {
+		o.OnConflict = ConflictFail
+	}
+	switch o.OnConflict {
+	case ConflictFail, ConflictSkip, ConflictRename, ConflictOverwrite:
+	default:
+		return nil, fmt.Errorf("unknown conflict policy %q, expect %s, %s, %s or %s",
+			o.OnConflict, ConflictFail, ConflictSkip, ConflictRename, ConflictOverwrite)
+	}
+	options, err := im.Import(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := Begin(p)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var results []*ImportResult
+	for _, ao := range options {
+		if o.Groups == GroupsFiles {
+			if groups := commentGroups(ao.Comment); len(groups) > 0 {
+				ao.Path = filepath.Join(filepath.Dir(p), "conf.d", ansibleGroupName(groups[0]))
+				if len(groups) == 1 {
+					ao.Comment = ""
+				}
+			}
+		}
+		result := &ImportResult{Action: ImportAdd, Record: ao.Alias, Alias: ao.Alias, Option: ao}
+		if err := checkAlias(tx.aliasMap, false, ao.Alias); err != nil {
+			result.Paths = tx.aliasMap[ao.Alias].Paths()
+			switch o.OnConflict {
+			case ConflictSkip:
+				result.Action = ImportSkip
+				results = append(results, result)
+				continue
+			case ConflictRename:
+				result.Action = ImportRename
+				ao.Alias = tx.freeAlias(ao.Alias)
+				result.Alias = ao.Alias
+			case ConflictOverwrite:
+				result.Action = ImportOverwrite
+				if _, err := tx.Delete(ao.Alias); err != nil {
+					return results, err
+				}
+			default:
+				return results, err
+			}
+		}
+		if ao.Path != "" && ao.Path != p {
+			if err := tx.Include(ao.Path); err != nil {
+				return results, err
+			}
+		}
+		if _, err := tx.Add(ao); err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	if o.DryRun {
+		return results, nil
+	}
+	for _, fp := range tx.Changed() {
+		if err := os.MkdirAll(filepath.Dir(fp), 0700); err != nil {
+			return results, err
+		}
+	}
+	return results, tx.Commit()
+}
+
+// freeAlias return the first of alias-2, alias-3, ... that does not exist
+func (tx *Transaction) freeAlias(alias string) string {
+	for i := 2; ; i++ {
+		name := alias + "-" + strconv.Itoa(i)
+		if checkAlias(tx.aliasMap, false, name) == nil {
+			return name
+		}
+	}
+}
+
+// groupsComment the comment marker recording the groups of an alias
+var groupsComment = regexp.MustCompile(`^\s*groups:\s*(.*)$`)
+
+// groupsLabel return the comment recording groups, empty without groups
+func groupsLabel(groups []string) string {
+	if len(groups) == 0 {
+		return ""
+	}
+	return "groups: " + strings.Join(groups, ",")
+}
+
+// commentGroups return the groups recorded in a Host line comment
+func commentGroups(comment string) []string {
+	m := groupsComment.FindStringSubmatch(comment)
+	if m == nil {
+		return nil
+	}
+	var groups []string
+	for _, g := range strings.Split(m[1], ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// importAlias turn the name of a record into an alias, blanks become dashes
+// and pattern characters are dropped
+func importAlias(name string) string {
+	name = strings.Join(strings.Fields(name), "-")
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`*?!,#"'`, r) {
+			return -1
+		}
+		return r
+	}, name)
+}
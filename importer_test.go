@@ -0,0 +1,135 @@
+package sshman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/require"
+)
+
+const puttyReg = `Windows Registry Editor Version 5.00
+
+[HKEY_CURRENT_USER\Software\SimonTatham\PuTTY\Sessions\Default%20Settings]
+"HostName"=""
+"PortNumber"=dword:00000016
+
+[HKEY_CURRENT_USER\Software\SimonTatham\PuTTY\Sessions\web%20server]
+"HostName"="deploy@10.0.0.1"
+"PortNumber"=dword:00000016
+"Protocol"="ssh"
+"PublicKeyFile"="C:\\Users\\me\\.ssh\\web"
+"AgentFwd"=dword:00000001
+
+[HKEY_CURRENT_USER\Software\SimonTatham\PuTTY\Sessions\router]
+"HostName"="10.0.0.254"
+"Protocol"="telnet"
+
+[HKEY_CURRENT_USER\Software\SimonTatham\PuTTY\Sessions\db]
+"HostName"="10.0.0.2"
+"UserName"="admin"
+"PortNumber"=dword:000013a2
+"PublicKeyFile"="C:\\Users\\me\\.ssh\\db.PPK"
+`
+
+func TestPuttyImporter(t *testing.T) {
+	want := []*AddOption{
+		{Alias: "web-server", Config: map[string]string{
+			"hostname": "10.0.0.1", "user": "deploy", "port": "22",
+			"identityfile": `C:\Users\me\.ssh\web`, "forwardagent": "yes",
+		}},
+		// ssh cannot read PuTTY keys
+		{Alias: "db", Config: map[string]string{"hostname": "10.0.0.2", "user": "admin", "port": "5026"}, Warnings: []string{
+			`C:\Users\me\.ssh\db.PPK is a PuTTY key ssh cannot read, convert it with puttygen C:\Users\me\.ssh\db.PPK -O private-openssh and set it as IdentityFile`,
+		}},
+	}
+	options, err := puttyImporter{}.Import(strings.NewReader(puttyReg))
+	require.Nil(t, err)
+	require.Equal(t, want, options)
+
+	// regedit exports UTF-16 with a BOM
+	var buf bytes.Buffer
+	buf.Write([]byte{0xff, 0xfe})
+	for _, u := range utf16.Encode([]rune(strings.ReplaceAll(puttyReg, "\n", "\r\n"))) {
+		buf.Write([]byte{byte(u), byte(u >> 8)})
+	}
+	options, err = puttyImporter{}.Import(&buf)
+	require.Nil(t, err)
+	require.Equal(t, want, options)
+}
+
+func TestCSVImporter(t *testing.T) {
+	options, err := csvImporter{}.Import(strings.NewReader(`alias,connect,groups,IdentityFile
+# staging hosts
+web 1,deploy@10.0.0.1:2222,"web,prod",~/.ssh/web
+db,10.0.0.2,,
+`))
+	require.Nil(t, err)
+	require.Equal(t, []*AddOption{
+		{Alias: "web-1", Connect: "deploy@10.0.0.1:2222", Comment: "groups: web,prod", Config: map[string]string{"identityfile": "~/.ssh/web"}},
+		{Alias: "db", Connect: "10.0.0.2", Config: map[string]string{}},
+	}, options)
+
+	_, err = csvImporter{}.Import(strings.NewReader("hostname\n10.0.0.1\n"))
+	require.NotNil(t, err)
+	// the other columns must be keywords of a Host block
+	_, err = csvImporter{}.Import(strings.NewReader("alias,hostname,owner\nweb,10.0.0.1,ops\n"))
+	require.ErrorContains(t, err, `csv column "owner" is not an ssh keyword`)
+	_, err = csvImporter{}.Import(strings.NewReader("alias,Include\nweb,/etc/ssh/other\n"))
+	require.ErrorContains(t, err, `csv column "Include"`)
+}
+
+func TestTermiusImporter(t *testing.T) {
+	options, err := termiusImporter{}.Import(strings.NewReader(`{"hosts": [
+  {"label": "web", "address": "10.0.0.1", "group": {"label": "prod servers"},
+   "ssh_config": {"port": 2222, "identity": {"username": "deploy"}}},
+  {"address": "10.0.0.2", "port": "22", "username": "root", "group": "db"},
+  {"label": "no address"}
+]}`))
+	require.Nil(t, err)
+	require.Equal(t, []*AddOption{
+		{Alias: "web", Comment: "groups: prod_servers", Config: map[string]string{"hostname": "10.0.0.1", "port": "2222", "user": "deploy"}},
+		{Alias: "10.0.0.2", Comment: "groups: db", Config: map[string]string{"hostname": "10.0.0.2", "port": "22", "user": "root"}},
+	}, options)
+}
+
+func TestImportConflict(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "config")
+	content := "Host db\n    hostname 10.0.0.9\n"
+	require.Nil(t, os.WriteFile(main, []byte(content), 0600))
+	records := "alias,hostname\ndb,10.0.0.2\nweb,10.0.0.1\n"
+
+	_, err := Import(main, csvImporter{}, strings.NewReader(records), ImportOption{})
+	require.NotNil(t, err)
+	require.Equal(t, content, readString(t, main))
+
+	results, err := Import(main, csvImporter{}, strings.NewReader(records), ImportOption{OnConflict: ConflictSkip, DryRun: true})
+	require.Nil(t, err)
+	require.Equal(t, ImportSkip, results[0].Action)
+	require.Equal(t, []string{main}, results[0].Paths)
+	require.Equal(t, ImportAdd, results[1].Action)
+	require.Equal(t, content, readString(t, main))
+
+	results, err = Import(main, csvImporter{}, strings.NewReader(records), ImportOption{OnConflict: ConflictRename})
+	require.Nil(t, err)
+	require.Equal(t, ImportRename, results[0].Action)
+	require.Equal(t, "db-2", results[0].Alias)
+	db2, err := Resolve(main, "db-2")
+	require.Nil(t, err)
+	require.Equal(t, "10.0.0.2", db2.OwnConfig["hostname"])
+
+	results, err = Import(main, csvImporter{}, strings.NewReader("alias,hostname\ndb,10.0.0.3\n"), ImportOption{OnConflict: ConflictOverwrite})
+	require.Nil(t, err)
+	require.Equal(t, ImportOverwrite, results[0].Action)
+	db, err := Resolve(main, "db")
+	require.Nil(t, err)
+	require.Equal(t, "10.0.0.3", db.OwnConfig["hostname"])
+	require.Equal(t, 1, strings.Count(readString(t, main), "Host db\n"))
+
+	_, err = Import(main, csvImporter{}, strings.NewReader(records), ImportOption{OnConflict: "merge"})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,341 @@
+package sshman
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/sonnt85/sshman/sshconfig"
+)
+
+func init() {
+	RegisterImporter(puttyImporter{})
+	RegisterImporter(csvImporter{})
+	RegisterImporter(termiusImporter{})
+}
+
+// puttySessions the registry key holding the PuTTY sessions
+const puttySessions = `\software\simontatham\putty\sessions\`
+
+type puttyImporter struct{}
+
+func (puttyImporter) Name() string { return "putty-reg" }
+
+// Import the ssh sessions of a .reg file exported from
+// HKEY_CURRENT_USER\Software\SimonTatham\PuTTY\Sessions. Sessions of other
+// protocols, or without a host name, are skipped.
+func (puttyImporter) Import(r io.Reader) ([]*AddOption, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var options []*AddOption
+	var session map[string]string
+	var name string
+	flush := func() {
+		if session == nil {
+			return
+		}
+		if ao := puttySession(name, session); ao != nil {
+			options = append(options, ao)
+		}
+		session = nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(decodeReg(data)))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "["):
+			flush()
+			key := strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+			i := strings.Index(strings.ToLower(key), puttySessions)
+			if i < 0 || strings.HasPrefix(key, "-") {
+				continue
+			}
+			if name, err = url.PathUnescape(key[i+len(puttySessions):]); err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			session = map[string]string{}
+		case session != nil && strings.HasPrefix(line, `"`):
+			k, v, err := regValue(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			session[strings.ToLower(k)] = v
+		}
+	}
+	flush()
+	return options, scanner.Err()
+}
+
+// puttySession turn the values of a session into an alias, nil if it is not
+// an ssh session
+func puttySession(name string, values map[string]string) *AddOption {
+	if p := values["protocol"]; p != "" && p != "ssh" {
+		return nil
+	}
+	hostname := values["hostname"]
+	user := values["username"]
+	if i := strings.LastIndex(hostname, "@"); i >= 0 {
+		user, hostname = hostname[:i], hostname[i+1:]
+	}
+	if hostname == "" {
+		return nil
+	}
+	config := map[string]string{"hostname": hostname}
+	if user != "" {
+		config["user"] = user
+	}
+	if port := values["portnumber"]; port != "" && port != "0" {
+		config["port"] = port
+	}
+	var warnings []string
+	if key := values["publickeyfile"]; strings.EqualFold(filepath.Ext(key), ".ppk") {
+		warnings = append(warnings, fmt.Sprintf("%s is a PuTTY key ssh cannot read, convert it with puttygen %s -O private-openssh and set it as IdentityFile", key, key))
+	} else if key != "" {
+		config["identityfile"] = key
+	}
+	if values["agentfwd"] == "1" {
+		config["forwardagent"] = "yes"
+	}
+	if values["compression"] == "1" {
+		config["compression"] = "yes"
+	}
+	return &AddOption{Alias: importAlias(name), Config: config, Warnings: warnings}
+}
+
+// decodeReg return the text of a .reg file, regedit writes UTF-16 with a BOM
+func decodeReg(data []byte) string {
+	var order func([]byte) uint16
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		order = func(b []byte) uint16 { return uint16(b[0]) | uint16(b[1])<<8 }
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		order = func(b []byte) uint16 { return uint16(b[1]) | uint16(b[0])<<8 }
+	default:
+		return string(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	}
+	units := make([]uint16, 0, len(data)/2)
+	for i := 2; i+1 < len(data); i += 2 {
+		units = append(units, order(data[i:]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// regValue parse a "name"="string" or "name"=dword:hex line, other types
+// give an empty value
+func regValue(line string) (string, string, error) {
+	name, rest, err := regString(line)
+	if err != nil {
+		return "", "", err
+	}
+	if !strings.HasPrefix(rest, "=") {
+		return "", "", fmt.Errorf("missing = after %q", name)
+	}
+	rest = strings.TrimSpace(rest[1:])
+	switch {
+	case strings.HasPrefix(rest, `"`):
+		value, _, err := regString(rest)
+		return name, value, err
+	case strings.HasPrefix(rest, "dword:"):
+		n, err := strconv.ParseUint(rest[len("dword:"):], 16, 32)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid dword %q", rest)
+		}
+		return name, strconv.FormatUint(n, 10), nil
+	}
+	return name, "", nil
+}
+
+// regString read the quoted string s starts with, and return what follows
+func regString(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string %s", s)
+}
+
+type csvImporter struct{}
+
+func (csvImporter) Name() string { return "csv" }
+
+// Import a csv file with a header row. The alias column is required, connect
+// takes user@hostname:port, groups a comma or semicolon separated list, and
+// every other column is an ssh keyword. Empty cells are ignored, lines
+// starting with # are comments.
+func (csvImporter) Import(r io.Reader) ([]*AddOption, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	aliasColumn := -1
+	for i, h := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(h))
+		switch header[i] {
+		case "alias":
+			aliasColumn = i
+		case "connect", "groups":
+		case "host", "match", "include":
+			return nil, fmt.Errorf("csv column %q cannot be set in a Host block", h)
+		default:
+			if sshconfig.LookupKeyword(header[i]) == nil {
+				return nil, fmt.Errorf("csv column %q is not an ssh keyword", h)
+			}
+		}
+	}
+	if aliasColumn < 0 {
+		return nil, fmt.Errorf("csv header has no alias column")
+	}
+
+	var options []*AddOption
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return options, nil
+		} else if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		ao := &AddOption{Alias: importAlias(record[aliasColumn]), Config: map[string]string{}}
+		if ao.Alias == "" {
+			return nil, fmt.Errorf("line %d: empty alias", line)
+		}
+		for i, v := range record {
+			v = strings.TrimSpace(v)
+			if i == aliasColumn || v == "" {
+				continue
+			}
+			switch header[i] {
+			case "connect":
+				ao.Connect = v
+			case "groups":
+				ao.Comment = groupsLabel(strings.FieldsFunc(v, func(r rune) bool {
+					return r == ',' || r == ';' || r == ' '
+				}))
+			default:
+				ao.Config[header[i]] = v
+			}
+		}
+		options = append(options, ao)
+	}
+}
+
+type termiusImporter struct{}
+
+func (termiusImporter) Name() string { return "termius-json" }
+
+// termiusHost a host of a Termius JSON export. The port and user are read
+// from the host or from its ssh_config and identity.
+type termiusHost struct {
+	Label     string       `json:"label"`
+	Address   string       `json:"address"`
+	Port      json.Number  `json:"port"`
+	Username  string       `json:"username"`
+	Group     termiusGroup `json:"group"`
+	SSHConfig *struct {
+		Port     json.Number `json:"port"`
+		Identity *struct {
+			Username string `json:"username"`
+		} `json:"identity"`
+	} `json:"ssh_config"`
+}
+
+// termiusGroup a group, exported as its label or as an object
+type termiusGroup string
+
+func (g *termiusGroup) UnmarshalJSON(data []byte) error {
+	var label string
+	if err := json.Unmarshal(data, &label); err == nil {
+		*g = termiusGroup(label)
+		return nil
+	}
+	var group struct {
+		Label string `json:"label"`
+	}
+	if err := json.Unmarshal(data, &group); err != nil {
+		return err
+	}
+	*g = termiusGroup(group.Label)
+	return nil
+}
+
+// Import the hosts of a Termius JSON export, either a list of hosts or an
+// object with a hosts list. Hosts without an address are skipped.
+func (termiusImporter) Import(r io.Reader) ([]*AddOption, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []termiusHost
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &hosts)
+	} else {
+		var export struct {
+			Hosts []termiusHost `json:"hosts"`
+		}
+		err = json.Unmarshal(trimmed, &export)
+		hosts = export.Hosts
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var options []*AddOption
+	for _, h := range hosts {
+		if h.Address == "" {
+			continue
+		}
+		alias := h.Label
+		if alias == "" {
+			alias = h.Address
+		}
+		config := map[string]string{"hostname": h.Address}
+		port, user := h.Port.String(), h.Username
+		if h.SSHConfig != nil {
+			if port == "" {
+				port = h.SSHConfig.Port.String()
+			}
+			if user == "" && h.SSHConfig.Identity != nil {
+				user = h.SSHConfig.Identity.Username
+			}
+		}
+		if port != "" {
+			config["port"] = port
+		}
+		if user != "" {
+			config["user"] = user
+		}
+		ao := &AddOption{Alias: importAlias(alias), Config: config}
+		if h.Group != "" {
+			ao.Comment = groupsLabel([]string{ansibleGroupName(string(h.Group))})
+		}
+		options = append(options, ao)
+	}
+	return options, nil
+}
@@ -0,0 +1,304 @@
+package sshman
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sonnt85/sshman/sshconfig"
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyInfo a key found in the key directory
+type KeyInfo struct {
+	// Path the private key, or the public key when there is no private key
+	Path string `json:"path" yaml:"path"`
+	// Public the public key or certificate file, empty if none
+	Public      string `json:"public,omitempty" yaml:"public,omitempty"`
+	Type        string `json:"type" yaml:"type"`
+	Bits        int    `json:"bits" yaml:"bits"`
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+	Comment     string `json:"comment" yaml:"comment"`
+	// Encrypted whether the private key is protected by a passphrase
+	Encrypted bool `json:"encrypted" yaml:"encrypted"`
+	// Aliases the aliases ssh uses the key for, as IdentityFile,
+	// CertificateFile or default identity when they set no IdentityFile
+	Aliases []string `json:"aliases" yaml:"aliases"`
+	// References the IdentityFile and CertificateFile lines naming the key,
+	// as file:line
+	References []string `json:"references" yaml:"references"`
+	// Error why the key cannot be read, the other fields may be empty
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Unused whether no alias and no line of the config files use the key
+func (k *KeyInfo) Unused() bool {
+	return len(k.Aliases) == 0 && len(k.References) == 0
+}
+
+// MissingKey an IdentityFile or CertificateFile of an alias that does not
+// exist
+type MissingKey struct {
+	Alias string `json:"alias" yaml:"alias"`
+	// Keyword IdentityFile or CertificateFile
+	Keyword string `json:"keyword" yaml:"keyword"`
+	// Value the value as written in the config file
+	Value string `json:"value" yaml:"value"`
+	Path  string `json:"path" yaml:"path"`
+	// Source where the value is set, as file:line
+	Source string `json:"source" yaml:"source"`
+}
+
+// KeyInventory the keys of the key directory and the key files the aliases
+// miss
+type KeyInventory struct {
+	Dir     string        `json:"dir" yaml:"dir"`
+	Keys    []*KeyInfo    `json:"keys" yaml:"keys"`
+	Missing []*MissingKey `json:"missing" yaml:"missing"`
+}
+
+// keyFileKeywords the keywords naming key files
+var keyFileKeywords = map[string]string{
+	"identityfile":    "IdentityFile",
+	"certificatefile": "CertificateFile",
+}
+
+// ListKeys scan KeyDir for private keys, public keys and certificates, and
+// tell which aliases of the config file p and its Include files use them.
+// The IdentityFile and CertificateFile of the aliases that do not exist are
+// reported as missing.
+func ListKeys(p string) (*KeyInventory, error) {
+	configMap, aliasMap, err := parseConfig(p)
+	if err != nil {
+		return nil, err
+	}
+	dir := keyDir()
+	keys, err := scanKeys(dir)
+	if err != nil {
+		return nil, err
+	}
+	inventory := &KeyInventory{Dir: dir, Keys: keys, Missing: []*MissingKey{}}
+
+	// byPath the key of every file, a certificate is used by the
+	// IdentityFile of its key too as ssh loads it
+	byPath := map[string]*KeyInfo{}
+	for _, k := range keys {
+		byPath[k.Path] = k
+		if k.Public != "" {
+			byPath[k.Public] = k
+		}
+	}
+	lookup := func(keyword, path string) []*KeyInfo {
+		var found []*KeyInfo
+		candidates := []string{path}
+		if keyword == "identityfile" {
+			candidates = append(candidates, path+"-cert.pub")
+		}
+		for _, c := range candidates {
+			if k, ok := byPath[filepath.Clean(c)]; ok {
+				found = append(found, k)
+			}
+		}
+		return found
+	}
+
+	fps := make([]string, 0, len(configMap))
+	for fp := range configMap {
+		fps = append(fps, fp)
+	}
+	sort.Strings(fps)
+	for _, fp := range fps {
+		for _, host := range configMap[fp].Hosts {
+			for _, node := range host.Nodes {
+				kv, ok := node.(*sshconfig.KV)
+				if !ok {
+					continue
+				}
+				keyword := strings.ToLower(kv.Key)
+				if _, ok := keyFileKeywords[keyword]; !ok {
+					continue
+				}
+				path, ok := identityPath(strings.Join(kv.Args(), " "))
+				if !ok {
+					continue
+				}
+				ref := fmt.Sprintf("%s:%d", fp, kv.Pos().Line)
+				for _, k := range lookup(keyword, path) {
+					if !containsString(k.References, ref) {
+						k.References = append(k.References, ref)
+					}
+				}
+			}
+		}
+	}
+
+	defaults := strings.Fields(sshconfig.Default("IdentityFile"))
+	aliases := make([]string, 0, len(aliasMap))
+	for alias := range aliasMap {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		host := aliasMap[alias]
+		if len(host.Values("identityfile")) == 0 {
+			for _, file := range defaults {
+				if path, ok := identityPath(file); ok {
+					for _, k := range lookup("identityfile", path) {
+						if !containsString(k.Aliases, alias) {
+							k.Aliases = append(k.Aliases, alias)
+						}
+					}
+				}
+			}
+		}
+		for _, s := range host.Settings {
+			keyword, ok := keyFileKeywords[s.Key]
+			if !ok {
+				continue
+			}
+			path, ok := identityPath(s.Value)
+			if !ok {
+				continue
+			}
+			for _, k := range lookup(s.Key, path) {
+				if !containsString(k.Aliases, alias) {
+					k.Aliases = append(k.Aliases, alias)
+				}
+			}
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				inventory.Missing = append(inventory.Missing, &MissingKey{Alias: alias, Keyword: keyword, Value: s.Value, Path: path, Source: Origin(s)})
+			}
+		}
+	}
+	for _, k := range keys {
+		if k.Aliases == nil {
+			k.Aliases = []string{}
+		}
+		if k.References == nil {
+			k.References = []string{}
+		}
+	}
+	return inventory, nil
+}
+
+// scanKeys read the keys of dir: the private keys with their .pub file, and
+// the .pub files without a private key, such as certificates
+func scanKeys(dir string) ([]*KeyInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*KeyInfo{}, nil
+		}
+		return nil, err
+	}
+	keys := []*KeyInfo{}
+	private := map[string]*KeyInfo{}
+	var pubs []string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() || info.Size() > 1<<16 {
+			continue
+		}
+		if strings.HasSuffix(path, ".pub") {
+			pubs = append(pubs, path)
+			continue
+		}
+		if k := readPrivateKey(path); k != nil {
+			private[path] = k
+			keys = append(keys, k)
+		}
+	}
+	for _, pubPath := range pubs {
+		data, err := os.ReadFile(pubPath)
+		if err != nil {
+			continue
+		}
+		pub, comment, _, _, err := ssh.ParseAuthorizedKey(data)
+		if k, ok := private[strings.TrimSuffix(pubPath, ".pub")]; ok {
+			k.Public = pubPath
+			if err != nil {
+				k.Error = fmt.Sprintf("%s: %v", filepath.Base(pubPath), err)
+				continue
+			}
+			k.Comment = comment
+			if k.Type == "" {
+				setKeyInfo(k, pub)
+			} else if k.Error == "" && ssh.FingerprintSHA256(pub) != k.Fingerprint {
+				k.Error = "the private key does not match its public key"
+			}
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		k := &KeyInfo{Path: pubPath, Public: pubPath, Comment: comment}
+		setKeyInfo(k, pub)
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Path < keys[j].Path })
+	return keys, nil
+}
+
+// readPrivateKey read the private key at path, nil if it is not one
+func readPrivateKey(path string) *KeyInfo {
+	data, err := os.ReadFile(path)
+	if err != nil || !bytes.Contains(data, []byte("PRIVATE KEY-----")) {
+		return nil
+	}
+	k := &KeyInfo{Path: path}
+	raw, err := ssh.ParseRawPrivateKey(data)
+	if err != nil {
+		var missing *ssh.PassphraseMissingError
+		if !errors.As(err, &missing) {
+			k.Error = err.Error()
+			return k
+		}
+		k.Encrypted = true
+		if missing.PublicKey != nil {
+			setKeyInfo(k, missing.PublicKey)
+		}
+		return k
+	}
+	signer, err := ssh.NewSignerFromKey(raw)
+	if err != nil {
+		k.Error = err.Error()
+		return k
+	}
+	setKeyInfo(k, signer.PublicKey())
+	return k
+}
+
+// setKeyInfo set the type, size and fingerprint of k from its public key,
+// those of the certified key for a certificate
+func setKeyInfo(k *KeyInfo, pub ssh.PublicKey) {
+	k.Type = pub.Type()
+	if cert, ok := pub.(*ssh.Certificate); ok {
+		pub = cert.Key
+	}
+	k.Fingerprint = ssh.FingerprintSHA256(pub)
+	k.Bits = keyBits(pub)
+}
+
+// keyBits the size of key in bits, as ssh-keygen -l prints it
+func keyBits(key ssh.PublicKey) int {
+	crypto, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	switch k := crypto.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return 256
+	}
+	return 0
+}
@@ -0,0 +1,107 @@
+package sshman
+
+import (
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestListKeys(t *testing.T) {
+	defer func(dir string) { KeyDir = dir }(KeyDir)
+	dir := t.TempDir()
+	KeyDir = filepath.Join(dir, "keys")
+	require.Nil(t, os.MkdirAll(KeyDir, 0700))
+
+	web := writeTestKey(t, filepath.Join(KeyDir, "id_web"))
+	_, err := GenerateKey(filepath.Join(KeyDir, "id_rsa_db"), KeyOption{Type: KeyRSA, Bits: 2048, Comment: "db key"})
+	require.Nil(t, err)
+	unused := writeTestKey(t, filepath.Join(KeyDir, "id_unused"))
+	// a private key with a passphrase and no public key
+	raw, err := ssh.ParseRawPrivateKey(func() []byte {
+		data, err := os.ReadFile(filepath.Join(KeyDir, "id_unused"))
+		require.Nil(t, err)
+		return data
+	}())
+	require.Nil(t, err)
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(raw, "secret", []byte("passphrase"))
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(filepath.Join(KeyDir, "id_secret"), pem.EncodeToMemory(block), 0600))
+	// a certificate of the web key, loaded with its IdentityFile
+	cert := &ssh.Certificate{Key: web.PublicKey(), CertType: ssh.UserCert, ValidPrincipals: []string{"deploy"}, ValidBefore: ssh.CertTimeInfinity}
+	require.Nil(t, cert.SignCert(rand.Reader, unused))
+	require.Nil(t, os.WriteFile(filepath.Join(KeyDir, "id_web-cert.pub"), ssh.MarshalAuthorizedKey(cert), 0644))
+	// files that are no keys
+	require.Nil(t, os.WriteFile(filepath.Join(KeyDir, "config"), []byte("Host *\n"), 0600))
+	require.Nil(t, os.WriteFile(filepath.Join(KeyDir, "known_hosts"), []byte("example.com ssh-ed25519 AAAA\n"), 0600))
+
+	p := filepath.Join(dir, "config")
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "conf.d"), 0700))
+	require.Nil(t, os.WriteFile(p, []byte(fmt.Sprintf(`Include %[1]s/conf.d/*
+Host web
+    HostName 10.0.0.1
+    IdentityFile %[2]s/id_web
+    IdentityFile %[2]s/id_gone
+`, dir, KeyDir)), 0600))
+	db := filepath.Join(dir, "conf.d", "db")
+	require.Nil(t, os.WriteFile(db, []byte(fmt.Sprintf("Host db\n    HostName 10.0.0.2\n    IdentityFile \"%[1]s/id_rsa_db.pub\"\n    CertificateFile %[1]s/id_db-cert.pub\n", KeyDir)), 0600))
+
+	inventory, err := ListKeys(p)
+	require.Nil(t, err)
+	require.Equal(t, KeyDir, inventory.Dir)
+	keys := map[string]*KeyInfo{}
+	for _, k := range inventory.Keys {
+		keys[filepath.Base(k.Path)] = k
+	}
+	require.Len(t, keys, 5)
+
+	k := keys["id_web"]
+	require.Equal(t, filepath.Join(KeyDir, "id_web.pub"), k.Public)
+	require.Equal(t, ssh.KeyAlgoED25519, k.Type)
+	require.Equal(t, 256, k.Bits)
+	require.Equal(t, ssh.FingerprintSHA256(web.PublicKey()), k.Fingerprint)
+	require.False(t, k.Encrypted)
+	require.Equal(t, []string{"web"}, k.Aliases)
+	require.Equal(t, []string{p + ":4"}, k.References)
+	require.Empty(t, k.Error)
+
+	k = keys["id_rsa_db"]
+	require.Equal(t, ssh.KeyAlgoRSA, k.Type)
+	require.Equal(t, 2048, k.Bits)
+	require.Equal(t, "db key", k.Comment)
+	require.Equal(t, []string{"db"}, k.Aliases)
+	require.Equal(t, []string{db + ":3"}, k.References)
+
+	k = keys["id_web-cert.pub"]
+	require.Equal(t, ssh.CertAlgoED25519v01, k.Type)
+	require.Equal(t, ssh.FingerprintSHA256(web.PublicKey()), k.Fingerprint)
+	require.Equal(t, []string{"web"}, k.Aliases)
+
+	k = keys["id_secret"]
+	require.True(t, k.Encrypted)
+	require.Equal(t, ssh.FingerprintSHA256(unused.PublicKey()), k.Fingerprint)
+	require.True(t, k.Unused())
+	require.True(t, keys["id_unused"].Unused())
+	require.False(t, keys["id_web"].Unused())
+
+	require.Len(t, inventory.Missing, 2)
+	require.Equal(t, MissingKey{Alias: "db", Keyword: "CertificateFile", Value: KeyDir + "/id_db-cert.pub", Path: filepath.Join(KeyDir, "id_db-cert.pub"), Source: db + ":4"}, *inventory.Missing[0])
+	require.Equal(t, "web", inventory.Missing[1].Alias)
+	require.Equal(t, "IdentityFile", inventory.Missing[1].Keyword)
+	require.Equal(t, p+":5", inventory.Missing[1].Source)
+
+	// a tampered public key
+	require.Nil(t, os.WriteFile(filepath.Join(KeyDir, "id_unused.pub"), ssh.MarshalAuthorizedKey(web.PublicKey()), 0644))
+	inventory, err = ListKeys(p)
+	require.Nil(t, err)
+	for _, k := range inventory.Keys {
+		if filepath.Base(k.Path) == "id_unused" {
+			require.Contains(t, k.Error, "does not match")
+		}
+	}
+}
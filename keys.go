@@ -0,0 +1,220 @@
+package sshman
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Key types of KeyOption
+const (
+	KeyEd25519 = "ed25519"
+	KeyECDSA   = "ecdsa"
+	KeyRSA     = "rsa"
+)
+
+// KeyTypes the key types NewKey generates
+var KeyTypes = []string{KeyEd25519, KeyECDSA, KeyRSA}
+
+// KeyDir directory the keys are written to, ~/.ssh if empty
+var KeyDir = ""
+
+// KeyOption options for GenerateKey and NewKey
+type KeyOption struct {
+	// Type one of KeyTypes, ed25519 if empty
+	Type string
+	// Bits the size of ecdsa (256, 384 or 521) and rsa keys, 256 and 3072 if
+	// not set
+	Bits int
+	// Comment the comment of the key, user@hostname if empty
+	Comment string
+}
+
+// GeneratedKey a key pair NewKey wrote
+type GeneratedKey struct {
+	Alias string `json:"alias" yaml:"alias"`
+	// Path the private key, the public key is Path.pub
+	Path        string `json:"path" yaml:"path"`
+	Type        string `json:"type" yaml:"type"`
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+	Comment     string `json:"comment" yaml:"comment"`
+	// Host the alias with its new IdentityFile
+	Host *HostConfig `json:"-" yaml:"-"`
+}
+
+// keyDir the directory of the keys
+func keyDir() string {
+	if KeyDir != "" {
+		if path, ok := identityPath(KeyDir); ok {
+			return path
+		}
+		return KeyDir
+	}
+	return filepath.Join(GetHomeDir(), ".ssh")
+}
+
+// unsafeKeyName characters a key file name should not hold
+var unsafeKeyName = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// KeyPath the path of the key of type typ for alias in KeyDir, such as
+// ~/.ssh/id_ed25519_web
+func KeyPath(alias, typ string) string {
+	if typ == "" {
+		typ = KeyEd25519
+	}
+	return filepath.Join(keyDir(), fmt.Sprintf("id_%s_%s", typ, unsafeKeyName.ReplaceAllString(alias, "_")))
+}
+
+// homePath replace the home directory prefix of path with ~, as ssh reads it
+func homePath(path string) string {
+	if home := GetHomeDir(); home != "" && strings.HasPrefix(path, home+string(filepath.Separator)) {
+		return "~" + path[len(home):]
+	}
+	return path
+}
+
+// GenerateKey generate a key pair and write the private key to path, in the
+// OpenSSH format with mode 0600, and the public key to path.pub with mode
+// 0644. Existing files are not overwritten.
+func GenerateKey(path string, o KeyOption) (ssh.PublicKey, error) {
+	var priv crypto.Signer
+	var err error
+	switch o.Type {
+	case KeyEd25519, "":
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	case KeyECDSA:
+		var curve elliptic.Curve
+		switch o.Bits {
+		case 256, 0:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("ecdsa keys have 256, 384 or 521 bits, not %d", o.Bits)
+		}
+		priv, err = ecdsa.GenerateKey(curve, rand.Reader)
+	case KeyRSA:
+		bits := o.Bits
+		if bits == 0 {
+			bits = 3072
+		}
+		if bits < 2048 {
+			return nil, fmt.Errorf("rsa keys have at least 2048 bits, not %d", bits)
+		}
+		priv, err = rsa.GenerateKey(rand.Reader, bits)
+	default:
+		return nil, fmt.Errorf("unknown key type %q, expect one of %s", o.Type, strings.Join(KeyTypes, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	pub, err := ssh.NewPublicKey(priv.Public())
+	if err != nil {
+		return nil, err
+	}
+	comment := o.Comment
+	if comment == "" {
+		comment = defaultKeyComment()
+	}
+	block, err := ssh.MarshalPrivateKey(priv, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	for _, p := range []string{path, path + ".pub"} {
+		if _, err := os.Lstat(p); err == nil {
+			return nil, fmt.Errorf("%s exists already", p)
+		}
+	}
+	if err := writeNewFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))) + " " + comment + "\n"
+	if err := writeNewFile(path+".pub", []byte(line), 0644); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return pub, nil
+}
+
+// writeNewFile create the file path with data and mode, whatever the umask
+func writeNewFile(path string, data []byte, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// NewKey generate a key pair for an alias of the config file p, at KeyPath,
+// and set it as the IdentityFile of the alias with IdentitiesOnly yes
+func NewKey(p, alias string, o KeyOption) (*GeneratedKey, error) {
+	tx, err := Begin(p)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := checkAlias(tx.aliasMap, true, alias); err != nil {
+		return nil, err
+	}
+	if o.Type == "" {
+		o.Type = KeyEd25519
+	}
+	if o.Comment == "" {
+		o.Comment = defaultKeyComment()
+	}
+	path := KeyPath(alias, o.Type)
+	pub, err := GenerateKey(path, o)
+	if err != nil {
+		return nil, err
+	}
+	host, err := tx.Update(&UpdateOption{Alias: alias, Config: map[string]string{
+		"identityfile":   homePath(path),
+		"identitiesonly": "yes",
+	}})
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		os.Remove(path)
+		os.Remove(path + ".pub")
+		return nil, err
+	}
+	return &GeneratedKey{Alias: alias, Path: path, Type: pub.Type(), Fingerprint: ssh.FingerprintSHA256(pub), Comment: o.Comment, Host: host}, nil
+}
+
+// defaultKeyComment user@hostname, as ssh-keygen comments keys
+func defaultKeyComment() string {
+	hostname, _ := os.Hostname()
+	return GetUsername() + "@" + hostname
+}
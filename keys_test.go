@@ -0,0 +1,87 @@
+package sshman
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGenerateKey(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		o    KeyOption
+		want string
+	}{
+		{KeyOption{}, ssh.KeyAlgoED25519},
+		{KeyOption{Type: KeyECDSA, Bits: 384}, ssh.KeyAlgoECDSA384},
+		{KeyOption{Type: KeyRSA, Bits: 2048, Comment: "deploy key"}, ssh.KeyAlgoRSA},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, "keys", "id_"+string(rune('a'+i)))
+		pub, err := GenerateKey(path, tt.o)
+		require.Nil(t, err)
+		require.Equal(t, tt.want, pub.Type())
+
+		info, err := os.Stat(path)
+		require.Nil(t, err)
+		require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		info, err = os.Stat(path + ".pub")
+		require.Nil(t, err)
+		require.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+		data, err := os.ReadFile(path)
+		require.Nil(t, err)
+		signer, err := ssh.ParsePrivateKey(data)
+		require.Nil(t, err)
+		require.Equal(t, pub.Marshal(), signer.PublicKey().Marshal())
+		data, err = os.ReadFile(path + ".pub")
+		require.Nil(t, err)
+		key, comment, _, _, err := ssh.ParseAuthorizedKey(data)
+		require.Nil(t, err)
+		require.Equal(t, pub.Marshal(), key.Marshal())
+		if tt.o.Comment != "" {
+			require.Equal(t, tt.o.Comment, comment)
+		}
+
+		_, err = GenerateKey(path, tt.o)
+		require.ErrorContains(t, err, "exists already")
+	}
+
+	_, err := GenerateKey(filepath.Join(dir, "small"), KeyOption{Type: KeyRSA, Bits: 1024})
+	require.NotNil(t, err)
+	_, err = GenerateKey(filepath.Join(dir, "dsa"), KeyOption{Type: "dsa"})
+	require.NotNil(t, err)
+}
+
+func TestNewKey(t *testing.T) {
+	defer func(dir string) { KeyDir = dir }(KeyDir)
+	dir := t.TempDir()
+	KeyDir = filepath.Join(dir, "keys")
+	p := filepath.Join(dir, "config")
+	require.Nil(t, os.WriteFile(p, []byte("Host web\n    HostName 10.0.0.1\n    IdentityFile ~/.ssh/old\n"), 0600))
+
+	key, err := NewKey(p, "web", KeyOption{Comment: "web key"})
+	require.Nil(t, err)
+	path := filepath.Join(KeyDir, "id_ed25519_web")
+	require.Equal(t, path, key.Path)
+	require.Equal(t, ssh.KeyAlgoED25519, key.Type)
+	require.True(t, strings.HasPrefix(key.Fingerprint, "SHA256:"))
+
+	host, err := Resolve(p, "web")
+	require.Nil(t, err)
+	require.Equal(t, []string{path}, host.Values("identityfile"))
+	require.Equal(t, "yes", host.Get("identitiesonly"))
+
+	// the key of an alias is not replaced
+	_, err = NewKey(p, "web", KeyOption{})
+	require.ErrorContains(t, err, "exists already")
+
+	_, err = NewKey(p, "db", KeyOption{})
+	require.NotNil(t, err)
+	_, err = os.Stat(KeyPath("db", KeyEd25519))
+	require.True(t, os.IsNotExist(err))
+}
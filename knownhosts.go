@@ -0,0 +1,489 @@
+package sshman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sonnt85/sshman/knownhosts"
+	"github.com/sonnt85/sshman/sshconfig"
+	"golang.org/x/crypto/ssh"
+	xknownhosts "golang.org/x/crypto/ssh/knownhosts"
+)
+
+// KnownHost an entry of a known_hosts file
+type KnownHost struct {
+	File string `json:"file" yaml:"file"`
+	Line int    `json:"line,omitempty" yaml:"line,omitempty"`
+	// Marker @cert-authority, @revoked or empty
+	Marker string `json:"marker,omitempty" yaml:"marker,omitempty"`
+	// Hosts the host patterns, or the single |1|salt|hash of a hashed entry
+	Hosts       []string `json:"hosts" yaml:"hosts"`
+	Hashed      bool     `json:"hashed" yaml:"hashed"`
+	KeyType     string   `json:"key_type" yaml:"key_type"`
+	Fingerprint string   `json:"fingerprint" yaml:"fingerprint"`
+	// Aliases the aliases the entry is for
+	Aliases []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+}
+
+func newKnownHost(file string, e *knownhosts.Entry) *KnownHost {
+	return &KnownHost{
+		File:        file,
+		Line:        e.Line,
+		Marker:      e.Marker,
+		Hosts:       e.Hosts,
+		Hashed:      e.Hashed(),
+		KeyType:     e.Key.Type(),
+		Fingerprint: ssh.FingerprintSHA256(e.Key),
+	}
+}
+
+// KnownHostsAddress the name ssh looks the host of an alias up by in
+// known_hosts: its HostKeyAlias, or its HostName with the port if it is not
+// 22
+func KnownHostsAddress(host *HostConfig) string {
+	return newEndpoint(host).knownHostsAddress()
+}
+
+// knownHostsAddress the name ssh looks e up by in known_hosts
+func (e *endpoint) knownHostsAddress() string {
+	if alias := e.host.Get("hostkeyalias"); alias != "" {
+		return alias
+	}
+	hostname, port, _ := net.SplitHostPort(e.addr)
+	return knownhosts.Address(hostname, port)
+}
+
+// hostKeyCheck how the host keys of an alias and its jump hosts are checked
+type hostKeyCheck int
+
+const (
+	// hostKeysRecorded the host keys are recorded, not verified, as check and
+	// known-hosts scan need
+	hostKeysRecorded hostKeyCheck = iota
+	// hostKeysVerified the host keys are verified against known_hosts as
+	// StrictHostKeyChecking says
+	hostKeysVerified
+	// hostKeysAcceptNew unknown host keys are accepted and recorded too
+	hostKeysAcceptNew
+)
+
+// hostKeyCallback the HostKeyCallback verifying the host key of e against its
+// known_hosts files, nil with hostKeysRecorded. Unknown keys are refused
+// unless StrictHostKeyChecking is accept-new, no or off or check is
+// hostKeysAcceptNew, then they are added to the first file. Changed keys are
+// refused unless StrictHostKeyChecking is no or off.
+func (e *endpoint) hostKeyCallback(check hostKeyCheck) ssh.HostKeyCallback {
+	if check == hostKeysRecorded {
+		return nil
+	}
+	address := e.knownHostsAddress()
+	paths := KnownHostsFiles(e.host)
+	strict := strings.ToLower(e.host.Get("stricthostkeychecking"))
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := verifyHostKey(paths, address, key)
+		var keyErr *xknownhosts.KeyError
+		if err == nil || !errors.As(err, &keyErr) {
+			return err
+		}
+		fingerprint := key.Type() + " " + ssh.FingerprintSHA256(key)
+		switch {
+		case len(keyErr.Want) > 0 && strict != "no" && strict != "off":
+			want := keyErr.Want[0]
+			return fmt.Errorf("the host key of %s has changed to %s, %s:%d has %s; run known-hosts scan --replace if the change is expected", address, fingerprint, want.Filename, want.Line, ssh.FingerprintSHA256(want.Key))
+		case len(keyErr.Want) > 0:
+			return nil
+		case check != hostKeysAcceptNew && strict != "accept-new" && strict != "no" && strict != "off":
+			return fmt.Errorf("the host key of %s is unknown, %s; run known-hosts scan or pass --accept-new to trust it", address, fingerprint)
+		case len(paths) == 0:
+			return nil
+		}
+		f, err := knownhosts.Load(paths[0])
+		if err != nil {
+			return err
+		}
+		f.Add(address, key, strings.EqualFold(e.host.Get("hashknownhosts"), "yes"))
+		return writeFile(f.Path, string(f.Bytes()), backupDir(f.Path))
+	}
+}
+
+// verifyHostKey check key against the entries for address of the known_hosts
+// files paths, those that do not exist are skipped
+func verifyHostKey(paths []string, address string, key ssh.PublicKey) error {
+	var files []string
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		return &xknownhosts.KeyError{}
+	}
+	callback, err := xknownhosts.New(files...)
+	if err != nil {
+		return err
+	}
+	// the address is looked up as given, the HostKeyAlias included, not the
+	// remote address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+	return callback(address, &net.TCPAddr{}, key)
+}
+
+// KnownHostsFiles the known_hosts files of the user ssh reads for host, its
+// UserKnownHostsFile or the default ones, none if it is none
+func KnownHostsFiles(host *HostConfig) []string {
+	value := host.Get("userknownhostsfile")
+	if value == "" {
+		value = sshconfig.Default("UserKnownHostsFile")
+	}
+	var files []string
+	for _, file := range strings.Fields(value) {
+		if path, ok := identityPath(file); ok {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// knownHostsRef a host ssh looks up in known_hosts files
+type knownHostsRef struct {
+	alias   string
+	address string
+	files   []string
+}
+
+// knownHostsRefs the hosts of the aliases of the config file p, every alias
+// without wildcards if aliases is empty. With jumps, the ProxyJump hosts that
+// are not aliases are added.
+func knownHostsRefs(p string, aliases []string, jumps bool) ([]*knownHostsRef, error) {
+	if len(aliases) == 0 {
+		hosts, err := List(p, ListOption{})
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range hosts {
+			if !strings.ContainsAny(host.Alias, "*?!") {
+				aliases = append(aliases, host.Alias)
+			}
+		}
+	}
+	var refs []*knownHostsRef
+	seen := map[string]bool{}
+	for _, alias := range aliases {
+		host, err := Resolve(p, alias)
+		if err != nil {
+			return nil, err
+		}
+		e := newEndpoint(host)
+		refs = append(refs, &knownHostsRef{alias: alias, address: e.knownHostsAddress(), files: KnownHostsFiles(host)})
+		seen[alias] = true
+		if !jumps {
+			continue
+		}
+		// the jump hosts that cannot be resolved are left out
+		jes, _ := jumpEndpoints(p, host)
+		for _, je := range jes {
+			if !seen[je.host.Alias] {
+				refs = append(refs, &knownHostsRef{alias: je.jump, address: je.knownHostsAddress(), files: KnownHostsFiles(je.host)})
+			}
+		}
+	}
+	return refs, nil
+}
+
+// loadKnownHosts load the known_hosts files of refs, in the order they are
+// first referenced
+func loadKnownHosts(refs []*knownHostsRef) ([]*knownhosts.File, error) {
+	var files []*knownhosts.File
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		for _, path := range ref.files {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			f, err := knownhosts.Load(path)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// refersTo the aliases of refs whose host is e, an entry of file
+func refersTo(refs []*knownHostsRef, file string, e *knownhosts.Entry) []string {
+	var aliases []string
+	for _, ref := range refs {
+		for _, f := range ref.files {
+			if f == file && e.Match(ref.address) {
+				aliases = append(aliases, ref.alias)
+				break
+			}
+		}
+	}
+	return aliases
+}
+
+// ListKnownHosts return the entries of the known_hosts files the aliases of
+// the config file p use, with the aliases they are for. With aliases, only
+// the entries for them are returned.
+func ListKnownHosts(p string, aliases ...string) ([]*KnownHost, error) {
+	all, err := knownHostsRefs(p, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	refs := all
+	if len(aliases) > 0 {
+		if refs, err = knownHostsRefs(p, aliases, false); err != nil {
+			return nil, err
+		}
+	}
+	files, err := loadKnownHosts(refs)
+	if err != nil {
+		return nil, err
+	}
+	var known []*KnownHost
+	for _, f := range files {
+		for _, e := range f.Entries() {
+			if len(aliases) > 0 && len(refersTo(refs, f.Path, e)) == 0 {
+				continue
+			}
+			kh := newKnownHost(f.Path, e)
+			kh.Aliases = refersTo(all, f.Path, e)
+			known = append(known, kh)
+		}
+	}
+	return known, nil
+}
+
+// removeKnownHosts remove the entries for the hosts of refs and write the
+// files that changed
+func removeKnownHosts(refs []*knownHostsRef) ([]*KnownHost, error) {
+	files, err := loadKnownHosts(refs)
+	if err != nil {
+		return nil, err
+	}
+	var removed []*KnownHost
+	for _, f := range files {
+		n := len(removed)
+		for _, ref := range refs {
+			for _, path := range ref.files {
+				if path != f.Path {
+					continue
+				}
+				for _, e := range f.Remove(ref.address) {
+					kh := newKnownHost(f.Path, e)
+					kh.Aliases = []string{ref.alias}
+					removed = append(removed, kh)
+				}
+			}
+		}
+		if len(removed) > n {
+			if err := writeFile(f.Path, string(f.Bytes()), backupDir(f.Path)); err != nil {
+				return removed[:n], err
+			}
+		}
+	}
+	return removed, nil
+}
+
+// RemoveKnownHosts remove the known_hosts entries for the aliases of the
+// config file p, as ssh-keygen -R does, and return them
+func RemoveKnownHosts(p string, aliases ...string) ([]*KnownHost, error) {
+	if len(aliases) == 0 {
+		return nil, fmt.Errorf("no alias given")
+	}
+	refs, err := knownHostsRefs(p, aliases, false)
+	if err != nil {
+		return nil, err
+	}
+	return removeKnownHosts(refs)
+}
+
+// PruneKnownHosts remove the entries of the known_hosts files that are for
+// no alias of the config file p nor any of their ProxyJump hosts, and return
+// them. Hashed entries are compared too. Entries with wildcards and marked
+// entries, @cert-authority and @revoked, are kept. With dryRun the files are
+// left unchanged.
+func PruneKnownHosts(p string, dryRun bool) ([]*KnownHost, error) {
+	refs, err := knownHostsRefs(p, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	files, err := loadKnownHosts(refs)
+	if err != nil {
+		return nil, err
+	}
+	var pruned []*KnownHost
+	for _, f := range files {
+		n := len(pruned)
+		for _, e := range f.Entries() {
+			if e.Marker != "" || e.Wildcard() || len(refersTo(refs, f.Path, e)) > 0 {
+				continue
+			}
+			pruned = append(pruned, newKnownHost(f.Path, e))
+			if !dryRun {
+				f.RemoveEntry(e)
+			}
+		}
+		if !dryRun && len(pruned) > n {
+			if err := writeFile(f.Path, string(f.Bytes()), backupDir(f.Path)); err != nil {
+				return pruned[:n], err
+			}
+		}
+	}
+	return pruned, nil
+}
+
+// DeletePurgeKnownHosts delete the aliases as Delete does, then remove their
+// known_hosts entries unless an alias left uses the same host
+func DeletePurgeKnownHosts(p string, aliases ...string) ([]*HostConfig, []*KnownHost, error) {
+	refs, err := knownHostsRefs(p, aliases, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	hosts, err := Delete(p, aliases...)
+	if err != nil {
+		return nil, nil, err
+	}
+	left, err := knownHostsRefs(p, nil, true)
+	if err != nil {
+		return hosts, nil, err
+	}
+	used := map[string]bool{}
+	for _, ref := range left {
+		used[ref.address] = true
+	}
+	var purge []*knownHostsRef
+	for _, ref := range refs {
+		if !used[ref.address] {
+			purge = append(purge, ref)
+		}
+	}
+	removed, err := removeKnownHosts(purge)
+	return hosts, removed, err
+}
+
+// ScanOption options for ScanKnownHosts
+type ScanOption struct {
+	// Timeout the time the scan may take, 5s if not set
+	Timeout time.Duration
+	// Replace replace the entries whose key changed instead of reporting them
+	Replace bool
+}
+
+// ScanResult the host keys ScanKnownHosts fetched for an alias
+type ScanResult struct {
+	Alias string `json:"alias" yaml:"alias"`
+	// Address the name the keys are recorded for
+	Address string `json:"address" yaml:"address"`
+	File    string `json:"file" yaml:"file"`
+	// Added the entries added to File
+	Added []*KnownHost `json:"added,omitempty" yaml:"added,omitempty"`
+	// Known the keys File already had
+	Known []*KnownHost `json:"known,omitempty" yaml:"known,omitempty"`
+	// Changed the entries whose key differs from the server's, replaced
+	// with Replace
+	Changed []*KnownHost `json:"changed,omitempty" yaml:"changed,omitempty"`
+}
+
+// ScanKnownHosts fetch the host keys of an alias of the config file p,
+// through its ProxyJump hosts, and add those that are not known yet to its
+// first known_hosts file, hashed if HashKnownHosts is set. Entries for the
+// alias with a different key of the same type are reported, and replaced
+// with o.Replace.
+func ScanKnownHosts(p, alias string, o ScanOption) (*ScanResult, error) {
+	if o.Timeout <= 0 {
+		o.Timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), o.Timeout)
+	defer cancel()
+	ac, err := dialAlias(ctx, p, alias, hostKeysRecorded)
+	if err != nil {
+		return nil, err
+	}
+	defer ac.close()
+	host, target := ac.host, ac.target
+	paths := KnownHostsFiles(host)
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s: UserKnownHostsFile is none", alias)
+	}
+	r := &ScanResult{Alias: alias, Address: target.knownHostsAddress(), File: paths[0]}
+	keys, err := knownhosts.Scan(func() (net.Conn, error) { return dial(ctx, ac.jump, target.addr) }, target.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := knownhosts.Load(r.File)
+	if err != nil {
+		return nil, err
+	}
+	existing := f.Lookup(r.Address)
+	if o.Replace {
+		for _, e := range existing {
+			if e.Marker != "" || hasKey(keys, e.Key) {
+				continue
+			}
+			if removed := f.RemoveHost(e, r.Address); removed != nil {
+				r.Changed = append(r.Changed, newKnownHost(f.Path, removed))
+			}
+		}
+	}
+	hash := strings.EqualFold(host.Get("hashknownhosts"), "yes")
+	for _, key := range keys {
+		if e := findKey(existing, key); e != nil {
+			r.Known = append(r.Known, newKnownHost(f.Path, e))
+			continue
+		}
+		if e := findType(existing, key.Type()); e != nil && !o.Replace {
+			r.Changed = append(r.Changed, newKnownHost(f.Path, e))
+			continue
+		}
+		r.Added = append(r.Added, newKnownHost(f.Path, f.Add(r.Address, key, hash)))
+	}
+	sort.SliceStable(r.Changed, func(i, j int) bool { return r.Changed[i].Line < r.Changed[j].Line })
+	if len(r.Added) > 0 || (o.Replace && len(r.Changed) > 0) {
+		if err := writeFile(f.Path, string(f.Bytes()), backupDir(f.Path)); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func hasKey(keys []ssh.PublicKey, key ssh.PublicKey) bool {
+	for _, k := range keys {
+		if string(k.Marshal()) == string(key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// findKey the entry of entries with key, not revoked
+func findKey(entries []*knownhosts.Entry, key ssh.PublicKey) *knownhosts.Entry {
+	for _, e := range entries {
+		if e.Marker == "" && string(e.Key.Marshal()) == string(key.Marshal()) {
+			return e
+		}
+	}
+	return nil
+}
+
+// findType the entry of entries with a key of type typ
+func findType(entries []*knownhosts.Entry, typ string) *knownhosts.Entry {
+	for _, e := range entries {
+		if e.Marker == "" && e.Key.Type() == typ {
+			return e
+		}
+	}
+	return nil
+}
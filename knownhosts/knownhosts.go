@@ -0,0 +1,311 @@
+// Package knownhosts reads and edits OpenSSH known_hosts files.
+//
+// Unlike golang.org/x/crypto/ssh/knownhosts, which only verifies host keys,
+// a File keeps every line of the file, comments and lines it cannot parse
+// included, so that entries can be added or removed and the file written
+// back unchanged otherwise.
+//
+//	f, _ := knownhosts.Load(filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts"))
+//	for _, e := range f.Lookup(knownhosts.Address("example.com", "2222")) {
+//		fmt.Println(e.Line, e.Key.Type())
+//	}
+//	f.Remove(knownhosts.Address("old.example.com", "22"))
+//	os.WriteFile(f.Path, f.Bytes(), 0600)
+package knownhosts
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	xknownhosts "golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Markers of an Entry
+const (
+	MarkerCertAuthority = "@cert-authority"
+	MarkerRevoked       = "@revoked"
+)
+
+// Entry a host key line of a known_hosts file
+type Entry struct {
+	// Line the line number, 1 for the first line, 0 for added entries
+	Line int
+	// Marker @cert-authority, @revoked or empty
+	Marker string
+	// Hosts the host patterns, or the single |1|salt|hash of a hashed entry
+	Hosts   []string
+	Key     ssh.PublicKey
+	Comment string
+}
+
+// Hashed whether the host name of e is hashed, see HashKnownHosts
+func (e *Entry) Hashed() bool {
+	return len(e.Hosts) == 1 && strings.HasPrefix(e.Hosts[0], "|")
+}
+
+// Wildcard whether a host pattern of e has a wildcard or is negated
+func (e *Entry) Wildcard() bool {
+	for _, h := range e.Hosts {
+		if strings.ContainsAny(h, "*?!") {
+			return true
+		}
+	}
+	return false
+}
+
+// Match whether e is for address, a host name as Address returns it
+func (e *Entry) Match(address string) bool {
+	if e.Hashed() {
+		return matchHashed(e.Hosts[0], address)
+	}
+	address = strings.ToLower(address)
+	found := false
+	for _, h := range e.Hosts {
+		negated := strings.HasPrefix(h, "!")
+		if wildcardMatch(strings.ToLower(strings.TrimPrefix(h, "!")), address) {
+			if negated {
+				return false
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+// String the line of e
+func (e *Entry) String() string {
+	var b strings.Builder
+	if e.Marker != "" {
+		b.WriteString(e.Marker + " ")
+	}
+	b.WriteString(strings.Join(e.Hosts, ",") + " ")
+	b.WriteString(strings.TrimSpace(string(ssh.MarshalAuthorizedKey(e.Key))))
+	if e.Comment != "" {
+		b.WriteString(" " + e.Comment)
+	}
+	return b.String()
+}
+
+// line a line of a File, entry is nil for comments, blank lines and lines
+// that cannot be parsed
+type line struct {
+	text  string
+	entry *Entry
+}
+
+// File a known_hosts file
+type File struct {
+	Path  string
+	lines []*line
+}
+
+// Load read the known_hosts file path, a missing file is empty
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return Parse(path, data), nil
+}
+
+// Parse parse data, the contents of the known_hosts file path
+func Parse(path string, data []byte) *File {
+	f := &File{Path: path}
+	text := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if text == "" {
+		return f
+	}
+	for i, s := range strings.Split(text, "\n") {
+		l := &line{text: s}
+		if e, err := parseEntry(s); err == nil {
+			e.Line = i + 1
+			l.entry = e
+		}
+		f.lines = append(f.lines, l)
+	}
+	return f
+}
+
+func parseEntry(s string) (*Entry, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return nil, errors.New("no entry")
+	}
+	e := &Entry{}
+	if strings.HasPrefix(fields[0], "@") {
+		e.Marker, fields = fields[0], fields[1:]
+	}
+	if len(fields) < 3 {
+		return nil, errors.New("missing fields")
+	}
+	data, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	if e.Key, err = ssh.ParsePublicKey(data); err != nil {
+		return nil, err
+	}
+	e.Hosts = strings.Split(fields[0], ",")
+	e.Comment = strings.Join(fields[3:], " ")
+	return e, nil
+}
+
+// Entries the host key entries of f, in file order
+func (f *File) Entries() []*Entry {
+	var entries []*Entry
+	for _, l := range f.lines {
+		if l.entry != nil {
+			entries = append(entries, l.entry)
+		}
+	}
+	return entries
+}
+
+// Lookup the entries of f for address
+func (f *File) Lookup(address string) []*Entry {
+	var entries []*Entry
+	for _, e := range f.Entries() {
+		if e.Match(address) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Add append an entry for address and key, with its host name hashed if
+// hash is set
+func (f *File) Add(address string, key ssh.PublicKey, hash bool) *Entry {
+	host := address
+	if hash {
+		host = xknownhosts.HashHostname(address)
+	}
+	e := &Entry{Hosts: []string{host}, Key: key}
+	f.lines = append(f.lines, &line{text: e.String(), entry: e})
+	return e
+}
+
+// Remove remove the entries for address, as ssh-keygen -R does, and return
+// them. An entry that lists other hosts too only loses the pattern equal to
+// address. Entries matching address through a wildcard and marked entries
+// are kept.
+func (f *File) Remove(address string) []*Entry {
+	var removed []*Entry
+	for _, e := range f.Entries() {
+		if e.Marker == "" && e.Match(address) {
+			if r := f.RemoveHost(e, address); r != nil {
+				removed = append(removed, r)
+			}
+		}
+	}
+	return removed
+}
+
+// RemoveHost remove address from the hosts of e, the line of e if it has no
+// other host, and return the entry removed, nil if address is not a host of
+// e but matches one of its wildcards
+func (f *File) RemoveHost(e *Entry, address string) *Entry {
+	if e.Hashed() {
+		f.RemoveEntry(e)
+		return e
+	}
+	var hosts []string
+	for _, h := range e.Hosts {
+		if !strings.EqualFold(h, address) {
+			hosts = append(hosts, h)
+		}
+	}
+	switch len(hosts) {
+	case len(e.Hosts):
+		return nil
+	case 0:
+		f.RemoveEntry(e)
+		return e
+	}
+	e.Hosts = hosts
+	for _, l := range f.lines {
+		if l.entry == e {
+			l.text = e.String()
+		}
+	}
+	return &Entry{Line: e.Line, Marker: e.Marker, Hosts: []string{address}, Key: e.Key, Comment: e.Comment}
+}
+
+// RemoveEntry remove the line of e
+func (f *File) RemoveEntry(e *Entry) {
+	for i, l := range f.lines {
+		if l.entry == e {
+			f.lines = append(f.lines[:i], f.lines[i+1:]...)
+			return
+		}
+	}
+}
+
+// Bytes the contents of f
+func (f *File) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, l := range f.lines {
+		buf.WriteString(l.text + "\n")
+	}
+	return buf.Bytes()
+}
+
+// Address the name ssh looks a host up by in known_hosts: host, or
+// [host]:port when port is not 22
+func Address(host, port string) string {
+	if port == "" {
+		port = "22"
+	}
+	return xknownhosts.Normalize(net.JoinHostPort(host, port))
+}
+
+// matchHashed whether the |1|salt|hash entry is for address
+func matchHashed(encoded, address string) bool {
+	parts := strings.Split(encoded, "|")
+	if len(parts) != 4 || parts[1] != "1" {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(address))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+// wildcardMatch match s against pattern, where * matches any run of
+// characters and ? a single one
+func wildcardMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
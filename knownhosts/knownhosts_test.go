@@ -0,0 +1,125 @@
+package knownhosts
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	xknownhosts "golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestAddress(t *testing.T) {
+	tests := []struct{ host, port, want string }{
+		{"example.com", "22", "example.com"},
+		{"example.com", "", "example.com"},
+		{"example.com", "2222", "[example.com]:2222"},
+		{"::1", "2222", "[::1]:2222"},
+	}
+	for _, tt := range tests {
+		if got := Address(tt.host, tt.port); got != tt.want {
+			t.Errorf("Address(%q, %q) = %q, want %q", tt.host, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	key := newKey(t)
+	line := func(hosts string) *Entry {
+		e, err := parseEntry(hosts + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	tests := []struct {
+		hosts, address string
+		want           bool
+	}{
+		{"example.com,10.0.0.1", "10.0.0.1", true},
+		{"Example.COM", "example.com", true},
+		{"example.com", "[example.com]:2222", false},
+		{"[example.com]:2222", "[example.com]:2222", true},
+		{"*.example.com", "web.example.com", true},
+		{"*.example.com,!db.example.com", "db.example.com", false},
+		{"web?", "web1", true},
+		{xknownhosts.HashHostname("[web]:2222"), "[web]:2222", true},
+		{xknownhosts.HashHostname("web"), "db", false},
+	}
+	for _, tt := range tests {
+		if got := line(tt.hosts).Match(tt.address); got != tt.want {
+			t.Errorf("%q.Match(%q) = %v, want %v", tt.hosts, tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestEdit(t *testing.T) {
+	key, other := newKey(t), newKey(t)
+	authorized := func(k ssh.PublicKey) string {
+		return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k)))
+	}
+	data := "# comment\n" +
+		"web,10.0.0.1 " + authorized(key) + " web key\n" +
+		"not a key line\n" +
+		xknownhosts.HashHostname("db") + " " + authorized(other) + "\n" +
+		"@cert-authority *.example.com " + authorized(other) + "\n" +
+		"*.internal " + authorized(key) + "\n"
+	f := Parse("known_hosts", []byte(data))
+	if got := len(f.Entries()); got != 4 {
+		t.Fatalf("got %d entries, want 4", got)
+	}
+	if got := string(f.Bytes()); got != data {
+		t.Fatalf("Bytes() changed the file:\n%s", got)
+	}
+	if e := f.Lookup("db"); len(e) != 1 || e[0].Line != 4 || !e[0].Hashed() {
+		t.Fatalf("Lookup(db) = %v", e)
+	}
+
+	removed := f.Remove("web")
+	if len(removed) != 1 || removed[0].Hosts[0] != "web" {
+		t.Fatalf("Remove(web) = %v", removed)
+	}
+	if e := f.Lookup("10.0.0.1"); len(e) != 1 || e[0].Comment != "web key" {
+		t.Fatalf("10.0.0.1 lost its entry: %v", e)
+	}
+	if removed := f.Remove("db"); len(removed) != 1 {
+		t.Fatalf("Remove(db) = %v", removed)
+	}
+	// through a wildcard or a marker
+	if removed := f.Remove("a.internal"); len(removed) != 0 {
+		t.Fatalf("Remove(a.internal) = %v", removed)
+	}
+	if removed := f.Remove("www.example.com"); len(removed) != 0 {
+		t.Fatalf("Remove(www.example.com) = %v", removed)
+	}
+
+	f.Add("[new]:2222", key, false)
+	f.Add("hashed", key, true)
+	want := "# comment\n" +
+		"10.0.0.1 " + authorized(key) + " web key\n" +
+		"not a key line\n" +
+		"@cert-authority *.example.com " + authorized(other) + "\n" +
+		"*.internal " + authorized(key) + "\n" +
+		"[new]:2222 " + authorized(key) + "\n"
+	got := string(f.Bytes())
+	if !strings.HasPrefix(got, want) {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+	if e := Parse("known_hosts", f.Bytes()).Lookup("hashed"); len(e) != 1 || !e[0].Hashed() {
+		t.Fatalf("Lookup(hashed) = %v", e)
+	}
+}
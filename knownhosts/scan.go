@@ -0,0 +1,54 @@
+package knownhosts
+
+import (
+	"errors"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// scanAlgorithms the host key algorithms Scan asks for, one connection per
+// group, the server picks the first one of a group it has a key for
+var scanAlgorithms = [][]string{
+	{ssh.KeyAlgoED25519},
+	{ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521},
+	{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA},
+}
+
+// errScanned stops the handshake once the host key is known
+var errScanned = errors.New("host key scanned")
+
+// Scan fetch the host keys of the server at address, as ssh-keyscan does:
+// an ed25519, an ecdsa and an rsa key, those the server has. dial opens a
+// new connection to the server, it is called once per kind of key. Only the
+// error of the last attempt is returned, when no key could be fetched.
+func Scan(dial func() (net.Conn, error), address string) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	var lastErr error
+	for _, algorithms := range scanAlgorithms {
+		conn, err := dial()
+		if err != nil {
+			// the server is not reachable, the other kinds fail too
+			return keys, err
+		}
+		var key ssh.PublicKey
+		config := &ssh.ClientConfig{
+			HostKeyAlgorithms: algorithms,
+			HostKeyCallback: func(hostname string, remote net.Addr, k ssh.PublicKey) error {
+				key = k
+				return errScanned
+			},
+		}
+		_, _, _, err = ssh.NewClientConn(conn, address, config)
+		conn.Close()
+		if key != nil {
+			keys = append(keys, key)
+		} else {
+			lastErr = err
+		}
+	}
+	if len(keys) == 0 {
+		return nil, lastErr
+	}
+	return keys, nil
+}
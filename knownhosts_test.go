@@ -0,0 +1,138 @@
+package sshman
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sonnt85/sshman/knownhosts"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestKnownHosts(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	dir := t.TempDir()
+	key := writeTestKey(t, filepath.Join(dir, "id_ed25519"))
+	server := testServer(t, key.PublicKey())
+	host, port, _ := net.SplitHostPort(server)
+	address := knownhosts.Address(host, port)
+
+	p := filepath.Join(dir, "config")
+	kh := filepath.Join(dir, "known_hosts")
+	config := fmt.Sprintf(`Host web
+    HostName %[1]s
+    Port %[2]s
+Host web-alias
+    HostName %[1]s
+    Port %[2]s
+Host db
+    HostName db.example.com
+    HostKeyAlias database
+    ProxyJump admin@bastion.example.com:2222
+Host *
+    UserKnownHostsFile %[3]s
+    IdentityFile %[4]s/id_ed25519
+`, host, port, kh, dir)
+	require.Nil(t, os.WriteFile(p, []byte(config), 0600))
+	require.Equal(t, "database", func() string { h, _ := Resolve(p, "db"); return KnownHostsAddress(h) }())
+
+	// scan adds the key once
+	r, err := ScanKnownHosts(p, "web", ScanOption{Timeout: 3 * time.Second})
+	require.Nil(t, err)
+	require.Equal(t, address, r.Address)
+	require.Equal(t, kh, r.File)
+	require.Len(t, r.Added, 1)
+	require.Equal(t, ssh.KeyAlgoED25519, r.Added[0].KeyType)
+	r, err = ScanKnownHosts(p, "web", ScanOption{Timeout: 3 * time.Second})
+	require.Nil(t, err)
+	require.Empty(t, r.Added)
+	require.Len(t, r.Known, 1)
+
+	// a changed key is reported, then replaced
+	data, err := os.ReadFile(kh)
+	require.Nil(t, err)
+	old := writeTestKey(t, filepath.Join(dir, "old"))
+	stale := address + " " + string(ssh.MarshalAuthorizedKey(old.PublicKey()))
+	orphan := "gone.example.com " + string(ssh.MarshalAuthorizedKey(old.PublicKey()))
+	jump := "[bastion.example.com]:2222 " + string(ssh.MarshalAuthorizedKey(old.PublicKey()))
+	require.Nil(t, os.WriteFile(kh, []byte(stale+orphan+jump+"database "+string(ssh.MarshalAuthorizedKey(old.PublicKey()))), 0600))
+	r, err = ScanKnownHosts(p, "web", ScanOption{Timeout: 3 * time.Second})
+	require.Nil(t, err)
+	require.Empty(t, r.Added)
+	require.Len(t, r.Changed, 1)
+	r, err = ScanKnownHosts(p, "web", ScanOption{Timeout: 3 * time.Second, Replace: true})
+	require.Nil(t, err)
+	require.Len(t, r.Added, 1)
+	require.Len(t, r.Changed, 1)
+	data, err = os.ReadFile(kh)
+	require.Nil(t, err)
+	require.NotContains(t, string(data), stale)
+	require.Contains(t, string(data), orphan)
+
+	known, err := ListKnownHosts(p)
+	require.Nil(t, err)
+	require.Len(t, known, 4)
+	aliases := map[string][]string{}
+	for _, k := range known {
+		aliases[strings.Join(k.Hosts, ",")] = k.Aliases
+	}
+	require.Equal(t, []string{"web", "web-alias"}, aliases[address])
+	require.Empty(t, aliases["gone.example.com"])
+	require.Equal(t, []string{"admin@bastion.example.com:2222"}, aliases["[bastion.example.com]:2222"])
+	require.Equal(t, []string{"db"}, aliases["database"])
+	known, err = ListKnownHosts(p, "db")
+	require.Nil(t, err)
+	require.Len(t, known, 1)
+
+	// prune drops the entries of no alias only
+	pruned, err := PruneKnownHosts(p, true)
+	require.Nil(t, err)
+	require.Len(t, pruned, 1)
+	require.Equal(t, []string{"gone.example.com"}, pruned[0].Hosts)
+	_, err = PruneKnownHosts(p, false)
+	require.Nil(t, err)
+	data, err = os.ReadFile(kh)
+	require.Nil(t, err)
+	require.NotContains(t, string(data), "gone.example.com")
+
+	// web-alias still uses the host of web
+	_, removed, err := DeletePurgeKnownHosts(p, "web")
+	require.Nil(t, err)
+	require.Empty(t, removed)
+	_, removed, err = DeletePurgeKnownHosts(p, "web-alias")
+	require.Nil(t, err)
+	require.Len(t, removed, 1)
+
+	removed, err = RemoveKnownHosts(p, "db")
+	require.Nil(t, err)
+	require.Len(t, removed, 1)
+	data, err = os.ReadFile(kh)
+	require.Nil(t, err)
+	require.Equal(t, jump, string(data))
+}
+
+func TestKnownHostsFiles(t *testing.T) {
+	dir := t.TempDir()
+	key := writeTestKey(t, filepath.Join(dir, "id_ed25519"))
+	host, port, _ := net.SplitHostPort(testServer(t, key.PublicKey()))
+	p := filepath.Join(dir, "config")
+	require.Nil(t, os.WriteFile(p, []byte(fmt.Sprintf("Host web\n    HostName 10.0.0.1\nHost none\n    HostName %s\n    Port %s\n    UserKnownHostsFile none\nHost own\n    UserKnownHostsFile /tmp/a ~/b\n", host, port)), 0600))
+	files := func(alias string) []string {
+		host, err := Resolve(p, alias)
+		require.Nil(t, err)
+		return KnownHostsFiles(host)
+	}
+	home := GetHomeDir()
+	// the defaults of ssh without UserKnownHostsFile
+	require.Equal(t, []string{filepath.Join(home, ".ssh", "known_hosts"), filepath.Join(home, ".ssh", "known_hosts2")}, files("web"))
+	require.Empty(t, files("none"))
+	require.Equal(t, []string{"/tmp/a", filepath.Join(home, "b")}, files("own"))
+
+	_, err := ScanKnownHosts(p, "none", ScanOption{Timeout: 3 * time.Second})
+	require.ErrorContains(t, err, "UserKnownHostsFile is none")
+}
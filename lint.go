@@ -0,0 +1,316 @@
+package sshman
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sonnt85/sshman/sshconfig"
+)
+
+// Severities of a Diagnostic
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Checks of Lint, as reported in Diagnostic.Check
+const (
+	CheckUnknownKeyword  = "unknown-keyword"
+	CheckInvalidValue    = "invalid-value"
+	CheckDeprecated      = "deprecated"
+	CheckShadowed        = "shadowed"
+	CheckDuplicateAlias  = "duplicate-alias"
+	CheckMissingIdentity = "missing-identity"
+)
+
+// Diagnostic a problem Lint found at a line of a config file
+type Diagnostic struct {
+	File     string `json:"file" yaml:"file"`
+	Line     int    `json:"line" yaml:"line"`
+	Severity string `json:"severity" yaml:"severity"`
+	Check    string `json:"check" yaml:"check"`
+	Message  string `json:"message" yaml:"message"`
+}
+
+// String return the diagnostic as file:line: severity: message [check]
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s [%s]", d.File, d.Line, d.Severity, d.Message, d.Check)
+}
+
+// LintOption options for Lint
+type LintOption struct {
+	// Strict report warnings as errors
+	Strict bool
+	// OpenSSH the release of ssh the config is checked for, the latest if
+	// zero. Keywords added later are reported as unknown.
+	OpenSSH sshconfig.Version
+}
+
+// Lint check the config file p and every file it includes. Unknown keywords
+// and invalid values, which make ssh refuse the config, are errors; the
+// other findings are warnings.
+func Lint(p string, o LintOption) ([]*Diagnostic, error) {
+	cfg, err := readFile(p)
+	if err != nil {
+		return nil, err
+	}
+	l := &linter{
+		target:  o.OpenSSH,
+		files:   map[string]int{},
+		global:  map[string]*lintOrigin{},
+		blocks:  map[*sshconfig.Host]*lintBlock{},
+		aliases: map[string]*lintOrigin{},
+		// encoded as [] when there is nothing to report
+		diagnostics: []*Diagnostic{},
+	}
+	walkNodes(p, cfg, true, l.visit)
+	l.finish()
+
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		a, b := l.diagnostics[i], l.diagnostics[j]
+		if a.File != b.File {
+			return l.files[a.File] < l.files[b.File]
+		}
+		return a.Line < b.Line
+	})
+	if o.Strict {
+		for _, d := range l.diagnostics {
+			d.Severity = SeverityError
+		}
+	}
+	return l.diagnostics, nil
+}
+
+// walkNodes call fn for every Host line, with a nil node, and every node of
+// cfg and the files it includes, in the order ssh reads them. all tells
+// whether the block applies to every host.
+func walkNodes(fp string, cfg *sshconfig.Config, all bool, fn func(fp string, host *sshconfig.Host, all bool, node sshconfig.Node)) {
+	for i, host := range cfg.Hosts {
+		// the lines before the first Host line of an included file belong to
+		// the block of the Include
+		hostAll := all
+		if i > 0 {
+			hostAll = matchesAll(host)
+			fn(fp, host, hostAll, nil)
+		}
+		for _, node := range host.Nodes {
+			fn(fp, host, hostAll, node)
+			if inc, ok := node.(*sshconfig.Include); ok {
+				files := inc.GetFiles()
+				for _, path := range inc.Files() {
+					walkNodes(path, files[path], hostAll, fn)
+				}
+			}
+		}
+	}
+}
+
+// matchesAll tell whether the block applies to every host
+func matchesAll(host *sshconfig.Host) bool {
+	if host.Match != nil {
+		return len(host.Match.Criteria) == 1 && strings.EqualFold(host.Match.Criteria[0].Name, "all")
+	}
+	star := false
+	for _, p := range host.Patterns {
+		if p.Negated() {
+			return false
+		}
+		star = star || p.String() == "*"
+	}
+	return star
+}
+
+// lintOrigin where a keyword or an alias was first seen
+type lintOrigin struct {
+	file   string
+	line   int
+	header string
+}
+
+func (o *lintOrigin) String() string {
+	return fmt.Sprintf("%s:%d", o.file, o.line)
+}
+
+// lintBlock what the linter knows of a Host or Match block
+type lintBlock struct {
+	file     string
+	header   string
+	line     int
+	seen     map[string]*lintOrigin
+	kvs      int
+	shadowed []*Diagnostic
+}
+
+type linter struct {
+	target sshconfig.Version
+	// files the order files are read in
+	files map[string]int
+	// global the first-wins keywords set by blocks matching every host
+	global  map[string]*lintOrigin
+	blocks  map[*sshconfig.Host]*lintBlock
+	order   []*lintBlock
+	aliases map[string]*lintOrigin
+	// ignore holds the patterns of IgnoreUnknown
+	ignore      sshconfig.Host
+	diagnostics []*Diagnostic
+}
+
+func (l *linter) report(fp string, line int, severity, check, format string, args ...interface{}) *Diagnostic {
+	d := &Diagnostic{File: fp, Line: line, Severity: severity, Check: check, Message: fmt.Sprintf(format, args...)}
+	l.diagnostics = append(l.diagnostics, d)
+	return d
+}
+
+func (l *linter) block(fp string, host *sshconfig.Host) *lintBlock {
+	b, ok := l.blocks[host]
+	if !ok {
+		b = &lintBlock{file: fp, header: hostHeader(host), line: host.Pos().Line, seen: map[string]*lintOrigin{}}
+		l.blocks[host] = b
+		l.order = append(l.order, b)
+	}
+	return b
+}
+
+func (l *linter) visit(fp string, host *sshconfig.Host, all bool, node sshconfig.Node) {
+	if _, ok := l.files[fp]; !ok {
+		l.files[fp] = len(l.files)
+	}
+	b := l.block(fp, host)
+	if node == nil {
+		l.visitHost(fp, host)
+		return
+	}
+	kv, ok := node.(*sshconfig.KV)
+	if !ok {
+		return
+	}
+	line := kv.Pos().Line
+	b.kvs++
+	spec := sshconfig.LookupKeyword(kv.Key)
+	if spec == nil || !spec.Available(l.target) {
+		if l.ignored(kv.Key) {
+			return
+		}
+		if spec != nil {
+			l.report(fp, line, SeverityError, CheckUnknownKeyword, "%s needs OpenSSH %s or later, the target is %s", spec.Name, spec.Since, l.target)
+		} else if suggestion := sshconfig.Suggest(kv.Key); suggestion != "" {
+			l.report(fp, line, SeverityError, CheckUnknownKeyword, "unknown keyword %q, did you mean %q?", kv.Key, suggestion)
+		} else {
+			l.report(fp, line, SeverityError, CheckUnknownKeyword, "unknown keyword %q", kv.Key)
+		}
+		return
+	}
+	name := spec.Name
+	if spec.IsDeprecated(l.target) {
+		l.report(fp, line, SeverityWarning, CheckDeprecated, "%s is deprecated: %s", name, spec.Note)
+	}
+	args := kv.Args()
+	if err := spec.Check(args); err != nil {
+		l.report(fp, line, SeverityError, CheckInvalidValue, "%v", err)
+	}
+
+	key := strings.ToLower(name)
+	switch key {
+	case "ignoreunknown":
+		for _, arg := range args {
+			for _, s := range strings.Split(arg, ",") {
+				if pattern, err := sshconfig.NewPattern(s); err == nil {
+					l.ignore.Patterns = append(l.ignore.Patterns, pattern)
+				}
+			}
+		}
+	case "identityfile":
+		if len(args) > 0 {
+			if path, ok := identityPath(args[0]); ok {
+				if _, err := os.Stat(path); os.IsNotExist(err) {
+					l.report(fp, line, SeverityWarning, CheckMissingIdentity, "IdentityFile %s does not exist", args[0])
+				}
+			}
+		}
+	}
+
+	if spec.Multi {
+		return
+	}
+	origin := &lintOrigin{file: fp, line: line, header: b.header}
+	if first, ok := l.global[key]; ok {
+		b.shadowed = append(b.shadowed, &Diagnostic{File: fp, Line: line, Severity: SeverityWarning, Check: CheckShadowed,
+			Message: fmt.Sprintf("%s is never used, %s at %s sets it first", name, first.header, first)})
+	} else if first, ok := b.seen[key]; ok {
+		l.report(fp, line, SeverityWarning, CheckShadowed, "%s is never used, it is set first at line %d", name, first.line)
+	} else {
+		b.seen[key] = origin
+		if all {
+			l.global[key] = origin
+		}
+	}
+}
+
+func (l *linter) visitHost(fp string, host *sshconfig.Host) {
+	if host.Match != nil {
+		return
+	}
+	for _, p := range host.Patterns {
+		alias := p.String()
+		if p.Negated() || strings.ContainsAny(alias, "*?") {
+			continue
+		}
+		origin := &lintOrigin{file: fp, line: host.Pos().Line}
+		if first, ok := l.aliases[alias]; !ok {
+			l.aliases[alias] = origin
+		} else if first.file != fp {
+			l.report(fp, origin.line, SeverityWarning, CheckDuplicateAlias, "alias %s is also declared at %s", alias, first)
+		}
+	}
+}
+
+// finish report the blocks whose every value is never used as a whole
+func (l *linter) finish() {
+	for _, b := range l.order {
+		if b.line > 0 && b.kvs > 0 && len(b.shadowed) == b.kvs {
+			l.report(b.file, b.line, SeverityWarning, CheckShadowed, "%s is never used, every option it sets is set first by an earlier block", b.header)
+			continue
+		}
+		l.diagnostics = append(l.diagnostics, b.shadowed...)
+	}
+}
+
+func (l *linter) ignored(key string) bool {
+	return l.ignore.Matches(key) || l.ignore.Matches(strings.ToLower(key))
+}
+
+// hostHeader return the Host or Match line of host, without comment
+func hostHeader(host *sshconfig.Host) string {
+	if host.Match != nil {
+		var criteria []string
+		for _, c := range host.Match.Criteria {
+			criteria = append(criteria, c.String())
+		}
+		return "Match " + strings.Join(criteria, " ")
+	}
+	var patterns []string
+	for _, p := range host.Patterns {
+		patterns = append(patterns, p.String())
+	}
+	return "Host " + strings.Join(patterns, " ")
+}
+
+// identityPath expand ~, %d and %u in an IdentityFile, ok is false if it
+// holds other tokens, which depend on the host
+func identityPath(s string) (string, bool) {
+	if strings.EqualFold(s, "none") {
+		return "", false
+	}
+	home := GetHomeDir()
+	if s == "~" || strings.HasPrefix(s, "~/") {
+		s = filepath.Join(home, s[1:])
+	}
+	s = strings.NewReplacer("%d", home, "%u", GetUsername(), "%%", "%").Replace(s)
+	if strings.Contains(s, "%") || strings.Contains(s, "${") {
+		return "", false
+	}
+	return s, true
+}
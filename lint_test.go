@@ -0,0 +1,82 @@
+package sshman
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sonnt85/sshman/sshconfig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "config")
+	other := filepath.Join(dir, "other")
+	key := filepath.Join(dir, "id_web")
+	require.Nil(t, os.WriteFile(key, nil, 0600))
+	require.Nil(t, os.WriteFile(other, []byte("Host web\n    Port 2222\n"), 0600))
+	require.Nil(t, os.WriteFile(main, []byte(fmt.Sprintf(`IgnoreUnknown UseSomething
+UseSomething yes
+Host *
+    User admin
+    StrictHostKeyChecking maybe
+    RSAAuthentication yes
+Host web
+    Hostnme 10.0.0.1
+    IdentityFile %s
+    IdentityFile %s/missing
+Host db
+    Port 22
+    port 23
+Host legacy
+    User other
+Include %s
+`, key, dir, other)), 0600))
+
+	diagnostics, err := Lint(main, LintOption{})
+	require.Nil(t, err)
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, fmt.Sprintf("%s:%d %s %s", filepath.Base(d.File), d.Line, d.Severity, d.Check))
+	}
+	require.Equal(t, []string{
+		"config:5 error invalid-value",
+		"config:6 warning deprecated",
+		"config:8 error unknown-keyword",
+		"config:10 warning missing-identity",
+		"config:13 warning shadowed",
+		"config:14 warning shadowed",
+		"other:1 warning duplicate-alias",
+	}, got)
+	require.Equal(t, `unknown keyword "Hostnme", did you mean "HostName"?`, diagnostics[2].Message)
+	require.Equal(t, "Port is never used, it is set first at line 12", diagnostics[4].Message)
+	require.Equal(t, "Host legacy is never used, every option it sets is set first by an earlier block", diagnostics[5].Message)
+	require.Equal(t, fmt.Sprintf("%s:8: error: unknown keyword \"Hostnme\", did you mean \"HostName\"? [unknown-keyword]", main), diagnostics[2].String())
+
+	diagnostics, err = Lint(main, LintOption{Strict: true})
+	require.Nil(t, err)
+	for _, d := range diagnostics {
+		require.Equal(t, SeverityError, d.Severity)
+	}
+}
+
+func TestLintOpenSSH(t *testing.T) {
+	main := filepath.Join(t.TempDir(), "config")
+	require.Nil(t, os.WriteFile(main, []byte(`Host web
+    ProxyJump bastion
+    ChallengeResponseAuthentication no
+`), 0600))
+
+	diagnostics, err := Lint(main, LintOption{OpenSSH: sshconfig.Version{Major: 7, Minor: 2}})
+	require.Nil(t, err)
+	require.Len(t, diagnostics, 1)
+	require.Equal(t, CheckUnknownKeyword, diagnostics[0].Check)
+	require.Equal(t, "ProxyJump needs OpenSSH 7.3 or later, the target is 7.2", diagnostics[0].Message)
+
+	diagnostics, err = Lint(main, LintOption{})
+	require.Nil(t, err)
+	require.Len(t, diagnostics, 1)
+	require.Equal(t, CheckDeprecated, diagnostics[0].Check)
+}
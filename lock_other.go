@@ -0,0 +1,19 @@
+//go:build !unix
+
+package sshman
+
+import "os"
+
+// advisory locks are not supported, writes are still atomic
+
+func flock(f *os.File) error {
+	return nil
+}
+
+func funlock(f *os.File) error {
+	return nil
+}
+
+func chown(f *os.File, info os.FileInfo) error {
+	return nil
+}
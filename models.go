@@ -2,8 +2,9 @@ package sshman
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
-	"github.com/fatih/color"
 	"github.com/sonnt85/sshman/sshconfig"
 )
 
@@ -19,6 +20,8 @@ type HostConfig struct {
 	OwnConfig map[string]string
 	// ImplicitConfig implicit config
 	ImplicitConfig map[string]string
+	// Settings every value ssh uses for the alias, in the order it reads them
+	Settings []*sshconfig.Setting
 }
 
 // NewHostConfig new HostConfig
@@ -32,42 +35,39 @@ func NewHostConfig(alias, path string, host *sshconfig.Host) *HostConfig {
 	}
 }
 
-// ConnectionStr return the connection string
-func (hc *HostConfig) ConnectionStr() string {
-	if !hc.Display() {
-		return ""
-	}
-
-	var (
-		user, hostname, port string
-		ok                   bool
-	)
+// Connection return the user, hostname and port ssh connects with
+func (hc *HostConfig) Connection() (user, hostname, port string) {
+	return hc.value("user"), hc.value("hostname"), hc.value("port")
+}
 
-	if user, ok = hc.OwnConfig["user"]; !ok {
-		user = hc.ImplicitConfig["user"]
-		delete(hc.ImplicitConfig, "user")
-	} else {
-		user = color.GreenString(user)
-		delete(hc.OwnConfig, "user")
+// value return the own value of key, or the implicit one
+func (hc *HostConfig) value(key string) string {
+	if v, ok := hc.OwnConfig[key]; ok {
+		return v
 	}
+	return hc.ImplicitConfig[key]
+}
 
-	if hostname, ok = hc.OwnConfig["hostname"]; !ok {
-		delete(hc.ImplicitConfig, "hostname")
-		hostname = hc.ImplicitConfig["hostname"]
-	} else {
-		hostname = color.GreenString(hostname)
-		delete(hc.OwnConfig, "hostname")
+// ConnectionStr return the connection string, user@hostname:port
+func (hc *HostConfig) ConnectionStr() string {
+	if !hc.Display() {
+		return ""
 	}
+	user, hostname, port := hc.Connection()
+	return fmt.Sprintf("%s@%s:%s", user, hostname, port)
+}
 
-	if port, ok = hc.OwnConfig["port"]; !ok {
-		port = hc.ImplicitConfig["port"]
-		delete(hc.ImplicitConfig, "port")
-	} else {
-		port = color.GreenString(port)
-		delete(hc.OwnConfig, "port")
+// Comment return the comment of the Host line of the alias, from the file it
+// is found in first
+func (hc *HostConfig) Comment() string {
+	for _, fp := range hc.Paths() {
+		for _, host := range hc.PathMap[fp] {
+			if host != nil && host.EOLComment != "" {
+				return strings.TrimSpace(host.EOLComment)
+			}
+		}
 	}
-
-	return fmt.Sprintf("%s%s%s%s%s", user, color.GreenString("@"), hostname, color.GreenString(":"), port)
+	return ""
 }
 
 // Display Whether to display connection string
@@ -79,3 +79,142 @@ func (hc *HostConfig) Display() bool {
 
 	return hostname != ""
 }
+
+// Get return the value ssh uses for key, the first one for multi-valued keys
+func (hc *HostConfig) Get(key string) string {
+	if values := hc.Values(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Values return every value ssh uses for key
+func (hc *HostConfig) Values(key string) []string {
+	key = strings.ToLower(key)
+	var values []string
+	for _, s := range hc.Settings {
+		if s.Key == key {
+			values = append(values, s.Value)
+		}
+	}
+	return values
+}
+
+// IsOwn whether the setting is read from one of the alias's own blocks
+func (hc *HostConfig) IsOwn(s *sshconfig.Setting) bool {
+	for _, hosts := range hc.PathMap {
+		for _, host := range hosts {
+			if host == s.Host {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Origin return where the setting comes from, "file:line" or "injected default"
+// for the values sshman assumes when no file sets them
+func Origin(s *sshconfig.Setting) string {
+	if s.Source.File == "" {
+		return "injected default"
+	}
+	return fmt.Sprintf("%s:%d", s.Source.File, s.Source.Position.Line)
+}
+
+// HostOutput the machine readable form of a HostConfig, its fields are stable
+type HostOutput struct {
+	// Alias alias
+	Alias string `json:"alias" yaml:"alias"`
+	// Paths files declaring the alias, the one it is found in first
+	Paths []string `json:"paths" yaml:"paths"`
+	// Own config of the alias's own blocks, every value of multi-valued keys
+	Own map[string][]string `json:"own" yaml:"own"`
+	// Inherited config of other blocks and defaults
+	Inherited map[string][]string `json:"inherited" yaml:"inherited"`
+	// Connection the user, hostname and port ssh connects with
+	Connection ConnectionOutput `json:"connection" yaml:"connection"`
+	// Certificates the certificates ssh uses for the alias
+	Certificates []*CertInfo `json:"certificates,omitempty" yaml:"certificates,omitempty"`
+}
+
+// ConnectionOutput the user, hostname and port of a HostOutput
+type ConnectionOutput struct {
+	User string `json:"user" yaml:"user"`
+	Host string `json:"host" yaml:"host"`
+	Port string `json:"port" yaml:"port"`
+}
+
+// Output return the machine readable form of hc
+func (hc *HostConfig) Output() *HostOutput {
+	out := &HostOutput{
+		Alias:     hc.Alias,
+		Paths:     hc.Paths(),
+		Own:       map[string][]string{},
+		Inherited: map[string][]string{},
+	}
+	for _, s := range hc.Settings {
+		config := out.Inherited
+		if hc.IsOwn(s) {
+			config = out.Own
+		}
+		config[s.Key] = append(config[s.Key], s.Value)
+	}
+	// a HostConfig that was not resolved has no Settings
+	if hc.Settings == nil {
+		for k, v := range hc.OwnConfig {
+			out.Own[k] = []string{v}
+		}
+		for k, v := range hc.ImplicitConfig {
+			out.Inherited[k] = []string{v}
+		}
+	}
+	out.Connection.User, out.Connection.Host, out.Connection.Port = hc.Connection()
+	out.Certificates = hc.Certificates()
+	return out
+}
+
+// Paths return the files declaring the alias, the one it is found in first
+// and the others sorted
+func (hc *HostConfig) Paths() []string {
+	paths := []string{}
+	if hc.Path != "" {
+		paths = append(paths, hc.Path)
+	}
+	var others []string
+	for fp := range hc.PathMap {
+		if fp != hc.Path {
+			others = append(others, fp)
+		}
+	}
+	sort.Strings(others)
+	return append(paths, others...)
+}
+
+// OptionOutput the machine readable form of an option of an alias
+type OptionOutput struct {
+	// Alias alias
+	Alias string `json:"alias" yaml:"alias"`
+	// Key option name, in lower case
+	Key string `json:"key" yaml:"key"`
+	// Values every value ssh uses, one unless the option is multi-valued
+	Values []string `json:"values" yaml:"values"`
+	// Sources where every value comes from, see Origin
+	Sources []string `json:"sources" yaml:"sources"`
+}
+
+// Option return the machine readable form of the option key of hc, nil if
+// ssh uses no value for it
+func (hc *HostConfig) Option(key string) *OptionOutput {
+	key = strings.ToLower(key)
+	out := &OptionOutput{Alias: hc.Alias, Key: key}
+	for _, s := range hc.Settings {
+		if s.Key == key {
+			out.Values = append(out.Values, s.Value)
+			out.Sources = append(out.Sources, Origin(s))
+		}
+	}
+	if len(out.Values) == 0 {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package sshman
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionStr(t *testing.T) {
+	initConfig()
+	defer os.Remove(configRootDir)
+
+	host, err := Resolve(mainConfigPath, "main2")
+	require.Nil(t, err)
+	own := len(host.OwnConfig)
+	implicit := len(host.ImplicitConfig)
+
+	require.Equal(t, "wen@192.168.2.20:22022", host.ConnectionStr())
+	require.Equal(t, host.ConnectionStr(), host.ConnectionStr())
+	require.False(t, strings.Contains(host.ConnectionStr(), "\x1b"), "connection string has escape codes")
+	require.Equal(t, own, len(host.OwnConfig))
+	require.Equal(t, implicit, len(host.ImplicitConfig))
+}
+
+func TestHostOutput(t *testing.T) {
+	initConfig()
+	defer os.Remove(configRootDir)
+
+	host, err := Resolve(mainConfigPath, "main2")
+	require.Nil(t, err)
+	data, err := json.Marshal(host.Output())
+	require.Nil(t, err)
+	want := `{"alias":"main2","paths":["` + testConfigPath + `","` + mainConfigPath + `"],` +
+		`"own":{"hostname":["192.168.2.20"],"user":["wen"]},"inherited":{"port":["22022"]},` +
+		`"connection":{"user":"wen","host":"192.168.2.20","port":"22022"}}`
+	require.Equal(t, want, string(data))
+
+	option := host.Option("Port")
+	require.NotNil(t, option)
+	require.Equal(t, []string{"22022"}, option.Values)
+	require.Equal(t, []string{testConfigPath + ":3"}, option.Sources)
+	require.Nil(t, host.Option("proxyjump"))
+
+	// every value of multi-valued keys
+	p := filepath.Join(t.TempDir(), "config")
+	require.Nil(t, os.WriteFile(p, []byte("Host web\n    HostName 10.0.0.1\n    IdentityFile ~/.ssh/id_web\n    IdentityFile ~/.ssh/id_old\nHost *\n    IdentityFile ~/.ssh/id_all\n    LocalForward 8080 localhost:80\n"), 0600))
+	host, err = Resolve(p, "web")
+	require.Nil(t, err)
+	out := host.Output()
+	require.Equal(t, []string{"~/.ssh/id_web", "~/.ssh/id_old"}, out.Own["identityfile"])
+	require.Equal(t, []string{"~/.ssh/id_all"}, out.Inherited["identityfile"])
+	require.Equal(t, []string{"8080 localhost:80"}, out.Inherited["localforward"])
+}
+
+func TestParseTemplate(t *testing.T) {
+	initConfig()
+	defer os.Remove(configRootDir)
+
+	host, err := Resolve(mainConfigPath, "main2")
+	require.Nil(t, err)
+	tmpl, err := ParseTemplate(`{{.Alias}}\t{{.Get "hostname"}}\t{{get . "Port"}}\t{{own . "user"}}\t{{inherited . "port"}}\t{{connection .}}\n`)
+	require.Nil(t, err)
+	var buf strings.Builder
+	require.Nil(t, tmpl.Execute(&buf, host))
+	require.Equal(t, "main2\t192.168.2.20\t22022\twen\t22022\twen@192.168.2.20:22022\n", buf.String())
+
+	tmpl, err = ParseTemplate(`{{range files .}}{{.}} {{end}}`)
+	require.Nil(t, err)
+	buf.Reset()
+	require.Nil(t, tmpl.Execute(&buf, host))
+	require.Equal(t, testConfigPath+" "+mainConfigPath+" ", buf.String())
+
+	// the escapes of the string literals are left to the template
+	tmpl, err = ParseTemplate(`{{printf "%s\t%s\n" .Alias "}}\"\n"}}-{{'\n' | printf "%d"}}\n`)
+	require.Nil(t, err)
+	buf.Reset()
+	require.Nil(t, tmpl.Execute(&buf, host))
+	require.Equal(t, "main2\t}}\"\n\n-10\n", buf.String())
+}
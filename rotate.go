@@ -0,0 +1,398 @@
+package sshman
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sonnt85/sshman/sshconfig"
+	"golang.org/x/crypto/ssh"
+)
+
+// Steps of a key rotation, the last one a RotateResult went through
+const (
+	RotatePending    = "pending"
+	RotateGenerated  = "generated"
+	RotateInstalled  = "installed"
+	RotateVerified   = "verified"
+	RotateConfigured = "configured"
+	RotateDone       = "done"
+)
+
+// RotateOption options for RotateKeys
+type RotateOption struct {
+	// Key the type, bits and comment of the new keys
+	Key KeyOption
+	// Password ask for the password of an alias with prompt when the server
+	// does not accept its keys, no password is tried if nil
+	Password func(prompt string) (string, error)
+	// Timeout the time the rotation of an alias may take, 30s if not set
+	Timeout time.Duration
+	// KeepOld leave the old public key in the remote authorized_keys
+	KeepOld bool
+	// AcceptNew trust and record the host keys that are not in known_hosts
+	// yet, changed keys are refused still
+	AcceptNew bool
+}
+
+// RotateResult the state of the key rotation of an alias
+type RotateResult struct {
+	Alias   string `json:"alias" yaml:"alias"`
+	Address string `json:"address,omitempty" yaml:"address,omitempty"`
+	// OldKey the private key replaced, it is left on disk
+	OldKey string `json:"old_key" yaml:"old_key"`
+	// NewKey the private key generated
+	NewKey      string `json:"new_key" yaml:"new_key"`
+	Fingerprint string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	// Step the last step done, one of the Rotate constants
+	Step string `json:"step" yaml:"step"`
+	// File the config file whose IdentityFile was updated
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+	// Removed whether the old key was removed from the remote authorized_keys
+	Removed bool `json:"removed" yaml:"removed"`
+	// Kept why the old key was left in the remote authorized_keys
+	Kept  string `json:"kept,omitempty" yaml:"kept,omitempty"`
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// RotateStatePath the file the unfinished rotations of the config file p are
+// saved to
+func RotateStatePath(p string) string {
+	return p + ".rotate.json"
+}
+
+// PendingRotations the aliases whose rotation did not finish, sorted
+func PendingRotations(p string) ([]string, error) {
+	state, err := loadRotateState(RotateStatePath(p))
+	if err != nil {
+		return nil, err
+	}
+	aliases := make([]string, 0, len(state))
+	for alias := range state {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases, nil
+}
+
+func loadRotateState(path string) (map[string]*RotateResult, error) {
+	state := map[string]*RotateResult{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return state, nil
+}
+
+// saveRotateState write state to path, or remove path once state is empty
+func saveRotateState(path string, state map[string]*RotateResult) error {
+	if len(state) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// RotateKeys replace the key of aliases of the config file p with a new one:
+// the key is generated, added to the remote authorized_keys with the old
+// key, checked to log in alone, set as IdentityFile in place of the old key,
+// and the old key is removed from authorized_keys. The step each alias
+// reached is saved to RotateStatePath until its rotation is done, the
+// rotations that failed continue from there when RotateKeys runs again.
+// The host keys are verified as DeployKey does.
+func RotateKeys(p string, aliases []string, o RotateOption) ([]*RotateResult, error) {
+	if o.Timeout <= 0 {
+		o.Timeout = 30 * time.Second
+	}
+	if o.Key.Type == "" {
+		o.Key.Type = KeyEd25519
+	}
+	if o.Key.Comment == "" {
+		o.Key.Comment = defaultKeyComment()
+	}
+	_, aliasMap, err := parseConfig(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAlias(aliasMap, true, aliases...); err != nil {
+		return nil, err
+	}
+	statePath := RotateStatePath(p)
+	state, err := loadRotateState(statePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*RotateResult
+	for _, alias := range aliases {
+		r, ok := state[alias]
+		if !ok {
+			r = &RotateResult{Alias: alias}
+		}
+		r.Error = ""
+		save := func() error {
+			state[alias] = r
+			return saveRotateState(statePath, state)
+		}
+		if err := rotateKey(p, r, o, save); err != nil {
+			r.Error = err.Error()
+		} else {
+			delete(state, alias)
+		}
+		if err := saveRotateState(statePath, state); err != nil {
+			return results, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// rotateKey run the steps of the rotation of r after the one it reached,
+// calling save after each of them
+func rotateKey(p string, r *RotateResult, o RotateOption, save func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), o.Timeout)
+	defer cancel()
+	check := hostKeysVerified
+	if o.AcceptNew {
+		check = hostKeysAcceptNew
+	}
+	ac, err := dialAlias(ctx, p, r.Alias, check)
+	if err != nil {
+		return err
+	}
+	defer ac.close()
+	r.Address = ac.target.addr
+
+	if r.Step == "" {
+		old, err := deployKeyPath(ac.host)
+		if err != nil {
+			return err
+		}
+		r.OldKey = filepath.Clean(old)
+		r.NewKey = KeyPath(r.Alias, o.Key.Type) + "-" + time.Now().Format("20060102")
+		if r.NewKey == r.OldKey {
+			return fmt.Errorf("alias[%s] uses %s already", r.Alias, r.NewKey)
+		}
+		r.Step = RotatePending
+		if err := save(); err != nil {
+			return err
+		}
+	}
+	if r.Step == RotatePending {
+		// the key may be written already if the state could not be saved
+		if _, err := os.Stat(r.NewKey); err != nil {
+			if _, err := GenerateKey(r.NewKey, o.Key); err != nil {
+				return err
+			}
+		}
+		r.Step = RotateGenerated
+		if err := save(); err != nil {
+			return err
+		}
+	}
+	_, pub, line, err := publicKeyFile(r.NewKey)
+	if err != nil {
+		return err
+	}
+	r.Fingerprint = ssh.FingerprintSHA256(pub)
+
+	if r.Step == RotateGenerated {
+		client, err := ac.login(ctx, nil, passwordMethods(ac.target.user, ac.target.addr, o.Password)...)
+		if err != nil {
+			return err
+		}
+		_, err = runRemote(client, authorizeScript(pub, line))
+		client.Close()
+		if err != nil {
+			return fmt.Errorf("cannot update authorized_keys: %v", err)
+		}
+		r.Step = RotateInstalled
+		if err := save(); err != nil {
+			return err
+		}
+	}
+
+	signer, closeSigner, err := keySigner(r.NewKey, pub)
+	if err != nil {
+		return err
+	}
+	defer closeSigner()
+	auth := []ssh.AuthMethod{ssh.PublicKeys(signer)}
+	if r.Step == RotateInstalled {
+		client, err := ac.login(ctx, auth)
+		if err != nil {
+			return fmt.Errorf("the server does not accept the new key: %v", err)
+		}
+		client.Close()
+		r.Step = RotateVerified
+		if err := save(); err != nil {
+			return err
+		}
+	}
+	if r.Step == RotateVerified {
+		if r.File, err = setRotatedKey(p, r.Alias, r.OldKey, r.NewKey); err != nil {
+			return err
+		}
+		r.Step = RotateConfigured
+		if err := save(); err != nil {
+			return err
+		}
+	}
+	if r.Step == RotateConfigured {
+		users, err := oldKeyUsers(p, r.Alias, r.OldKey, ac.target)
+		if err != nil {
+			return err
+		}
+		if len(users) > 0 {
+			r.Kept = fmt.Sprintf("used by %s for the same account", strings.Join(users, ", "))
+		} else if !o.KeepOld {
+			_, old, _, err := publicKeyFile(r.OldKey)
+			if err != nil {
+				return err
+			}
+			client, err := ac.login(ctx, auth)
+			if err != nil {
+				return err
+			}
+			out, err := runRemote(client, unauthorizeScript(old))
+			client.Close()
+			if err != nil {
+				return fmt.Errorf("cannot remove the old key from authorized_keys: %v", err)
+			}
+			r.Removed = out == "removed"
+		}
+		r.Step = RotateDone
+	}
+	return nil
+}
+
+// oldKeyUsers the aliases of the config file p other than alias that still
+// use key to log in as the user and at the address of e, sorted
+func oldKeyUsers(p, alias, key string, e *endpoint) ([]string, error) {
+	_, aliasMap, err := parseConfig(p)
+	if err != nil {
+		return nil, err
+	}
+	defaults := strings.Fields(sshconfig.Default("IdentityFile"))
+	var users []string
+	for name, host := range aliasMap {
+		if name == alias || strings.ContainsAny(name, "*?!") {
+			continue
+		}
+		files := host.Values("identityfile")
+		if len(files) == 0 {
+			files = defaults
+		}
+		for _, file := range files {
+			if path, ok := identityPath(file); ok && filepath.Clean(path) == key {
+				if he := newEndpoint(host); he.user == e.user && he.addr == e.addr {
+					users = append(users, name)
+				}
+				break
+			}
+		}
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+// unauthorizeScript the shell script removing the lines of key from
+// ~/.ssh/authorized_keys, keeping the mode of the file. It prints removed or
+// absent.
+func unauthorizeScript(key ssh.PublicKey) string {
+	blob := shellQuote(keyBlob(key))
+	return `cd || exit 1
+[ -f .ssh/authorized_keys ] && grep -qF ` + blob + ` .ssh/authorized_keys || { echo absent; exit 0; }
+umask 077
+grep -vF ` + blob + ` .ssh/authorized_keys > .ssh/authorized_keys.sshman; [ $? -le 1 ] || exit 1
+cat .ssh/authorized_keys.sshman > .ssh/authorized_keys && rm -f .ssh/authorized_keys.sshman && echo removed`
+}
+
+// setRotatedKey replace the IdentityFile oldKey of an alias of the config
+// file p with newKey and return the file changed. The line is edited in the
+// block of the alias that sets it; when the old key is set by a block shared
+// with other hosts, the new key is added to the alias's own block instead.
+func setRotatedKey(p, alias, oldKey, newKey string) (string, error) {
+	tx, err := Begin(p)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	if err := checkAlias(tx.aliasMap, true, alias); err != nil {
+		return "", err
+	}
+	hc, err := tx.host(alias)
+	if err != nil {
+		return "", err
+	}
+	// blockFile the file of the own block of the alias host, if host holds
+	// no other pattern
+	blockFile := func(host *sshconfig.Host) string {
+		for _, fp := range hc.Paths() {
+			for _, h := range hc.PathMap[fp] {
+				if h != nil && h == host && len(h.Patterns) == 1 {
+					return fp
+				}
+			}
+		}
+		return ""
+	}
+	value := sshconfig.QuoteArg(homePath(newKey))
+	var oldFound bool
+	for _, s := range hc.Settings {
+		if s.Key != "identityfile" || s.KV == nil {
+			continue
+		}
+		path, ok := identityPath(s.Value)
+		if !ok {
+			continue
+		}
+		switch filepath.Clean(path) {
+		case newKey:
+			// set by a previous run already
+			return s.Source.File, nil
+		case oldKey:
+			if oldFound {
+				continue
+			}
+			oldFound = true
+			if fp := blockFile(s.Host); fp != "" {
+				s.KV.Value = value
+				tx.dirty[fp] = true
+				return fp, tx.Commit()
+			}
+		}
+	}
+	for _, fp := range hc.Paths() {
+		for _, host := range hc.PathMap[fp] {
+			if host != nil && len(host.Patterns) == 1 && host.Find("identityfile") == nil {
+				host.Set("identityfile", value)
+				tx.dirty[fp] = true
+				return fp, tx.Commit()
+			}
+		}
+	}
+	return "", fmt.Errorf("alias[%s] has no block of its own to set IdentityFile %s in", alias, value)
+}
@@ -0,0 +1,208 @@
+package sshman
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sonnt85/sshman/knownhosts"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestRotateKeys(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	defer func(dir string) { KeyDir = dir }(KeyDir)
+	dir := t.TempDir()
+	KeyDir = filepath.Join(dir, "keys")
+	require.Nil(t, os.MkdirAll(KeyDir, 0700))
+	old := writeTestKey(t, filepath.Join(KeyDir, "id_old"))
+	oldLine := string(ssh.MarshalAuthorizedKey(old.PublicKey()))
+
+	// a server for web and one for api, both accepting the old key
+	var addrs []string
+	var homes []string
+	for _, name := range []string{"web", "api"} {
+		home := filepath.Join(dir, name)
+		require.Nil(t, os.MkdirAll(filepath.Join(home, ".ssh"), 0700))
+		require.Nil(t, os.WriteFile(filepath.Join(home, ".ssh", "authorized_keys"), []byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPrKdy1ClGbNqLUkeXCjl+6VRWGAAWzNlW1mwpOJrHMc other\n"+oldLine), 0600))
+		addrs = append(addrs, newTestServer(t, testServerOption{Home: home}))
+		homes = append(homes, home)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	closed := l.Addr().String()
+	l.Close()
+
+	p := filepath.Join(dir, "config")
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "conf.d"), 0700))
+	host, port, _ := net.SplitHostPort(addrs[1])
+	require.Nil(t, os.WriteFile(p, []byte(fmt.Sprintf(`Include %[1]s/conf.d/*
+Host api
+    HostName %[2]s
+    Port %[3]s
+Host down
+    HostName 127.0.0.1
+    Port %[4]s
+Host *
+    User deploy
+    IdentityFile %[5]s/id_old
+    UserKnownHostsFile %[1]s/known_hosts
+`, dir, host, port, strings.Split(closed, ":")[1], KeyDir)), 0600))
+	host, port, _ = net.SplitHostPort(addrs[0])
+	web := filepath.Join(dir, "conf.d", "web")
+	require.Nil(t, os.WriteFile(web, []byte(fmt.Sprintf("Host web\n    HostName %s\n    Port %s\n    IdentityFile %s/id_old\n", host, port, KeyDir)), 0600))
+
+	results, err := RotateKeys(p, []string{"web", "down"}, RotateOption{Timeout: 5 * time.Second, AcceptNew: true})
+	require.Nil(t, err)
+	require.Len(t, results, 2)
+
+	r := results[0]
+	require.Empty(t, r.Error)
+	require.Equal(t, RotateDone, r.Step)
+	require.Equal(t, filepath.Join(KeyDir, "id_old"), r.OldKey)
+	require.Equal(t, KeyPath("web", KeyEd25519)+"-"+time.Now().Format("20060102"), r.NewKey)
+	require.Equal(t, web, r.File)
+	require.True(t, r.Removed)
+	_, pub, line, err := publicKeyFile(r.NewKey)
+	require.Nil(t, err)
+	require.Equal(t, ssh.FingerprintSHA256(pub), r.Fingerprint)
+	data, err := os.ReadFile(web)
+	require.Nil(t, err)
+	require.Contains(t, string(data), "    IdentityFile "+r.NewKey+"\n")
+	require.NotContains(t, string(data), "id_old")
+	data, err = os.ReadFile(filepath.Join(homes[0], ".ssh", "authorized_keys"))
+	require.Nil(t, err)
+	require.NotContains(t, string(data), keyBlob(old.PublicKey()))
+	require.Contains(t, string(data), line+"\n")
+	require.True(t, strings.HasPrefix(string(data), "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPrKdy1ClGbNqLUkeXCjl+6VRWGAAWzNlW1mwpOJrHMc other\n"))
+	info, err := os.Stat(filepath.Join(homes[0], ".ssh", "authorized_keys"))
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	// the old key stays on disk
+	_, err = os.Stat(r.OldKey)
+	require.Nil(t, err)
+
+	// the failed rotation is saved
+	r = results[1]
+	require.NotEmpty(t, r.Error)
+	require.Equal(t, RotateGenerated, r.Step)
+	pending, err := PendingRotations(p)
+	require.Nil(t, err)
+	require.Equal(t, []string{"down"}, pending)
+
+	// a rotation of api that stopped after the new key was installed
+	newKey := filepath.Join(KeyDir, "id_api_new")
+	signer := writeTestKey(t, newKey)
+	f, err := os.OpenFile(filepath.Join(homes[1], ".ssh", "authorized_keys"), os.O_APPEND|os.O_WRONLY, 0)
+	require.Nil(t, err)
+	_, err = f.Write(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+	data, err = os.ReadFile(RotateStatePath(p))
+	require.Nil(t, err)
+	state := map[string]*RotateResult{}
+	require.Nil(t, json.Unmarshal(data, &state))
+	state["api"] = &RotateResult{Alias: "api", OldKey: filepath.Join(KeyDir, "id_old"), NewKey: newKey, Step: RotateInstalled}
+	require.Nil(t, saveRotateState(RotateStatePath(p), state))
+
+	results, err = RotateKeys(p, []string{"api"}, RotateOption{Timeout: 5 * time.Second, AcceptNew: true})
+	require.Nil(t, err)
+	r = results[0]
+	require.Empty(t, r.Error)
+	require.Equal(t, RotateDone, r.Step)
+	require.Equal(t, p, r.File)
+	require.True(t, r.Removed)
+	// the old key is set by Host *, the alias gets the new one in its block
+	h, err := Resolve(p, "api")
+	require.Nil(t, err)
+	require.Equal(t, []string{newKey, filepath.Join(KeyDir, "id_old")}, h.Values("identityfile"))
+	h, err = Resolve(p, "down")
+	require.Nil(t, err)
+	require.Equal(t, []string{filepath.Join(KeyDir, "id_old")}, h.Values("identityfile"))
+	data, err = os.ReadFile(filepath.Join(homes[1], ".ssh", "authorized_keys"))
+	require.Nil(t, err)
+	require.NotContains(t, string(data), keyBlob(old.PublicKey()))
+
+	pending, err = PendingRotations(p)
+	require.Nil(t, err)
+	require.Equal(t, []string{"down"}, pending)
+
+	_, err = RotateKeys(p, []string{"missing"}, RotateOption{})
+	require.NotNil(t, err)
+}
+
+func TestRotateSharedKey(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	defer func(dir string) { KeyDir = dir }(KeyDir)
+	dir := t.TempDir()
+	KeyDir = filepath.Join(dir, "keys")
+	require.Nil(t, os.MkdirAll(KeyDir, 0700))
+	old := writeTestKey(t, filepath.Join(KeyDir, "id_old"))
+	home := filepath.Join(dir, "home")
+	require.Nil(t, os.MkdirAll(filepath.Join(home, ".ssh"), 0700))
+	authorized := filepath.Join(home, ".ssh", "authorized_keys")
+	require.Nil(t, os.WriteFile(authorized, ssh.MarshalAuthorizedKey(old.PublicKey()), 0600))
+	host, port, _ := net.SplitHostPort(newTestServer(t, testServerOption{Home: home}))
+
+	// two aliases of the same account with the same key
+	p := filepath.Join(dir, "config")
+	require.Nil(t, os.WriteFile(p, []byte(fmt.Sprintf(`Host app app-tunnel
+    HostName %s
+    Port %s
+    User deploy
+Host app
+    IdentityFile %[3]s/id_old
+Host app-tunnel
+    IdentityFile %[3]s/id_old
+Host *
+    UserKnownHostsFile %[4]s/known_hosts
+`, host, port, KeyDir, dir)), 0600))
+
+	// the host key is not known yet, the rotation stops before the install
+	results, err := RotateKeys(p, []string{"app"}, RotateOption{Timeout: 5 * time.Second})
+	require.Nil(t, err)
+	r := results[0]
+	require.Contains(t, r.Error, "the host key of "+knownhosts.Address(host, port)+" is unknown")
+	require.Equal(t, RotateGenerated, r.Step)
+
+	// it continues once the host key is accepted
+	results, err = RotateKeys(p, []string{"app"}, RotateOption{Timeout: 5 * time.Second, AcceptNew: true})
+	require.Nil(t, err)
+	r = results[0]
+	require.Empty(t, r.Error)
+	require.Equal(t, RotateDone, r.Step)
+	require.False(t, r.Removed)
+	require.Equal(t, "used by app-tunnel for the same account", r.Kept)
+	data, err := os.ReadFile(authorized)
+	require.Nil(t, err)
+	require.Contains(t, string(data), keyBlob(old.PublicKey()))
+
+	// the last alias using it removes it
+	results, err = RotateKeys(p, []string{"app-tunnel"}, RotateOption{Timeout: 5 * time.Second})
+	require.Nil(t, err)
+	r = results[0]
+	require.Empty(t, r.Error)
+	require.True(t, r.Removed)
+	require.Empty(t, r.Kept)
+	data, err = os.ReadFile(authorized)
+	require.Nil(t, err)
+	require.NotContains(t, string(data), keyBlob(old.PublicKey()))
+}
+
+func TestMatchAliases(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config")
+	require.Nil(t, os.WriteFile(p, []byte("Host web-1 web-2 web-old db\n    HostName 10.0.0.1\nHost web-*\n    User deploy\n"), 0600))
+
+	aliases, err := MatchAliases(p, "web-*,!web-old")
+	require.Nil(t, err)
+	require.Equal(t, []string{"web-1", "web-2"}, aliases)
+
+	_, err = MatchAliases(p, "api-*")
+	require.NotNil(t, err)
+}
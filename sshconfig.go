@@ -1,39 +1,135 @@
 package sshman
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
-	"path"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
-	"bytes"
-
-	"github.com/sonnt85/gosystem"
 	"github.com/sonnt85/sshman/sshconfig"
 )
 
-func writeConfig(p string, cfg *sshconfig.Config) error {
+// AutoBackup whether to save a timestamped copy of a config file before
+// each mutation rewrites it
+var AutoBackup = false
+
+// BackupDir directory the automatic backups are saved to, the directory of
+// the main config file if empty
+var BackupDir = ""
+
+// backupDir return the directory the backups of the files read from the
+// config file main are saved to. They never go next to an included file, an
+// Include glob such as conf.d/* would read them as config.
+func backupDir(main string) string {
+	if BackupDir != "" {
+		return BackupDir
+	}
+	return filepath.Dir(main)
+}
+
+func writeConfig(p string, cfg *sshconfig.Config, backups string) error {
+	return writeFile(p, cfg.String(), backups)
+}
+
+// writeFile replace the contents of p atomically: the content is written to a
+// temporary file in the same directory, which is renamed over p. The mode and
+// owner of an existing file are preserved, and symbolic links are followed.
+// The temporary file is hidden, so Include globs do not match it. With
+// AutoBackup, the old contents are saved to the directory backups first.
+func writeFile(p, content, backups string) error {
+	if target, err := filepath.EvalSymlinks(p); err == nil {
+		p = target
+	}
 
-	oldContents := []byte{}
-	if _, err := os.Stat(p); err == nil {
-		oldContents, _ = os.ReadFile(p)
+	var mode os.FileMode = 0600
+	info, err := os.Stat(p)
+	if err == nil {
+		oldContents, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(oldContents, []byte(content)) {
+			return nil
+		}
+		mode = info.Mode().Perm()
+		if AutoBackup {
+			if _, err := backupFile(p, oldContents, backups); err != nil {
+				return err
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if info != nil {
+		if err := chown(tmp, info); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
 	}
+	return os.Rename(tmp.Name(), p)
+}
 
-	if !bytes.Equal(oldContents, []byte(cfg.String())) {
-		defer gosystem.Chmod(p, 0644)
-		// return gosystem.WriteToFileWithLockSFL(p, cfg.String(), true)
-		return os.WriteFile(p, []byte(cfg.String()), 0644)
-	} else {
-		return nil
+// backupFile save contents, the current contents of p, to a timestamped
+// backup file in dir and return its path
+func backupFile(p string, contents []byte, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
 	}
+	name := fmt.Sprintf("%s.%s.bak", filepath.Base(p), time.Now().Format("20060102-150405.000"))
+	bp := filepath.Join(dir, name)
+	return bp, os.WriteFile(bp, contents, 0600)
 }
 
-func readFile(p string) (*sshconfig.Config, error) {
-	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE, 0600)
+// lockConfig take an exclusive advisory lock on the sidecar lock file of the
+// config file p, it is held until unlock is called. Mutations hold it from
+// parsing to writing so concurrent runs do not lose each other's changes.
+func lockConfig(p string) (unlock func(), err error) {
+	f, err := os.OpenFile(p+".lock", os.O_RDWR|os.O_CREATE, 0600)
 	if err != nil {
 		return nil, err
 	}
-	return sshconfig.Decode(f)
+	if err := flock(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		funlock(f)
+		f.Close()
+	}, nil
+}
+
+// readFile read the config file p, a missing file reads as an empty config
+func readFile(p string) (*sshconfig.Config, error) {
+	cfg, err := sshconfig.DecodeFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return sshconfig.Decode(strings.NewReader(""))
+	}
+	return cfg, err
 }
 
 func deleteHostFromConfig(config *sshconfig.Config, host *sshconfig.Host) {
@@ -47,77 +143,136 @@ func deleteHostFromConfig(config *sshconfig.Config, host *sshconfig.Host) {
 	config.Hosts = hs
 }
 
-func setImplicitConfig(aliasMap map[string]*HostConfig, hc *HostConfig) {
-	for alias, host := range aliasMap {
-		if alias == hc.Alias {
-			continue
+// collectConfigs adds the files included by cfg, and the files they include,
+// to configMap.
+func collectConfigs(configMap map[string]*sshconfig.Config, cfg *sshconfig.Config) {
+	for _, host := range cfg.Hosts {
+		for _, node := range host.Nodes {
+			if inc, ok := node.(*sshconfig.Include); ok {
+				for fp, config := range inc.GetFiles() {
+					if _, ok := configMap[fp]; !ok {
+						configMap[fp] = config
+						collectConfigs(configMap, config)
+					}
+				}
+			}
 		}
+	}
+}
 
-		if len(hc.OwnConfig) == 0 {
-			if match, err := path.Match(host.Alias, hc.Alias); err != nil || !match {
-				continue
-			}
-			for k, v := range host.OwnConfig {
-				if _, ok := hc.ImplicitConfig[k]; !ok {
-					hc.ImplicitConfig[k] = v
+// walkHosts calls fn for every Host block of cfg, read from fp, and of the
+// files it includes, in the order ssh reads them.
+func walkHosts(fp string, cfg *sshconfig.Config, fn func(fp string, host *sshconfig.Host)) {
+	for _, host := range cfg.Hosts {
+		fn(fp, host)
+		for _, node := range host.Nodes {
+			if inc, ok := node.(*sshconfig.Include); ok {
+				files := inc.GetFiles()
+				for _, path := range inc.Files() {
+					walkHosts(path, files[path], fn)
 				}
 			}
-			continue
 		}
-		if match, err := path.Match(hc.Alias, host.Alias); err != nil || !match {
-			continue
-		}
-		for k, v := range hc.OwnConfig {
-			if _, ok := host.OwnConfig[k]; ok {
-				continue
-			}
-			if _, ok := host.ImplicitConfig[k]; !ok {
-				host.ImplicitConfig[k] = v
-			}
+	}
+}
+
+func hasKV(host *sshconfig.Host) bool {
+	for _, node := range host.Nodes {
+		if _, ok := node.(*sshconfig.KV); ok {
+			return true
 		}
 	}
+	return false
 }
 
-func setOwnConfig(aliasMap map[string]*HostConfig, hc *HostConfig, h *sshconfig.Host) {
-	if host, ok := aliasMap[hc.Alias]; ok {
-		if _, ok := host.PathMap[hc.Path]; !ok {
-			host.PathMap[hc.Path] = []*sshconfig.Host{}
+// defaultHost holds the values sshman assumes for every alias that does not
+// set them, as an implicit `Host *` read after all files.
+func defaultHost() *sshconfig.Host {
+	return &sshconfig.Host{
+		Patterns: []*sshconfig.Pattern{(&sshconfig.Pattern{}).SetStr("*")},
+		Nodes: []sshconfig.Node{
+			sshconfig.NewKV("user", GetUsername()),
+			sshconfig.NewKV("port", "22"),
+		},
+	}
+}
+
+// resolveHost fills the own and implicit config of hc with the values ssh
+// would use for its alias. Values read from one of the alias's own blocks
+// are own config, the others are implicit.
+func resolveHost(r *sshconfig.Resolver, defaults *sshconfig.Host, hc *HostConfig) error {
+	settings, err := r.Settings(hc.Alias)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, s := range settings {
+		seen[s.Key] = true
+	}
+	for _, node := range defaults.Nodes {
+		if kv, ok := node.(*sshconfig.KV); ok && !seen[kv.Key] {
+			settings = append(settings, &sshconfig.Setting{Key: kv.Key, Value: kv.Value, Host: defaults, KV: kv})
 		}
-		host.PathMap[hc.Path] = append(host.PathMap[hc.Path], h)
-		for k, v := range hc.OwnConfig {
-			if _, ok := host.OwnConfig[k]; !ok {
-				host.OwnConfig[k] = v
-			}
+	}
+
+	hc.Settings = settings
+	hc.OwnConfig = map[string]string{}
+	hc.ImplicitConfig = map[string]string{}
+	for _, s := range settings {
+		config := hc.ImplicitConfig
+		if hc.IsOwn(s) {
+			config = hc.OwnConfig
+		}
+		if _, ok := config[s.Key]; !ok {
+			config[s.Key] = s.Value
 		}
-	} else {
-		aliasMap[hc.Alias] = hc
 	}
+	return nil
 }
 
-func addHosts(aliasMap map[string]*HostConfig, fp string, hosts ...*sshconfig.Host) {
-	for _, host := range hosts {
-		// except implicit `*`
-		if len(host.Nodes) == 0 {
-			continue
+// buildAliasMap collects the aliases declared in cfg, read from p, and in the
+// files it includes, and resolves each of them the way `ssh -F p -G alias`
+// does.
+func buildAliasMap(p string, cfg *sshconfig.Config) (map[string]*HostConfig, error) {
+	aliasMap, defaults := collectAliases(p, cfg)
+	r, err := sshconfig.NewResolver(sshconfig.ResolveOptions{Configs: []*sshconfig.Config{cfg}})
+	if err != nil {
+		return nil, err
+	}
+	for _, hc := range aliasMap {
+		if err := resolveHost(r, defaults, hc); err != nil {
+			return nil, err
 		}
+	}
+	return aliasMap, nil
+}
+
+// collectAliases collects the aliases declared in cfg, read from p, and in
+// the files it includes with their Host blocks, without resolving their
+// values. It returns the block of the sshman defaults as well.
+func collectAliases(p string, cfg *sshconfig.Config) (map[string]*HostConfig, *sshconfig.Host) {
+	aliasMap := map[string]*HostConfig{}
+	add := func(fp string, host *sshconfig.Host) {
 		for _, pattern := range host.Patterns {
+			if pattern.Negated() {
+				continue
+			}
 			alias := pattern.String()
-			hc := NewHostConfig(alias, fp, host)
-			setImplicitConfig(aliasMap, hc)
-
-			for _, node := range host.Nodes {
-				if kvNode, ok := node.(*sshconfig.KV); ok {
-					kvNode.Key = strings.ToLower(kvNode.Key)
-					if _, ok := hc.ImplicitConfig[kvNode.Key]; !ok {
-						hc.OwnConfig[kvNode.Key] = kvNode.Value
-					}
-				}
+			if hc, ok := aliasMap[alias]; ok {
+				hc.PathMap[fp] = append(hc.PathMap[fp], host)
+			} else {
+				aliasMap[alias] = NewHostConfig(alias, fp, host)
 			}
-
-			setImplicitConfig(aliasMap, hc)
-			setOwnConfig(aliasMap, hc, host)
 		}
 	}
+	walkHosts(p, cfg, func(fp string, host *sshconfig.Host) {
+		if hasKV(host) {
+			add(fp, host)
+		}
+	})
+	defaults := defaultHost()
+	add(p, defaults)
+	return aliasMap, defaults
 }
 
 // ParseConfig parse configs from ssh config file, return config object and alias map
@@ -127,36 +282,40 @@ func parseConfig(p string) (map[string]*sshconfig.Config, map[string]*HostConfig
 		return nil, nil, err
 	}
 
-	aliasMap := map[string]*HostConfig{}
 	configMap := map[string]*sshconfig.Config{p: cfg}
-
-	for _, host := range cfg.Hosts {
-		var hasKV = false
-		for _, node := range host.Nodes {
-			switch t := node.(type) {
-			case *sshconfig.Include:
-				for fp, config := range t.GetFiles() {
-					configMap[fp] = config
-					addHosts(aliasMap, fp, config.Hosts...)
-				}
-			case *sshconfig.KV:
-				hasKV = true
-			}
-		}
-		if hasKV {
-			addHosts(aliasMap, p, host)
-		}
+	collectConfigs(configMap, cfg)
+	aliasMap, err := buildAliasMap(p, cfg)
+	if err != nil {
+		return nil, nil, err
 	}
-	addHosts(aliasMap, p, &sshconfig.Host{
-		Patterns: []*sshconfig.Pattern{(&sshconfig.Pattern{}).SetStr("*")},
-		Nodes: []sshconfig.Node{
-			sshconfig.NewKV("user", GetUsername()),
-			sshconfig.NewKV("port", "22"),
-		},
-	})
 	return configMap, aliasMap, nil
 }
 
+// Resolve returns the effective config of alias as ssh reads it from the
+// config file p, whether or not alias is declared in a Host block.
+func Resolve(p, alias string) (*HostConfig, error) {
+	_, aliasMap, err := parseConfig(p)
+	if err != nil {
+		return nil, err
+	}
+	if hc, ok := aliasMap[alias]; ok {
+		return hc, nil
+	}
+	cfg, err := readFile(p)
+	if err != nil {
+		return nil, err
+	}
+	r, err := sshconfig.NewResolver(sshconfig.ResolveOptions{Configs: []*sshconfig.Config{cfg}})
+	if err != nil {
+		return nil, err
+	}
+	hc := &HostConfig{Alias: alias, PathMap: map[string][]*sshconfig.Host{}}
+	if err := resolveHost(r, defaultHost(), hc); err != nil {
+		return nil, err
+	}
+	return hc, nil
+}
+
 // ListOption options for List
 type ListOption struct {
 	// Keywords set Keyword filter records
@@ -167,7 +326,7 @@ type ListOption struct {
 
 // List ssh alias, filter by optional keyword
 func List(p string, lo ListOption) ([]*HostConfig, error) {
-	configMap, aliasMap, err := parseConfig(p)
+	_, aliasMap, err := parseConfig(p)
 	if err != nil {
 		return nil, err
 	}
@@ -184,16 +343,36 @@ func List(p string, lo ListOption) ([]*HostConfig, error) {
 		}
 		result = append(result, host)
 	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Alias < result[j].Alias })
+	return result, nil
+}
 
-	// Format
-	for fp, cfg := range configMap {
-		if len(cfg.Hosts) > 0 {
-			if err := writeConfig(fp, cfg); err != nil {
-				return nil, err
-			}
+// MatchAliases return the aliases of the config file p without wildcards that
+// match pattern, a comma separated list of ssh patterns such as
+// "web-*,!web-old", sorted
+func MatchAliases(p, pattern string) ([]string, error) {
+	host := &sshconfig.Host{}
+	for _, s := range strings.Split(pattern, ",") {
+		pat, err := sshconfig.NewPattern(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
 		}
+		host.Patterns = append(host.Patterns, pat)
 	}
-	return result, nil
+	hosts, err := List(p, ListOption{})
+	if err != nil {
+		return nil, err
+	}
+	var aliases []string
+	for _, hc := range hosts {
+		if !strings.ContainsAny(hc.Alias, "*?!") && host.Matches(hc.Alias) {
+			aliases = append(aliases, hc.Alias)
+		}
+	}
+	if len(aliases) == 0 {
+		return nil, fmt.Errorf("no alias matches %q", pattern)
+	}
+	return aliases, nil
 }
 
 // AddOption options for Add
@@ -206,59 +385,27 @@ type AddOption struct {
 	Connect string
 	// Config other config
 	Config map[string]string
+	// Comment comment at the end of the Host line
+	Comment string
+	// Warnings what an Importer could not turn into config, not written
+	Warnings []string
 }
 
 // Add ssh host config to ssh config file
 func Add(p string, ao *AddOption) (*HostConfig, error) {
-	if ao.Path == "" {
-		ao.Path = p
-	}
-
-	configMap, aliasMap, err := parseConfig(p)
+	tx, err := Begin(p)
 	if err != nil {
 		return nil, err
 	}
-	if err := checkAlias(aliasMap, false, ao.Alias); err != nil {
+	defer tx.Rollback()
+	if _, err := tx.Add(ao); err != nil {
 		return nil, err
 	}
-
-	cfg, ok := configMap[ao.Path]
-	if !ok {
-		cfg, err = readFile(ao.Path)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	// Parse connect string
-	user, hostname, port := ParseConnect(ao.Connect)
-	if user != "" {
-		ao.Config["user"] = user
-	}
-	if hostname != "" {
-		ao.Config["hostname"] = hostname
-	}
-	if port != "" {
-		ao.Config["port"] = port
-	}
-
-	var nodes []sshconfig.Node
-	for k, v := range ao.Config {
-		nodes = append(nodes, sshconfig.NewKV(strings.ToLower(k), v))
-	}
-
-	pattern, err := sshconfig.NewPattern(ao.Alias)
-	if err != nil {
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
-	cfg.Hosts = append(cfg.Hosts, &sshconfig.Host{
-		Patterns: []*sshconfig.Pattern{pattern},
-		Nodes:    nodes,
-	})
-	writeConfig(ao.Path, cfg)
-
-	_, aliasMap, err = parseConfig(p)
+	_, aliasMap, err := parseConfig(p)
 	if err != nil {
 		return nil, err
 	}
@@ -284,108 +431,19 @@ func (uo *UpdateOption) Valid() bool {
 
 // Update existing record
 func Update(p string, uo *UpdateOption) (*HostConfig, error) {
-	configMap, aliasMap, err := parseConfig(p)
+	tx, err := Begin(p)
 	if err != nil {
 		return nil, err
 	}
-	if err := checkAlias(aliasMap, true, uo.Alias); err != nil {
+	defer tx.Rollback()
+	if _, err := tx.Update(uo); err != nil {
 		return nil, err
 	}
-
-	updateHost := aliasMap[uo.Alias]
-	if uo.NewAlias != "" {
-		// new alias should not exist
-		if err := checkAlias(aliasMap, false, uo.NewAlias); err != nil {
-			return nil, err
-		}
-	} else {
-		uo.NewAlias = uo.Alias
-	}
-
-	if uo.Connect != "" {
-		// Parse connect string
-		user, hostname, port := ParseConnect(uo.Connect)
-		if user != "" {
-			uo.Config["user"] = user
-		}
-		if hostname != "" {
-			uo.Config["hostname"] = hostname
-		}
-		if port != "" {
-			uo.Config["port"] = port
-		}
-	}
-
-	for k, v := range uo.Config {
-		if v == "" {
-			delete(updateHost.OwnConfig, k)
-		} else {
-			updateHost.OwnConfig[k] = v
-		}
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
 
-	for fp, hosts := range updateHost.PathMap {
-		for i, host := range hosts {
-			if fp == updateHost.Path {
-				pattern, _ := sshconfig.NewPattern(uo.NewAlias)
-				newHost := &sshconfig.Host{
-					Patterns: []*sshconfig.Pattern{pattern},
-				}
-				for k, v := range updateHost.OwnConfig {
-					newHost.Nodes = append(newHost.Nodes, sshconfig.NewKV(k, v))
-				}
-				if len(host.Patterns) == 1 {
-					if i == 0 {
-						*host = *newHost
-						// for implicit "*"
-						find := false
-						for _, h := range configMap[fp].Hosts {
-							if host == h {
-								find = true
-								break
-							}
-						}
-						if !find {
-							newHost.Nodes = []sshconfig.Node{}
-							for k, v := range uo.Config {
-								newHost.Nodes = append(newHost.Nodes, sshconfig.NewKV(k, v))
-							}
-							configMap[fp].Hosts = append(configMap[fp].Hosts, newHost)
-						}
-					} else {
-						deleteHostFromConfig(configMap[fp], host)
-					}
-				} else {
-					if i == 0 {
-						configMap[fp].Hosts = append(configMap[fp].Hosts, newHost)
-					}
-					var patterns []*sshconfig.Pattern
-					for _, pattern := range host.Patterns {
-						if pattern.String() != uo.NewAlias {
-							patterns = append(patterns, pattern)
-						}
-					}
-					host.Patterns = patterns
-				}
-			} else {
-				if len(host.Patterns) == 1 {
-					deleteHostFromConfig(configMap[fp], host)
-				} else {
-					var patterns []*sshconfig.Pattern
-					for _, pattern := range host.Patterns {
-						if pattern.String() != uo.NewAlias {
-							patterns = append(patterns, pattern)
-						}
-					}
-					host.Patterns = patterns
-				}
-			}
-		}
-		if err := writeConfig(fp, configMap[fp]); err != nil {
-			return nil, err
-		}
-	}
-	_, aliasMap, err = parseConfig(p)
+	_, aliasMap, err := parseConfig(p)
 	if err != nil {
 		return nil, err
 	}
@@ -394,38 +452,18 @@ func Update(p string, uo *UpdateOption) (*HostConfig, error) {
 
 // Delete existing alias record
 func Delete(p string, aliases ...string) ([]*HostConfig, error) {
-	configMap, aliasMap, err := parseConfig(p)
+	tx, err := Begin(p)
 	if err != nil {
 		return nil, err
 	}
-	if err := checkAlias(aliasMap, true, aliases...); err != nil {
+	defer tx.Rollback()
+	deleteHosts, err := tx.Delete(aliases...)
+	if err != nil {
 		return nil, err
 	}
-
-	var deleteHosts []*HostConfig
-	for _, alias := range aliases {
-		deleteHost := aliasMap[alias]
-		deleteHosts = append(deleteHosts, deleteHost)
-		for fp, hosts := range deleteHost.PathMap {
-			for _, host := range hosts {
-				if len(host.Patterns) == 1 {
-					deleteHostFromConfig(configMap[fp], host)
-				} else {
-					var patterns []*sshconfig.Pattern
-					for _, pattern := range host.Patterns {
-						if pattern.String() != alias {
-							patterns = append(patterns, pattern)
-						}
-					}
-					host.Patterns = patterns
-				}
-			}
-			if err := writeConfig(fp, configMap[fp]); err != nil {
-				return nil, err
-			}
-		}
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
-
 	return deleteHosts, nil
 }
 
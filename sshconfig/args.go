@@ -0,0 +1,101 @@
+package sshconfig
+
+import (
+	"errors"
+	"strings"
+)
+
+var errUnterminatedQuote = errors.New("sshconfig: unterminated quoted string")
+
+// SplitArgs splits s into arguments the way OpenSSH's argv_split does:
+// arguments are separated by spaces or tabs, single or double quotes group
+// characters into one argument, and a backslash escapes a quote, a backslash
+// or (outside quotes) a space.
+func SplitArgs(s string) ([]string, error) {
+	args, ok := scanArgs(s)
+	if !ok {
+		return nil, errUnterminatedQuote
+	}
+	return args, nil
+}
+
+// scanArgs splits s like SplitArgs, ok is false if the last argument has an
+// unterminated quote, which then runs to the end of s.
+func scanArgs(s string) (args []string, ok bool) {
+	ok = true
+	for i := 0; i < len(s); i++ {
+		if isSpace(rune(s[i])) {
+			continue
+		}
+		var arg strings.Builder
+		var quote byte
+		for ; i < len(s); i++ {
+			c := s[i]
+			switch {
+			case c == '\\' && i+1 < len(s) &&
+				(s[i+1] == '\'' || s[i+1] == '"' || s[i+1] == '\\' || (quote == 0 && s[i+1] == ' ')):
+				i++
+				arg.WriteByte(s[i])
+				continue
+			case quote == 0 && isSpace(rune(c)):
+			case quote == 0 && (c == '"' || c == '\''):
+				quote = c
+				continue
+			case quote != 0 && c == quote:
+				quote = 0
+				continue
+			default:
+				arg.WriteByte(c)
+				continue
+			}
+			break
+		}
+		if quote != 0 {
+			ok = false
+		}
+		args = append(args, arg.String())
+	}
+	return args, ok
+}
+
+// QuoteArg returns s quoted so that ssh reads it back as a single
+// argument. Arguments that need no quoting are returned unchanged.
+func QuoteArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\#") {
+		return s
+	}
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(s[i])
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// pathLists are the path keywords that take several paths on one line.
+var pathLists = map[string]bool{"globalknownhostsfile": true, "include": true, "userknownhostsfile": true}
+
+// QuoteValue returns value, an unquoted value as Setting.Value holds it,
+// quoted to be written as the value of key: the value of a keyword taking a
+// single path is quoted as one argument, the other values are returned
+// unchanged, their arguments separated by spaces.
+func QuoteValue(key, value string) string {
+	s := LookupKeyword(key)
+	if value == "" || s == nil || s.Type != TypePath || pathLists[strings.ToLower(key)] {
+		return value
+	}
+	return QuoteArg(value)
+}
+
+// joinArgs joins args with spaces, quoting those that need it.
+func joinArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = QuoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,36 @@
+package sshconfig
+
+import (
+	"reflect"
+	"testing"
+)
+
+var splitArgsTests = []struct {
+	in   string
+	want []string
+}{
+	{"host a,b", []string{"host", "a,b"}},
+	{"  host\ta  ", []string{"host", "a"}},
+	{`exec "test -f /tmp/x"`, []string{"exec", "test -f /tmp/x"}},
+	{`exec 'echo "hi"'`, []string{"exec", `echo "hi"`}},
+	{`a\ b c\"d`, []string{"a b", `c"d`}},
+	{`"" x`, []string{"", "x"}},
+}
+
+func TestSplitArgs(t *testing.T) {
+	for _, tt := range splitArgsTests {
+		got, err := SplitArgs(tt.in)
+		if err != nil {
+			t.Fatalf("SplitArgs(%q): %v", tt.in, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitArgs(%q): got %q, want %q", tt.in, got, tt.want)
+		}
+		for _, arg := range got {
+			back, err := SplitArgs(QuoteArg(arg))
+			if err != nil || len(back) != 1 || back[0] != arg {
+				t.Errorf("QuoteArg(%q) does not round-trip: %q", arg, back)
+			}
+		}
+	}
+}
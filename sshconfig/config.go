@@ -4,7 +4,7 @@
 // you can manipulate a `sshconfig` file from a program, if your heart desires.
 //
 // The Get() and GetStrict() functions will attempt to read values from
-// $HOME/.ssh/config, falling back to /etc/ssh/sshconfig. The first argument is
+// $HOME/.ssh/config, falling back to /etc/ssh/ssh_config. The first argument is
 // the host name to match on ("example.com"), and the second argument is the key
 // you want to retrieve ("Port"). The keywords are case insensitive.
 //
@@ -25,8 +25,9 @@
 //	// Write the cfg back to disk:
 //	fmt.Println(cfg.String())
 //
-// BUG: the Match directive is currently unsupported; parsing a config with
-// a Match directive will trigger an error.
+// Match directives are parsed into a Host whose Match field holds the
+// criteria. They are evaluated by Get and GetStrict in the same order ssh
+// evaluates them; "Match exec" commands are run through MatchExec.
 package sshconfig
 
 import (
@@ -39,6 +40,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -52,7 +54,10 @@ type configFinder func() string
 // UserSettings checks ~/.ssh and /etc/ssh for configuration files. The config
 // files are parsed and cached the first time Get() or GetStrict() is called.
 type UserSettings struct {
-	IgnoreErrors       bool
+	IgnoreErrors bool
+	// MatchExec runs "Match exec" commands. If nil, the package level
+	// MatchExec is used.
+	MatchExec          MatchExecFunc
 	systemConfig       *Config
 	systemConfigFinder configFinder
 	userConfig         *Config
@@ -75,7 +80,7 @@ func userConfigFinder() string {
 }
 
 // DefaultUserSettings is the default UserSettings and is used by Get and
-// GetStrict. It checks both $HOME/.ssh/config and /etc/ssh/sshconfig for keys,
+// GetStrict. It checks both $HOME/.ssh/config and /etc/ssh/ssh_config for keys,
 // and it will return parse errors (if any) instead of swallowing them.
 var DefaultUserSettings = &UserSettings{
 	IgnoreErrors:       false,
@@ -84,21 +89,7 @@ var DefaultUserSettings = &UserSettings{
 }
 
 func systemConfigFinder() string {
-	return filepath.Join("/", "etc", "ssh", "sshconfig")
-}
-
-func findVal(c *Config, alias, key string) (string, error) {
-	if c == nil {
-		return "", nil
-	}
-	val, err := c.Get(alias, key)
-	if err != nil || val == "" {
-		return "", err
-	}
-	if err := validate(key, val); err != nil {
-		return "", err
-	}
-	return val, nil
+	return filepath.Join("/", "etc", "ssh", "ssh_config")
 }
 
 // Get finds the first value for key within a declaration that matches the
@@ -168,7 +159,7 @@ func (u *UserSettings) GetStrict(alias, key string) (string, error) {
 		} else {
 			filename = u.systemConfigFinder()
 		}
-		u.systemConfig, err = parseFile(filename)
+		u.systemConfig, err = parseSystemFile(filename)
 		//lint:ignore S1002 I prefer it this way
 		if err != nil && os.IsNotExist(err) == false {
 			u.onceErr = err
@@ -179,27 +170,54 @@ func (u *UserSettings) GetStrict(alias, key string) (string, error) {
 	if u.onceErr != nil && u.IgnoreErrors == false {
 		return "", u.onceErr
 	}
-	val, err := findVal(u.userConfig, alias, key)
-	if err != nil || val != "" {
-		return val, err
+	val, err := lookup([]*Config{u.userConfig, u.systemConfig}, newMatchContext(alias, u.MatchExec), key)
+	if err != nil {
+		return "", err
 	}
-	val2, err2 := findVal(u.systemConfig, alias, key)
-	if err2 != nil || val2 != "" {
-		return val2, err2
+	if val == "" {
+		// like a value read from a file, only the first default of a
+		// multi-valued key
+		if args, _ := scanArgs(Default(key)); IsMultiValued(key) && len(args) > 0 {
+			return args[0], nil
+		}
+		return Default(key), nil
 	}
-	return Default(key), nil
+	if err := validate(key, val); err != nil {
+		return "", err
+	}
+	return val, nil
 }
 
 func parseFile(filename string) (*Config, error) {
 	return parseWithDepth(filename, 0)
 }
 
+// parseSystemFile parses the system-wide config file, which resolves
+// relative Include paths against /etc/ssh wherever it is located.
+func parseSystemFile(filename string) (*Config, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	c, err := decodeBytes(b, true, 0)
+	if err != nil {
+		return nil, err
+	}
+	c.path = filename
+	return c, nil
+}
+
 func parseWithDepth(filename string, depth uint8) (*Config, error) {
 	b, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	return decodeBytes(b, isSystem(filename), depth)
+	c, err := decodeBytes(b, isSystem(filename), depth)
+	if err != nil {
+		return nil, err
+	}
+	c.path = filename
+	return c, nil
 }
 
 func isSystem(filename string) bool {
@@ -217,6 +235,13 @@ func Decode(r io.Reader) (*Config, error) {
 	return decodeBytes(b, false, 0)
 }
 
+// DecodeFile reads the file at filename into a Config. Unlike Decode, the
+// Config remembers the file it was read from, which is reported in the
+// Source of values resolved from it.
+func DecodeFile(filename string) (*Config, error) {
+	return parseFile(filename)
+}
+
 func decodeBytes(b []byte, system bool, depth uint8) (c *Config, err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -231,7 +256,7 @@ func decodeBytes(b []byte, system bool, depth uint8) (c *Config, err error) {
 		}
 	}()
 
-	c = parseSSH(lexSSH(b), system, depth)
+	c = parseSSH(lexSSH(b), b, system, depth)
 	return c, err
 }
 
@@ -242,17 +267,61 @@ type Config struct {
 	Hosts    []*Host
 	depth    uint8
 	position Position
+	// path is the file the config was read from, if any.
+	path string
+	// tail holds the blanks following the last line of the file.
+	tail string
 }
 
 // Get finds the first value in the configuration that matches the alias and
 // contains key. Get returns the empty string if no value was found, or if the
 // Config contains an invalid conditional Include value.
 //
+// Match directives are evaluated against the alias and the values obtained
+// before them; "Match exec" commands are run through MatchExec.
+//
 // The match for key is case insensitive.
 func (c *Config) Get(alias, key string) (string, error) {
+	return lookup([]*Config{c}, newMatchContext(alias, nil), key)
+}
+
+// lookup finds the first value for key in configs, read in order. As ssh
+// does, configs are read a second time with "Match final" blocks enabled
+// if any of them asked for a final pass and no value was found yet.
+func lookup(configs []*Config, ctx *matchContext, key string) (string, error) {
 	lowerKey := strings.ToLower(key)
+	var val string
+	visit := func(_ *Config, _ *Host, kv *KV) bool {
+		// "keys are case insensitive" per the spec
+		if strings.ToLower(kv.Key) == lowerKey {
+			val = kv.Value
+			return true
+		}
+		return false
+	}
+	for {
+		for _, c := range configs {
+			if c == nil {
+				continue
+			}
+			found, err := c.walk(ctx, visit)
+			if err != nil || found {
+				return val, err
+			}
+		}
+		if ctx.final || !ctx.wantFinal {
+			return "", nil
+		}
+		ctx.final = true
+	}
+}
+
+// walk calls visit for every KV of c that applies in ctx, in file order,
+// descending into included files. It stops and returns true as soon as
+// visit returns true.
+func (c *Config) walk(ctx *matchContext, visit func(*Config, *Host, *KV) bool) (bool, error) {
 	for _, host := range c.Hosts {
-		if !host.Matches(alias) {
+		if !host.matches(ctx) {
 			continue
 		}
 		for _, node := range host.Nodes {
@@ -260,25 +329,21 @@ func (c *Config) Get(alias, key string) (string, error) {
 			case *Empty:
 				continue
 			case *KV:
-				// "keys are case insensitive" per the spec
-				lkey := strings.ToLower(t.Key)
-				if lkey == "match" {
-					panic("can't handle Match directives")
-				}
-				if lkey == lowerKey {
-					return t.Value, nil
+				ctx.observe(t)
+				if visit(c, host, t) {
+					return true, nil
 				}
 			case *Include:
-				val := t.Get(alias, key)
-				if val != "" {
-					return val, nil
+				found, err := t.walk(ctx, visit)
+				if err != nil || found {
+					return found, err
 				}
 			default:
-				return "", fmt.Errorf("unknown Node type %v", t)
+				return false, fmt.Errorf("unknown Node type %v", t)
 			}
 		}
 	}
-	return "", nil
+	return false, nil
 }
 
 // String returns a string representation of the Config file.
@@ -291,11 +356,17 @@ func (c Config) MarshalText() ([]byte, error) {
 }
 
 func marshal(c Config) *bytes.Buffer {
-	var buf bytes.Buffer
+	var w lineWriter
 	for i := range c.Hosts {
-		buf.WriteString(c.Hosts[i].String())
+		c.Hosts[i].write(&w)
+	}
+	if c.tail != "" {
+		if w.open {
+			w.buf.WriteString(w.newline())
+		}
+		w.buf.WriteString(c.tail)
 	}
-	return &buf
+	return &w.buf
 }
 
 // Pattern is a pattern in a Host declaration. Patterns are read-only values;
@@ -308,9 +379,17 @@ type Pattern struct {
 
 // String prints the string representation of the pattern.
 func (p Pattern) String() string {
+	if p.not {
+		return "!" + p.str
+	}
 	return p.str
 }
 
+// Negated reports whether the pattern was prefixed with an exclamation mark.
+func (p Pattern) Negated() bool {
+	return p.not
+}
+
 // SetStr set pattern str
 func (p *Pattern) SetStr(str string) *Pattern {
 	p.str = str
@@ -376,20 +455,39 @@ func NewPattern(s string) (*Pattern, error) {
 type Host struct {
 	// A list of host patterns that should match this host.
 	Patterns []*Pattern
+	// Match holds the criteria if the block was declared with a Match
+	// directive instead of a Host directive. Patterns is empty in that case.
+	Match *Match
 	// A Node is either a key/value pair or a comment line.
 	Nodes []Node
 	// EOLComment is the comment (if any) terminating the Host line.
 	EOLComment   string
 	hasEquals    bool
-	leadingSpace int // TODO: handle spaces vs tabs here.
+	leadingSpace int
 	// The file starts with an implicit "Host *" declaration.
 	implicit bool
+	// src is the Host or Match line.
+	src      line
+	position Position
+}
+
+// Pos returns the position of the Host or Match line of h.
+func (h *Host) Pos() Position {
+	return h.position
 }
 
 // Matches returns true if the Host matches for the given alias. For
 // a description of the rules that provide a match, see the manpage for
 // sshconfig.
 func (h *Host) Matches(alias string) bool {
+	return h.matches(newMatchContext(alias, nil))
+}
+
+func (h *Host) matches(ctx *matchContext) bool {
+	if h.Match != nil {
+		return h.Match.matches(ctx)
+	}
+	alias := ctx.originalHost
 	found := false
 	for i := range h.Patterns {
 		if h.Patterns[i].regex.MatchString(alias) {
@@ -408,34 +506,48 @@ func (h *Host) Matches(alias string) bool {
 	return found
 }
 
-// String prints h as it would appear in a config file. Minor tweaks may be
-// present in the whitespace in the printed file.
+// String prints h as it would appear in a config file. Lines that were not
+// changed since they were parsed are printed as they were read.
 func (h *Host) String() string {
+	var w lineWriter
+	h.write(&w)
+	return w.buf.String()
+}
+
+func (h *Host) write(w *lineWriter) {
+	if !h.implicit {
+		w.write(h.src.text(h.header()), &h.src)
+	}
+	for i := range h.Nodes {
+		w.write(h.Nodes[i].String(), source(h.Nodes[i]))
+	}
+}
+
+// header builds the Host or Match line of h.
+func (h *Host) header() string {
 	var buf bytes.Buffer
-	//lint:ignore S1002 I prefer to write it this way
-	if h.implicit == false {
-		buf.WriteString(strings.Repeat(" ", int(h.leadingSpace)))
-		buf.WriteString("Host")
-		if h.hasEquals {
-			buf.WriteString(" = ")
-		} else {
-			buf.WriteString(" ")
+	comment := h.EOLComment
+	if h.Match != nil {
+		buf.WriteString(h.src.prefix(h.Match.leadingSpace, "Match", h.Match.hasEquals))
+		for i, c := range h.Match.Criteria {
+			if i > 0 {
+				buf.WriteString(" ")
+			}
+			buf.WriteString(c.String())
 		}
+		comment = h.Match.EOLComment
+	} else {
+		buf.WriteString(h.src.prefix(h.leadingSpace, "Host", h.hasEquals))
 		for i, pat := range h.Patterns {
-			buf.WriteString(pat.String())
-			if i < len(h.Patterns)-1 {
+			if i > 0 {
 				buf.WriteString(" ")
 			}
+			buf.WriteString(QuoteArg(pat.String()))
 		}
-		if h.EOLComment != "" {
-			buf.WriteString(" #")
-			buf.WriteString(h.EOLComment)
-		}
-		buf.WriteByte('\n')
 	}
-	for i := range h.Nodes {
-		buf.WriteString(h.Nodes[i].String())
-		buf.WriteByte('\n')
+	if comment != "" {
+		buf.WriteString(" #")
+		buf.WriteString(comment)
 	}
 	return buf.String()
 }
@@ -453,8 +565,9 @@ type KV struct {
 	Value        string
 	Comment      string
 	hasEquals    bool
-	leadingSpace int // Space before the key. TODO handle spaces vs tabs.
+	leadingSpace int // Space before the key of a KV built with NewKV.
 	position     Position
+	src          line
 }
 
 func NewKV(key, value string) *KV {
@@ -470,17 +583,29 @@ func (k *KV) Pos() Position {
 	return k.position
 }
 
-// String prints k as it was parsed in the config file. There may be slight
-// changes to the whitespace between values.
+// String prints k as it was parsed in the config file. A changed KV keeps
+// the indentation and separator of its line.
 func (k *KV) String() string {
 	if k == nil {
 		return ""
 	}
-	equals := " "
-	if k.hasEquals {
-		equals = " = "
+	return k.src.text(k.build())
+}
+
+// Args returns the arguments of the value the way OpenSSH splits them:
+// spaces and tabs separate arguments, quotes group characters into one, and
+// a backslash escapes a quote, a backslash or a space. An unterminated quote
+// runs to the end of the value. Value keeps the text as written.
+func (k *KV) Args() []string {
+	if k == nil {
+		return nil
 	}
-	line := fmt.Sprintf("%s%s%s%s", strings.Repeat(" ", int(k.leadingSpace)), k.Key, equals, k.Value)
+	args, _ := scanArgs(k.Value)
+	return args
+}
+
+func (k *KV) build() string {
+	line := k.src.prefix(k.leadingSpace, k.Key, k.hasEquals) + k.Value
 	if k.Comment != "" {
 		line += " #" + k.Comment
 	}
@@ -490,8 +615,9 @@ func (k *KV) String() string {
 // Empty is a line in the config file that contains only whitespace or comments.
 type Empty struct {
 	Comment      string
-	leadingSpace int // TODO handle spaces vs tabs.
+	leadingSpace int
 	position     Position
+	src          line
 }
 
 // Pos returns e's Position.
@@ -504,10 +630,18 @@ func (e *Empty) String() string {
 	if e == nil {
 		return ""
 	}
+	return e.src.text(e.build())
+}
+
+func (e *Empty) build() string {
 	if e.Comment == "" {
 		return ""
 	}
-	return fmt.Sprintf("%s#%s", strings.Repeat(" ", int(e.leadingSpace)), e.Comment)
+	indent := strings.Repeat(" ", e.leadingSpace)
+	if e.src.parsed {
+		indent = e.src.indent
+	}
+	return indent + "#" + e.Comment
 }
 
 // Include holds the result of an Include directive, including the config files
@@ -530,6 +664,8 @@ type Include struct {
 	position     Position
 	depth        uint8
 	hasEquals    bool
+	system       bool
+	src          line
 }
 
 const maxRecurseDepth = 5
@@ -572,21 +708,22 @@ func NewInclude(directives []string, hasEquals bool, pos Position, comment strin
 		hasEquals:    hasEquals,
 	}
 	// no need for inc.mu.Lock() since nothing else can access this inc
+	inc.system = system
 	matches := make([]string, 0)
 	for i := range directives {
-		var path string
-		if filepath.IsAbs(directives[i]) {
-			path = directives[i]
-		} else if system {
-			path = filepath.Join("/etc/ssh", directives[i])
-		} else {
-			path = filepath.Join(homedir(), ".ssh", directives[i])
-		}
-		theseMatches, err := filepath.Glob(path)
+		pattern := inc.expand(directives[i])
+		theseMatches, err := filepath.Glob(pattern)
 		if err != nil {
 			return nil, err
 		}
-		matches = append(matches, theseMatches...)
+		for _, m := range theseMatches {
+			// like glob(3), a wildcard does not match the leading dot of a
+			// name: conf.d/* skips the hidden temporary files of editors
+			if strings.HasPrefix(filepath.Base(m), ".") && !strings.HasPrefix(filepath.Base(pattern), ".") {
+				continue
+			}
+			matches = append(matches, m)
+		}
 	}
 	matches = removeDups(matches)
 	inc.matches = matches
@@ -600,6 +737,58 @@ func NewInclude(directives []string, hasEquals bool, pos Position, comment strin
 	return inc, nil
 }
 
+// expand returns the glob a directive stands for: relative paths are read
+// from ~/.ssh, or /etc/ssh for the system config.
+func (inc *Include) expand(directive string) string {
+	switch {
+	case strings.HasPrefix(directive, "~/"):
+		return filepath.Join(homedir(), directive[2:])
+	case filepath.IsAbs(directive):
+		return directive
+	case inc.system:
+		return filepath.Join("/etc/ssh", directive)
+	default:
+		return filepath.Join(homedir(), ".ssh", directive)
+	}
+}
+
+// Covers reports whether the Include directive reads the file at path, an
+// absolute path, whether or not the file exists.
+func (inc *Include) Covers(path string) bool {
+	for _, d := range inc.directives {
+		if ok, _ := filepath.Match(inc.expand(d), path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Attach adds cfg, the contents of the file at path, to the files of the
+// Include directive, in the position it would have had if the file existed
+// when the directive was parsed. It is used to make a file created after
+// parsing visible to lookups.
+func (inc *Include) Attach(path string, cfg *Config) {
+	inc.mu.Lock()
+	defer inc.mu.Unlock()
+	if cfg.path == "" {
+		cfg.path = path
+	}
+	inc.files[path] = cfg
+	var matches []string
+	for _, d := range inc.directives {
+		pattern := inc.expand(d)
+		var these []string
+		for fp := range inc.files {
+			if ok, _ := filepath.Match(pattern, fp); ok {
+				these = append(these, fp)
+			}
+		}
+		sort.Strings(these)
+		matches = append(matches, these...)
+	}
+	inc.matches = removeDups(matches)
+}
+
 // Pos returns the position of the Include directive in the larger file.
 func (i *Include) Pos() Position {
 	return i.position
@@ -610,33 +799,47 @@ func (i *Include) GetFiles() map[string]*Config {
 	return i.files
 }
 
+// Files returns the paths of the included files, in the order they are read.
+func (i *Include) Files() []string {
+	return i.matches
+}
+
 // Get finds the first value in the Include statement matching the alias and the
 // given key.
 func (inc *Include) Get(alias, key string) string {
+	val, _ := lookup([]*Config{{Hosts: []*Host{{
+		implicit: true,
+		Patterns: []*Pattern{matchAll},
+		Nodes:    []Node{inc},
+	}}}}, newMatchContext(alias, nil), key)
+	return val
+}
+
+// walk walks the included files in the order their names matched.
+func (inc *Include) walk(ctx *matchContext, visit func(*Config, *Host, *KV) bool) (bool, error) {
 	inc.mu.Lock()
 	defer inc.mu.Unlock()
-	// TODO: we search files in any order which is not correct
 	for i := range inc.matches {
 		cfg := inc.files[inc.matches[i]]
 		if cfg == nil {
 			panic("nil cfg")
 		}
-		val, err := cfg.Get(alias, key)
-		if err == nil && val != "" {
-			return val
+		found, err := cfg.walk(ctx, visit)
+		if err != nil || found {
+			return found, err
 		}
 	}
-	return ""
+	return false, nil
 }
 
 // String prints out a string representation of this Include directive. Note
 // included Config files are not printed as part of this representation.
 func (inc *Include) String() string {
-	equals := " "
-	if inc.hasEquals {
-		equals = " = "
-	}
-	line := fmt.Sprintf("%sInclude%s%s", strings.Repeat(" ", int(inc.leadingSpace)), equals, strings.Join(inc.directives, " "))
+	return inc.src.text(inc.build())
+}
+
+func (inc *Include) build() string {
+	line := inc.src.prefix(inc.leadingSpace, "Include", inc.hasEquals) + joinArgs(inc.directives)
 	if inc.Comment != "" {
 		line += " #" + inc.Comment
 	}
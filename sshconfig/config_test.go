@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -79,7 +80,7 @@ func TestGetInvalidPort(t *testing.T) {
 	if val != "" {
 		t.Errorf("expected to get '' for val, got %q", val)
 	}
-	if err.Error() != `sshconfig: strconv.ParseUint: parsing "notanumber": invalid syntax` {
+	if err.Error() != `ssh_config: strconv.ParseUint: parsing "notanumber": invalid syntax` {
 		t.Errorf("wrong error: got %v", err)
 	}
 }
@@ -272,6 +273,56 @@ func TestIncludeString(t *testing.T) {
 	}
 }
 
+func TestIncludeAttach(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "b"), []byte("Host b\n\tPort 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Decode(strings.NewReader("Include " + dir + "/*\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inc := c.Hosts[0].Nodes[0].(*Include)
+	path := filepath.Join(dir, "a")
+	if !inc.Covers(path) {
+		t.Fatalf("expected Include %s/* to cover %s", dir, path)
+	}
+	if inc.Covers(filepath.Join(t.TempDir(), "a")) {
+		t.Errorf("Include covers a file outside its directory")
+	}
+	added, err := Decode(strings.NewReader("Host a\n\tPort 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inc.Attach(path, added)
+	want := []string{path, filepath.Join(dir, "b")}
+	if got := inc.Files(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Files() = %v, want %v", got, want)
+	}
+	if got, _ := c.Get("a", "Port"); got != "1" {
+		t.Errorf("expected attached file to be read, got Port %q", got)
+	}
+}
+
+func TestIncludeHidden(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"b": "Host b\n\tPort 2\n", ".b.tmp-1": "Host b\n\tPort 3\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := Decode(strings.NewReader("Include " + dir + "/*\nInclude " + dir + "/.b.*\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Hosts[0].Nodes[0].(*Include).Files(); !reflect.DeepEqual(got, []string{filepath.Join(dir, "b")}) {
+		t.Errorf("Files() of * = %v, want only b", got)
+	}
+	if got := c.Hosts[0].Nodes[1].(*Include).Files(); !reflect.DeepEqual(got, []string{filepath.Join(dir, ".b.tmp-1")}) {
+		t.Errorf("Files() of .b.* = %v, want .b.tmp-1", got)
+	}
+}
+
 var matchTests = []struct {
 	in    []string
 	alias string
@@ -311,17 +362,97 @@ func TestMatches(t *testing.T) {
 	}
 }
 
-func TestMatchUnsupported(t *testing.T) {
+func TestMatchAll(t *testing.T) {
 	us := &UserSettings{
-		userConfigFinder: testConfigFinder("testdata/match-directive"),
+		userConfigFinder:   testConfigFinder("testdata/match-directive"),
+		systemConfigFinder: nullConfigFinder,
 	}
 
-	_, err := us.GetStrict("test.test", "Port")
-	if err == nil {
-		t.Fatal("expected Match directive to error, didn't")
+	val, err := us.GetStrict("test.test", "Port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "4567" {
+		t.Errorf("expected to find Port 4567, got %q", val)
+	}
+}
+
+func TestMatchCriteria(t *testing.T) {
+	var commands []string
+	us := &UserSettings{
+		userConfigFinder:   testConfigFinder("testdata/match"),
+		systemConfigFinder: nullConfigFinder,
+		MatchExec: func(command string) bool {
+			commands = append(commands, command)
+			return command == "test web.example.com = web.example.com"
+		},
+	}
+
+	tests := []struct {
+		alias, key, want string
+	}{
+		// host is matched against the HostName obtained so far.
+		{"web", "User", "deploy"},
+		{"db.example.com", "User", "deploy"},
+		{"db", "User", ""},
+		// originalhost is matched against the alias, user against the User.
+		{"web", "Port", "2222"},
+		{"web", "ForwardAgent", "yes"},
+		{"db", "ForwardAgent", "no"},
+		// final blocks apply in the second pass only.
+		{"web", "Compression", "yes"},
+		{"db", "Compression", "no"},
+		{"web", "IdentityFile", "~/.ssh/id_rsa"},
+	}
+	for _, tt := range tests {
+		got, err := us.GetStrict(tt.alias, tt.key)
+		if err != nil {
+			t.Fatalf("GetStrict(%q, %q): %v", tt.alias, tt.key, err)
+		}
+		if got != tt.want {
+			t.Errorf("GetStrict(%q, %q): got %q, want %q", tt.alias, tt.key, got, tt.want)
+		}
+	}
+	if len(commands) == 0 {
+		t.Errorf("expected Match exec commands to run")
 	}
-	if !strings.Contains(err.Error(), "sshconfig: Match directive parsing is unsupported") {
-		t.Errorf("wrong error: %v", err)
+}
+
+func TestMatchString(t *testing.T) {
+	data := loadFile(t, "testdata/match")
+	cfg, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := cfg.String(); out != string(data) {
+		t.Errorf("out != data: out: %q\ndata: %q", out, string(data))
+	}
+	match := cfg.Hosts[2].Match
+	if match == nil || len(match.Criteria) != 1 || match.Criteria[0].Arg != "*.example.com" {
+		t.Fatalf("unexpected Match criteria: %v", match)
+	}
+	if len(cfg.Hosts[2].Patterns) != 0 {
+		t.Errorf("expected Match block to have no patterns, got %v", cfg.Hosts[2].Patterns)
+	}
+}
+
+var newMatchErrors = []struct {
+	in  string
+	err string
+}{
+	{"", "sshconfig: Match directive has no criteria"},
+	{"host", `sshconfig: missing argument for Match attribute "host"`},
+	{"all host foo", `sshconfig: Match "all" cannot be combined with "host"`},
+	{"address 10.0.0.0/8", `sshconfig: unsupported Match attribute "address"`},
+	{`exec "test -f`, "sshconfig: unterminated quoted string"},
+}
+
+func TestNewMatchErrors(t *testing.T) {
+	for _, tt := range newMatchErrors {
+		_, err := NewMatch(tt.in)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("NewMatch(%q): got err %v, want %v", tt.in, err, tt.err)
+		}
 	}
 }
 
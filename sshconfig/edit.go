@@ -0,0 +1,51 @@
+package sshconfig
+
+import "strings"
+
+// Find returns the first key/value line of h for key, compared without case,
+// or nil if h does not set key.
+func (h *Host) Find(key string) *KV {
+	for _, node := range h.Nodes {
+		if kv, ok := node.(*KV); ok && strings.EqualFold(kv.Key, key) {
+			return kv
+		}
+	}
+	return nil
+}
+
+// Set edits h in place so that it sets key to value. The first line setting
+// key keeps its indentation, key case and comment and gets the new value,
+// the other lines for key are removed. If h does not set key, a line is
+// added after the last key/value line of the block, indented like it. An
+// empty value removes every line for key.
+func (h *Host) Set(key, value string) {
+	var nodes []Node
+	var found bool
+	last := -1
+	for _, node := range h.Nodes {
+		kv, ok := node.(*KV)
+		if ok && strings.EqualFold(kv.Key, key) {
+			if found || value == "" {
+				continue
+			}
+			found = true
+			kv.Value = value
+		}
+		if _, ok := node.(*Empty); !ok {
+			last = len(nodes)
+		}
+		nodes = append(nodes, node)
+	}
+	if !found && value != "" {
+		kv := NewKV(key, value)
+		if last >= 0 {
+			if sibling, ok := nodes[last].(*KV); ok && sibling.src.parsed {
+				kv.src.indent = sibling.src.indent
+				kv.src.sep = sibling.src.sep
+				kv.leadingSpace = 0
+			}
+		}
+		nodes = append(nodes[:last+1], append([]Node{kv}, nodes[last+1:]...)...)
+	}
+	h.Nodes = nodes
+}
@@ -0,0 +1,87 @@
+package sshconfig
+
+import (
+	"bytes"
+	"strings"
+)
+
+// formatIndent is the indentation of the keywords inside a Host or Match
+// block in canonical form.
+const formatIndent = "    "
+
+// Format returns c printed in canonical form: Host and Match lines start in
+// the first column, the keywords of a block are indented by four spaces, keys
+// and values are separated by a single space instead of "=", trailing spaces
+// are removed and runs of blank lines are collapsed into one. Comments in the
+// first column stay there. Included files are not part of the output.
+func (c Config) Format() string {
+	var buf bytes.Buffer
+	blank := false
+	writeLine := func(indent, line string) {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			if buf.Len() > 0 && !blank {
+				buf.WriteByte('\n')
+			}
+			blank = true
+			return
+		}
+		blank = false
+		buf.WriteString(indent)
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	for _, h := range c.Hosts {
+		indent := ""
+		if !h.implicit {
+			indent = formatIndent
+			writeLine("", h.formatHeader())
+		}
+		for _, node := range h.Nodes {
+			switch t := node.(type) {
+			case *KV:
+				writeLine(indent, formatLine(t.Key, t.Value, t.Comment))
+			case *Include:
+				writeLine(indent, formatLine("Include", joinArgs(t.directives), t.Comment))
+			case *Empty:
+				if t.Comment == "" {
+					writeLine("", "")
+				} else if t.leadingSpace == 0 {
+					writeLine("", "#"+t.Comment)
+				} else {
+					writeLine(indent, "#"+t.Comment)
+				}
+			default:
+				writeLine(indent, strings.TrimLeft(node.String(), " \t"))
+			}
+		}
+	}
+	out := strings.TrimRight(buf.String(), "\n")
+	if out == "" {
+		return ""
+	}
+	return out + "\n"
+}
+
+func (h *Host) formatHeader() string {
+	if h.Match != nil {
+		criteria := make([]string, len(h.Match.Criteria))
+		for i, c := range h.Match.Criteria {
+			criteria[i] = c.String()
+		}
+		return formatLine("Match", strings.Join(criteria, " "), h.Match.EOLComment)
+	}
+	patterns := make([]string, len(h.Patterns))
+	for i, p := range h.Patterns {
+		patterns[i] = p.String()
+	}
+	return formatLine("Host", joinArgs(patterns), h.EOLComment)
+}
+
+func formatLine(key, value, comment string) string {
+	line := key + " " + strings.TrimSpace(value)
+	if comment != "" {
+		line += " #" + comment
+	}
+	return line
+}
@@ -0,0 +1,40 @@
+package sshconfig
+
+import (
+	"strings"
+	"testing"
+)
+
+var formatTests = []struct {
+	in, want string
+}{
+	{"", ""},
+	{"\n\n", ""},
+	{
+		"# top comment\nInclude conf.d/*\n\n\nHost=web   # main\n\tHostName = web.example.com  \n  Port 22\n",
+		"# top comment\nInclude conf.d/*\n\nHost web # main\n    HostName web.example.com\n    Port 22\n",
+	},
+	{
+		"Host a b\n  User root\n\n# next host\nMatch host *.test exec \"true\"\n\t  # indented\n\tPort 2222",
+		"Host a b\n    User root\n\n# next host\nMatch host *.test exec true\n    # indented\n    Port 2222\n",
+	},
+}
+
+func TestFormat(t *testing.T) {
+	for _, tt := range formatTests {
+		cfg, err := Decode(strings.NewReader(tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cfg.Format(); got != tt.want {
+			t.Errorf("Format(%q):\ngot  %q\nwant %q", tt.in, got, tt.want)
+		}
+		again, err := Decode(strings.NewReader(tt.want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := again.Format(); got != tt.want {
+			t.Errorf("Format is not idempotent for %q: got %q", tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package sshconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Type is the kind of value a keyword takes.
+type Type int
+
+const (
+	// TypeString is any value.
+	TypeString Type = iota
+	// TypeYesNo is yes or no.
+	TypeYesNo
+	// TypeNumber is an unsigned integer.
+	TypeNumber
+	// TypeTime is a time interval such as 30, 90s or 1h30m.
+	TypeTime
+	// TypeEnum is one of KeywordSpec.Enum.
+	TypeEnum
+	// TypeList is a list of names, such as algorithms or variables.
+	TypeList
+	// TypePath is the path of a file or socket.
+	TypePath
+	// TypeCommand is a command run by the shell.
+	TypeCommand
+	// TypeForward is a forwarding specification such as 8080 localhost:80.
+	TypeForward
+)
+
+var typeNames = []string{"string", "yes/no", "number", "time", "enum", "list", "path", "command", "forward"}
+
+func (t Type) String() string {
+	if int(t) < len(typeNames) {
+		return typeNames[t]
+	}
+	return "Type(" + strconv.Itoa(int(t)) + ")"
+}
+
+// MarshalText encodes t as its name.
+func (t Type) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Version is an OpenSSH release. The zero Version stands for the latest
+// release.
+type Version struct {
+	Major int
+	Minor int
+}
+
+var versionRe = regexp.MustCompile(`^(?:OpenSSH_)?(\d+)\.(\d+)(?:p\d+)?(?:[ ,].*)?$`)
+
+// ParseVersion parses an OpenSSH release as written by "ssh -V", such as
+// 9.6, 9.6p1 or OpenSSH_9.6p1.
+func ParseVersion(s string) (Version, error) {
+	m := versionRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Version{}, fmt.Errorf("invalid OpenSSH version %q, expect a release such as 9.6", s)
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return Version{Major: major, Minor: minor}, nil
+}
+
+func (v Version) String() string {
+	if v.IsZero() {
+		return "latest"
+	}
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// MarshalText encodes v as major.minor, or the empty string for the zero
+// Version.
+func (v Version) MarshalText() ([]byte, error) {
+	if v.IsZero() {
+		return nil, nil
+	}
+	return []byte(v.String()), nil
+}
+
+// IsZero reports whether v is the zero Version.
+func (v Version) IsZero() bool {
+	return v == Version{}
+}
+
+// Before reports whether v is an older release than o. The zero Version is
+// newer than every other one.
+func (v Version) Before(o Version) bool {
+	switch {
+	case v.IsZero():
+		return false
+	case o.IsZero():
+		return true
+	case v.Major != o.Major:
+		return v.Major < o.Major
+	}
+	return v.Minor < o.Minor
+}
+
+// KeywordSpec describes a client keyword of ssh_config(5).
+type KeywordSpec struct {
+	// Name is the keyword as ssh_config(5) writes it.
+	Name string `json:"name" yaml:"name"`
+	Type Type   `json:"type" yaml:"type"`
+	// Enum lists the values of a TypeEnum keyword. For the other types it
+	// lists the words accepted besides their kind of value, such as none.
+	Enum []string `json:"enum,omitempty" yaml:"enum,omitempty"`
+	// Multi tells whether every occurrence of the keyword adds a value, as
+	// IdentityFile does, instead of only the first one being used.
+	Multi bool `json:"multi,omitempty" yaml:"multi,omitempty"`
+	// Default is the value ssh uses when no file sets the keyword, in the
+	// latest release. Multi-valued defaults are separated by spaces.
+	Default string `json:"default,omitempty" yaml:"default,omitempty"`
+	// Since is the release that added the keyword. It is zero for keywords
+	// older than OpenSSH 4.0.
+	Since Version `json:"since,omitempty" yaml:"since,omitempty"`
+	// Deprecated is the release from which ssh ignores or renames the
+	// keyword, zero if it is still in use.
+	Deprecated Version `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	// Note tells why the keyword is deprecated, or what replaces it.
+	Note string `json:"note,omitempty" yaml:"note,omitempty"`
+}
+
+// Available reports whether ssh of release v knows the keyword.
+func (s *KeywordSpec) Available(v Version) bool {
+	return s.Since.IsZero() || !v.Before(s.Since)
+}
+
+// IsDeprecated reports whether the keyword is deprecated in release v.
+func (s *KeywordSpec) IsDeprecated(v Version) bool {
+	return !s.Deprecated.IsZero() && !v.Before(s.Deprecated)
+}
+
+var timeRe = regexp.MustCompile(`^(\d+[sSmMhHdDwW]?)+$`)
+
+// Check reports whether args are valid arguments of the keyword: yes or no
+// for TypeYesNo, a number for TypeNumber, a time interval for TypeTime and
+// one of Enum for TypeEnum. Enum values are compared without case.
+func (s *KeywordSpec) Check(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing value for %s", s.Name)
+	}
+	val := args[0]
+	for _, e := range s.Enum {
+		if strings.EqualFold(e, val) {
+			return nil
+		}
+	}
+	switch s.Type {
+	case TypeEnum:
+		return fmt.Errorf("invalid value %q for %s, expect one of %s", val, s.Name, strings.Join(s.Enum, ", "))
+	case TypeYesNo:
+		if lval := strings.ToLower(val); lval != "yes" && lval != "no" {
+			return fmt.Errorf("invalid value %q for %s, expect yes or no", val, s.Name)
+		}
+	case TypeNumber:
+		if _, err := strconv.ParseUint(val, 10, 64); err != nil {
+			return fmt.Errorf("invalid value %q for %s, expect a number", val, s.Name)
+		}
+	case TypeTime:
+		if !timeRe.MatchString(val) {
+			if len(s.Enum) > 0 {
+				return fmt.Errorf("invalid value %q for %s, expect a time interval or one of %s", val, s.Name, strings.Join(s.Enum, ", "))
+			}
+			return fmt.Errorf("invalid value %q for %s, expect a time interval", val, s.Name)
+		}
+	}
+	return nil
+}
+
+var (
+	yesNo      = []string{"yes", "no"}
+	none       = []string{"none"}
+	algorithms = "ssh-ed25519-cert-v01@openssh.com,ecdsa-sha2-nistp256-cert-v01@openssh.com,ecdsa-sha2-nistp384-cert-v01@openssh.com,ecdsa-sha2-nistp521-cert-v01@openssh.com,sk-ssh-ed25519-cert-v01@openssh.com,sk-ecdsa-sha2-nistp256-cert-v01@openssh.com,rsa-sha2-512-cert-v01@openssh.com,rsa-sha2-256-cert-v01@openssh.com,ssh-ed25519,ecdsa-sha2-nistp256,ecdsa-sha2-nistp384,ecdsa-sha2-nistp521,sk-ssh-ed25519@openssh.com,sk-ecdsa-sha2-nistp256@openssh.com,rsa-sha2-512,rsa-sha2-256"
+)
+
+// catalogue holds the client keywords of OpenSSH, sorted by name. Defaults
+// are those of the latest release on Linux.
+var catalogue = []*KeywordSpec{
+	{Name: "AddKeysToAgent", Type: TypeTime, Enum: []string{"yes", "no", "ask", "confirm"}, Default: "no", Since: Version{7, 2}},
+	{Name: "AddressFamily", Type: TypeEnum, Enum: []string{"any", "inet", "inet6"}, Default: "any"},
+	{Name: "BatchMode", Type: TypeYesNo, Default: "no"},
+	{Name: "BindAddress", Type: TypeString},
+	{Name: "BindInterface", Type: TypeString, Since: Version{7, 7}},
+	{Name: "CanonicalDomains", Type: TypeList, Enum: none, Since: Version{6, 5}},
+	{Name: "CanonicalizeFallbackLocal", Type: TypeYesNo, Default: "yes", Since: Version{6, 5}},
+	{Name: "CanonicalizeHostname", Type: TypeEnum, Enum: []string{"yes", "no", "always", "none"}, Default: "no", Since: Version{6, 5}},
+	{Name: "CanonicalizeMaxDots", Type: TypeNumber, Default: "1", Since: Version{6, 5}},
+	{Name: "CanonicalizePermittedCNAMEs", Type: TypeList, Enum: none, Since: Version{6, 5}},
+	{Name: "CASignatureAlgorithms", Type: TypeList, Since: Version{7, 9}},
+	{Name: "CertificateFile", Type: TypePath, Multi: true, Since: Version{7, 2}},
+	{Name: "ChallengeResponseAuthentication", Type: TypeYesNo, Deprecated: Version{8, 7}, Note: "renamed KbdInteractiveAuthentication"},
+	{Name: "ChannelTimeout", Type: TypeList, Enum: none, Since: Version{9, 2}},
+	{Name: "CheckHostIP", Type: TypeYesNo, Default: "no"},
+	{Name: "Cipher", Type: TypeString, Deprecated: Version{7, 6}, Note: "SSH protocol 1 only, use Ciphers"},
+	{Name: "Ciphers", Type: TypeList, Default: "chacha20-poly1305@openssh.com,aes128-ctr,aes192-ctr,aes256-ctr,aes128-gcm@openssh.com,aes256-gcm@openssh.com"},
+	{Name: "ClearAllForwardings", Type: TypeYesNo, Default: "no"},
+	{Name: "Compression", Type: TypeYesNo, Default: "no"},
+	{Name: "CompressionLevel", Type: TypeNumber, Deprecated: Version{7, 6}, Note: "SSH protocol 1 only"},
+	{Name: "ConnectionAttempts", Type: TypeNumber, Default: "1"},
+	{Name: "ConnectTimeout", Type: TypeTime, Enum: none},
+	{Name: "ControlMaster", Type: TypeEnum, Enum: []string{"yes", "no", "ask", "auto", "autoask"}, Default: "no"},
+	{Name: "ControlPath", Type: TypePath, Enum: none},
+	{Name: "ControlPersist", Type: TypeTime, Enum: yesNo, Default: "no", Since: Version{5, 6}},
+	{Name: "DynamicForward", Type: TypeForward, Multi: true},
+	{Name: "EnableEscapeCommandline", Type: TypeYesNo, Default: "no", Since: Version{9, 2}},
+	{Name: "EnableSSHKeysign", Type: TypeYesNo, Default: "no"},
+	{Name: "EscapeChar", Type: TypeString, Enum: none, Default: "~"},
+	{Name: "ExitOnForwardFailure", Type: TypeYesNo, Default: "no", Since: Version{4, 4}},
+	{Name: "FallBackToRsh", Type: TypeYesNo, Deprecated: Version{4, 0}, Note: "removed"},
+	{Name: "FingerprintHash", Type: TypeEnum, Enum: []string{"md5", "sha256"}, Default: "sha256", Since: Version{6, 8}},
+	{Name: "ForkAfterAuthentication", Type: TypeYesNo, Default: "no", Since: Version{8, 7}},
+	// ForwardAgent also takes the path of an agent socket
+	{Name: "ForwardAgent", Type: TypeString, Enum: yesNo, Default: "no"},
+	{Name: "ForwardX11", Type: TypeYesNo, Default: "no"},
+	{Name: "ForwardX11Timeout", Type: TypeTime, Default: "20m", Since: Version{5, 6}},
+	{Name: "ForwardX11Trusted", Type: TypeYesNo, Default: "no"},
+	{Name: "GatewayPorts", Type: TypeYesNo, Default: "no"},
+	{Name: "GlobalKnownHostsFile", Type: TypePath, Enum: none, Default: "/etc/ssh/ssh_known_hosts /etc/ssh/ssh_known_hosts2"},
+	{Name: "GSSAPIAuthentication", Type: TypeYesNo, Default: "no"},
+	{Name: "GSSAPIDelegateCredentials", Type: TypeYesNo, Default: "no"},
+	{Name: "GSSAPIKeyExchange", Type: TypeYesNo, Deprecated: Version{4, 0}, Note: "not supported by OpenSSH"},
+	{Name: "HashKnownHosts", Type: TypeYesNo, Default: "no", Since: Version{4, 0}},
+	{Name: "Host", Type: TypeList},
+	{Name: "HostbasedAcceptedAlgorithms", Type: TypeList, Default: algorithms, Since: Version{8, 5}},
+	{Name: "HostbasedAuthentication", Type: TypeYesNo, Default: "no"},
+	{Name: "HostbasedKeyTypes", Type: TypeList, Since: Version{6, 8}, Deprecated: Version{8, 5}, Note: "renamed HostbasedAcceptedAlgorithms"},
+	{Name: "HostKeyAlgorithms", Type: TypeList, Default: algorithms},
+	{Name: "HostKeyAlias", Type: TypeString},
+	// the default of HostName is the alias, see Resolver
+	{Name: "HostName", Type: TypeString},
+	{Name: "IdentitiesOnly", Type: TypeYesNo, Default: "no"},
+	{Name: "IdentityAgent", Type: TypePath, Enum: []string{"none", "SSH_AUTH_SOCK"}, Since: Version{7, 3}},
+	{Name: "IdentityFile", Type: TypePath, Enum: none, Multi: true, Default: "~/.ssh/id_rsa ~/.ssh/id_ecdsa ~/.ssh/id_ecdsa_sk ~/.ssh/id_ed25519 ~/.ssh/id_ed25519_sk"},
+	{Name: "IgnoreUnknown", Type: TypeList, Since: Version{6, 3}},
+	{Name: "Include", Type: TypePath, Multi: true, Since: Version{7, 3}},
+	// IPQoS depends on whether the session is interactive
+	{Name: "IPQoS", Type: TypeString, Enum: none, Since: Version{5, 9}},
+	{Name: "KbdInteractiveAuthentication", Type: TypeYesNo, Default: "yes"},
+	{Name: "KbdInteractiveDevices", Type: TypeList},
+	{Name: "KexAlgorithms", Type: TypeList, Default: "sntrup761x25519-sha512,sntrup761x25519-sha512@openssh.com,curve25519-sha256,curve25519-sha256@libssh.org,ecdh-sha2-nistp256,ecdh-sha2-nistp384,ecdh-sha2-nistp521,diffie-hellman-group-exchange-sha256,diffie-hellman-group16-sha512,diffie-hellman-group18-sha512,diffie-hellman-group14-sha256", Since: Version{5, 7}},
+	{Name: "KnownHostsCommand", Type: TypeCommand, Enum: none, Since: Version{8, 5}},
+	{Name: "LocalCommand", Type: TypeCommand, Since: Version{4, 3}},
+	{Name: "LocalForward", Type: TypeForward, Multi: true},
+	{Name: "LogLevel", Type: TypeEnum, Enum: []string{"QUIET", "FATAL", "ERROR", "INFO", "VERBOSE", "DEBUG", "DEBUG1", "DEBUG2", "DEBUG3"}, Default: "INFO"},
+	{Name: "LogVerbose", Type: TypeList, Since: Version{8, 5}},
+	{Name: "MACs", Type: TypeList, Default: "umac-64-etm@openssh.com,umac-128-etm@openssh.com,hmac-sha2-256-etm@openssh.com,hmac-sha2-512-etm@openssh.com,hmac-sha1-etm@openssh.com,umac-64@openssh.com,umac-128@openssh.com,hmac-sha2-256,hmac-sha2-512,hmac-sha1"},
+	{Name: "Match", Type: TypeString, Since: Version{6, 5}},
+	{Name: "NoHostAuthenticationForLocalhost", Type: TypeYesNo, Default: "no"},
+	{Name: "NumberOfPasswordPrompts", Type: TypeNumber, Default: "3"},
+	{Name: "ObscureKeystrokeTiming", Type: TypeString, Enum: yesNo, Default: "yes", Since: Version{9, 5}},
+	{Name: "PasswordAuthentication", Type: TypeYesNo, Default: "yes"},
+	{Name: "PermitLocalCommand", Type: TypeYesNo, Default: "no", Since: Version{4, 3}},
+	{Name: "PermitRemoteOpen", Type: TypeList, Enum: []string{"any", "none"}, Since: Version{8, 4}},
+	{Name: "PKCS11Provider", Type: TypePath, Enum: none, Since: Version{5, 4}},
+	{Name: "Port", Type: TypeNumber, Default: "22"},
+	{Name: "PreferredAuthentications", Type: TypeList, Default: "gssapi-with-mic,hostbased,publickey,keyboard-interactive,password"},
+	{Name: "Protocol", Type: TypeString, Deprecated: Version{7, 6}, Note: "SSH protocol 1 support was removed"},
+	{Name: "ProxyCommand", Type: TypeCommand, Enum: none},
+	{Name: "ProxyJump", Type: TypeList, Enum: none, Since: Version{7, 3}},
+	{Name: "ProxyUseFdpass", Type: TypeYesNo, Default: "no", Since: Version{6, 5}},
+	{Name: "PubkeyAcceptedAlgorithms", Type: TypeList, Default: algorithms, Since: Version{8, 5}},
+	{Name: "PubkeyAcceptedKeyTypes", Type: TypeList, Since: Version{7, 0}, Deprecated: Version{8, 5}, Note: "renamed PubkeyAcceptedAlgorithms"},
+	{Name: "PubkeyAuthentication", Type: TypeEnum, Enum: []string{"yes", "no", "unbound", "host-bound"}, Default: "yes"},
+	{Name: "RekeyLimit", Type: TypeString, Default: "default none"},
+	{Name: "RemoteCommand", Type: TypeCommand, Enum: none, Since: Version{7, 6}},
+	{Name: "RemoteForward", Type: TypeForward, Multi: true},
+	{Name: "RequestTTY", Type: TypeEnum, Enum: []string{"yes", "no", "force", "auto"}, Since: Version{5, 9}},
+	{Name: "RequiredRSASize", Type: TypeNumber, Default: "1024", Since: Version{9, 1}},
+	{Name: "RevokedHostKeys", Type: TypePath, Enum: none},
+	{Name: "RhostsRSAAuthentication", Type: TypeYesNo, Deprecated: Version{7, 6}, Note: "SSH protocol 1 only"},
+	{Name: "RSAAuthentication", Type: TypeYesNo, Deprecated: Version{7, 6}, Note: "SSH protocol 1 only"},
+	{Name: "SecurityKeyProvider", Type: TypePath, Since: Version{8, 2}},
+	{Name: "SendEnv", Type: TypeList, Multi: true},
+	{Name: "ServerAliveCountMax", Type: TypeNumber, Default: "3"},
+	{Name: "ServerAliveInterval", Type: TypeTime, Default: "0"},
+	{Name: "SessionType", Type: TypeEnum, Enum: []string{"none", "subsystem", "default"}, Default: "default", Since: Version{8, 7}},
+	{Name: "SetEnv", Type: TypeList, Multi: true, Since: Version{7, 8}},
+	{Name: "StdinNull", Type: TypeYesNo, Default: "no", Since: Version{8, 7}},
+	{Name: "StreamLocalBindMask", Type: TypeString, Default: "0177", Since: Version{6, 7}},
+	{Name: "StreamLocalBindUnlink", Type: TypeYesNo, Default: "no", Since: Version{6, 7}},
+	{Name: "StrictHostKeyChecking", Type: TypeEnum, Enum: []string{"yes", "no", "ask", "accept-new", "off"}, Default: "ask"},
+	{Name: "SyslogFacility", Type: TypeEnum, Enum: []string{"DAEMON", "USER", "AUTH", "LOCAL0", "LOCAL1", "LOCAL2", "LOCAL3", "LOCAL4", "LOCAL5", "LOCAL6", "LOCAL7"}, Default: "USER"},
+	{Name: "Tag", Type: TypeString, Since: Version{9, 4}},
+	{Name: "TCPKeepAlive", Type: TypeYesNo, Default: "yes"},
+	{Name: "Tunnel", Type: TypeEnum, Enum: []string{"yes", "no", "point-to-point", "ethernet"}, Default: "no", Since: Version{4, 3}},
+	{Name: "TunnelDevice", Type: TypeString, Default: "any:any", Since: Version{4, 3}},
+	{Name: "UpdateHostKeys", Type: TypeEnum, Enum: []string{"yes", "no", "ask"}, Default: "yes", Since: Version{6, 8}},
+	// accepted by the ssh of macOS
+	{Name: "UseKeychain", Type: TypeYesNo, Default: "no"},
+	{Name: "UsePrivilegedPort", Type: TypeYesNo, Deprecated: Version{7, 5}, Note: "removed"},
+	{Name: "User", Type: TypeString},
+	{Name: "UserKnownHostsFile", Type: TypePath, Enum: none, Default: "~/.ssh/known_hosts ~/.ssh/known_hosts2"},
+	{Name: "UseRoaming", Type: TypeYesNo, Deprecated: Version{7, 2}, Note: "removed"},
+	{Name: "UseRsh", Type: TypeYesNo, Deprecated: Version{4, 0}, Note: "removed"},
+	{Name: "VerifyHostKeyDNS", Type: TypeEnum, Enum: []string{"yes", "no", "ask"}, Default: "no"},
+	{Name: "VisualHostKey", Type: TypeYesNo, Default: "no", Since: Version{5, 1}},
+	{Name: "XAuthLocation", Type: TypePath, Default: "/usr/X11R6/bin/xauth"},
+}
+
+var (
+	specs = map[string]*KeywordSpec{}
+	// defaults holds the default of every keyword that has one
+	defaults = map[string]string{}
+)
+
+func init() {
+	for _, s := range catalogue {
+		lkey := strings.ToLower(s.Name)
+		specs[lkey] = s
+		if s.Default != "" {
+			defaults[lkey] = s.Default
+		}
+	}
+}
+
+// LookupKeyword returns the description of keyword, compared without case,
+// or nil if ssh does not know keyword.
+func LookupKeyword(keyword string) *KeywordSpec {
+	return specs[strings.ToLower(keyword)]
+}
+
+// Keywords returns the keywords ssh of release v knows, deprecated ones
+// included, sorted by name. The zero Version returns every keyword.
+func Keywords(v Version) []*KeywordSpec {
+	var list []*KeywordSpec
+	for _, s := range catalogue {
+		if s.Available(v) {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// Keyword returns the name of keyword as ssh_config(5) writes it, and
+// whether ssh knows keyword. Deprecated keywords are known.
+func Keyword(keyword string) (string, bool) {
+	if s := LookupKeyword(keyword); s != nil {
+		return s.Name, true
+	}
+	return "", false
+}
+
+// Deprecated returns why keyword should not be used any more, or the empty
+// string if it is not deprecated in the latest release.
+func Deprecated(keyword string) string {
+	if s := LookupKeyword(keyword); s != nil && s.IsDeprecated(Version{}) {
+		return s.Note
+	}
+	return ""
+}
+
+// IsMultiValued reports whether every occurrence of keyword adds a value, as
+// IdentityFile does, instead of only the first one being used. Keyword
+// matching is case-insensitive.
+func IsMultiValued(keyword string) bool {
+	s := LookupKeyword(keyword)
+	return s != nil && s.Multi
+}
+
+// Suggest returns the keyword in use closest to keyword, or the empty string
+// if none is close enough to be a likely typo.
+func Suggest(keyword string) string {
+	lkey := strings.ToLower(keyword)
+	best, bestDist := "", len(lkey)/3+1
+	for _, s := range catalogue {
+		if s.IsDeprecated(Version{}) {
+			continue
+		}
+		if d := levenshtein(lkey, strings.ToLower(s.Name)); d < bestDist {
+			best, bestDist = s.Name, d
+		}
+	}
+	return best
+}
+
+// CheckValue reports whether the arguments of a keyword are valid, see
+// KeywordSpec.Check. Unknown keywords take any value.
+func CheckValue(keyword string, args []string) error {
+	s := LookupKeyword(keyword)
+	if s == nil {
+		if len(args) == 0 {
+			return fmt.Errorf("missing value for %s", keyword)
+		}
+		return nil
+	}
+	return s.Check(args)
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,91 @@
+package sshconfig
+
+import (
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Version
+	}{
+		{"9.6", Version{9, 6}},
+		{"8.4p1", Version{8, 4}},
+		{"OpenSSH_9.6p1 Ubuntu-3ubuntu13, OpenSSL 3.0.13 30 Jan 2024", Version{9, 6}},
+		{"10.0", Version{10, 0}},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.in)
+		if err != nil {
+			t.Errorf("ParseVersion(%q): %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("ParseVersion(%q): got %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	if _, err := ParseVersion("nine"); err == nil {
+		t.Errorf("ParseVersion(%q): got nil error", "nine")
+	}
+	if !(Version{9, 6}).Before(Version{10, 0}) || (Version{}).Before(Version{9, 6}) || !(Version{9, 6}).Before(Version{}) {
+		t.Errorf("Before: wrong order of releases")
+	}
+}
+
+func TestKeywordsVersion(t *testing.T) {
+	names := func(v Version) map[string]bool {
+		set := map[string]bool{}
+		for _, s := range Keywords(v) {
+			set[s.Name] = true
+		}
+		return set
+	}
+	old, latest := names(Version{7, 2}), names(Version{})
+	for _, k := range []string{"ProxyJump", "IdentityAgent", "RemoteCommand", "StdinNull", "KnownHostsCommand", "RequiredRSASize", "EnableEscapeCommandline"} {
+		if old[k] {
+			t.Errorf("Keywords(7.2): unexpected %s", k)
+		}
+		if !latest[k] {
+			t.Errorf("Keywords(latest): missing %s", k)
+		}
+	}
+	if !old["Port"] || !old["AddKeysToAgent"] {
+		t.Errorf("Keywords(7.2): missing Port or AddKeysToAgent")
+	}
+
+	spec := LookupKeyword("challengeresponseauthentication")
+	if spec == nil || spec.IsDeprecated(Version{8, 6}) || !spec.IsDeprecated(Version{8, 7}) || !spec.IsDeprecated(Version{}) {
+		t.Errorf("ChallengeResponseAuthentication should be deprecated from 8.7 only")
+	}
+	if !IsMultiValued("identityfile") || IsMultiValued("Port") {
+		t.Errorf("IsMultiValued: IdentityFile is multi-valued, Port is not")
+	}
+}
+
+func TestCheckValue(t *testing.T) {
+	tests := []struct {
+		key  string
+		args []string
+		err  string
+	}{
+		{"Port", []string{"22"}, ""},
+		{"Port", []string{"ssh"}, `invalid value "ssh" for Port, expect a number`},
+		{"Compression", []string{"Yes"}, ""},
+		{"StdinNull", []string{"maybe"}, `invalid value "maybe" for StdinNull, expect yes or no`},
+		{"StrictHostKeyChecking", []string{"accept-new"}, ""},
+		{"LogLevel", []string{"loud"}, `invalid value "loud" for LogLevel, expect one of QUIET, FATAL, ERROR, INFO, VERBOSE, DEBUG, DEBUG1, DEBUG2, DEBUG3`},
+		{"ConnectTimeout", []string{"1m30s"}, ""},
+		{"ControlPersist", []string{"yes"}, ""},
+		{"ControlPersist", []string{"later"}, `invalid value "later" for ControlPersist, expect a time interval or one of yes, no`},
+		{"ForwardAgent", []string{"$SSH_AUTH_SOCK"}, ""},
+		{"IdentityFile", nil, "missing value for IdentityFile"},
+		{"UnknownKeyword", []string{"anything"}, ""},
+	}
+	for _, tt := range tests {
+		err := CheckValue(tt.key, tt.args)
+		if tt.err == "" && err != nil {
+			t.Errorf("CheckValue(%q, %q): got %v, want nil", tt.key, tt.args, err)
+		}
+		if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("CheckValue(%q, %q): got err %v, want %v", tt.key, tt.args, err, tt.err)
+		}
+	}
+}
@@ -30,7 +30,7 @@ func (s *sshLexer) lexComment(previousState sshLexStateFn) sshLexStateFn {
 			s.next()
 		}
 		s.emitWithValue(tokenComment, growingString)
-		s.skip()
+		s.skipEOL()
 		return previousState
 	}
 }
@@ -81,36 +81,52 @@ func (s *sshLexer) lexKey() sshLexStateFn {
 	return s.lexEquals
 }
 
+// lexRvalue lex the arguments of a keyword up to the end of the line. As in
+// OpenSSH, a # starts a comment only at the start of an argument outside
+// quotes, and a backslash escapes the next character. The value keeps its
+// quotes and escapes, trailing blanks are dropped.
 func (s *sshLexer) lexRvalue() sshLexStateFn {
 	growingString := ""
+	var quote rune
+	start := true // at the start of an argument
 	for {
 		next := s.peek()
-		switch next {
-		case '\r':
-			if s.follow("\r\n") {
-				s.emitWithValue(tokenString, growingString)
-				s.skip()
-				return s.lexVoid
-			}
-		case '\n':
-			s.emitWithValue(tokenString, growingString)
-			s.skip()
+		switch {
+		case next == eof:
+			s.emitWithValue(tokenEOF, trimBlanks(growingString))
+			return nil
+		case next == '\n' || next == '\r' && s.follow("\r\n"):
+			s.emitWithValue(tokenString, trimBlanks(growingString))
+			s.skipEOL()
 			return s.lexVoid
-		case '#':
-			s.emitWithValue(tokenString, growingString)
+		case next == '#' && quote == 0 && start:
+			s.emitWithValue(tokenString, trimBlanks(growingString))
 			s.skip()
 			return s.lexComment(s.lexVoid)
-		case eof:
-			s.next()
 		}
-		if next == eof {
-			break
+		switch {
+		case next == '\\':
+			growingString += string(s.next())
+			if r := s.peek(); r != eof && r != '\n' && !(r == '\r' && s.follow("\r\n")) {
+				growingString += string(s.next())
+			}
+			start = false
+			continue
+		case quote != 0:
+			if next == quote {
+				quote = 0
+			}
+		case next == '"' || next == '\'':
+			quote = next
+			start = false
+		case isSpace(next):
+			start = true
+		default:
+			start = false
 		}
 		growingString += string(next)
 		s.next()
 	}
-	s.emit(tokenEOF)
-	return nil
 }
 
 func (s *sshLexer) read() rune {
@@ -142,6 +158,11 @@ func (s *sshLexer) lexVoid() sshLexStateFn {
 			s.skip()
 			return s.lexComment(s.lexVoid)
 		case '\r':
+			if s.follow("\r\n") {
+				// the line ends with the \n
+				s.skip()
+				continue
+			}
 			fallthrough
 		case '\n':
 			s.emit(tokenEmptyLine)
@@ -180,6 +201,14 @@ func (s *sshLexer) skip() {
 	s.ignore()
 }
 
+// skipEOL skip the line ending at the cursor, \r\n counts as one
+func (s *sshLexer) skipEOL() {
+	if s.follow("\r\n") {
+		s.skip()
+	}
+	s.skip()
+}
+
 func (s *sshLexer) emit(t tokenType) {
 	s.emitWithValue(t, string(s.buffer))
 }
@@ -0,0 +1,139 @@
+package sshconfig
+
+import (
+	"bytes"
+	"strings"
+)
+
+// line is the text a node was parsed from. A node prints the text as it was
+// read while it is unchanged, that is while it builds the same line as when
+// it was parsed; an edited node is rebuilt with the indentation, keyword
+// case and separator of the original line.
+type line struct {
+	raw    string // the line as read, without its line ending
+	eol    string // "\n", "\r\n", or empty on a last line without one
+	built  string // the line the node built when it was parsed
+	parsed bool
+
+	indent string // blanks before the keyword
+	key    string // the keyword as written
+	sep    string // blanks and "=" between the keyword and the value
+}
+
+// newLine split raw into its indentation, keyword and separator
+func newLine(raw, eol string) line {
+	l := line{raw: raw, eol: eol, parsed: true}
+	rest := strings.TrimLeft(raw, " \t")
+	l.indent = raw[:len(raw)-len(rest)]
+	i := strings.IndexAny(rest, " \t=")
+	if i < 0 {
+		l.key = rest
+		return l
+	}
+	l.key = rest[:i]
+	value := strings.TrimLeft(rest[i:], " \t=")
+	l.sep = rest[i : len(rest)-len(value)]
+	return l
+}
+
+// text return the raw line if built is the line the node built when it
+// was parsed, built otherwise
+func (l *line) text(built string) string {
+	if l.parsed && built == l.built {
+		return l.raw
+	}
+	return built
+}
+
+// prefix return what precedes the value of a rebuilt line: the original
+// indentation and separator if the node was parsed, with the original
+// keyword if it is still key, or indent spaces and a default separator
+func (l *line) prefix(indent int, key string, hasEquals bool) string {
+	var buf strings.Builder
+	if l.parsed || l.indent != "" {
+		buf.WriteString(l.indent)
+	} else {
+		buf.WriteString(strings.Repeat(" ", indent))
+	}
+	if l.parsed && strings.EqualFold(l.key, key) {
+		buf.WriteString(l.key)
+	} else {
+		buf.WriteString(key)
+	}
+	switch {
+	case l.sep != "":
+		buf.WriteString(l.sep)
+	case hasEquals:
+		buf.WriteString(" = ")
+	default:
+		buf.WriteString(" ")
+	}
+	return buf.String()
+}
+
+// splitLines split b into lines and their line endings
+func splitLines(b []byte) (lines, eols []string) {
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			lines = append(lines, string(b))
+			eols = append(eols, "")
+			break
+		}
+		text, eol := b[:i], "\n"
+		if bytes.HasSuffix(text, []byte("\r")) {
+			text, eol = text[:len(text)-1], "\r\n"
+		}
+		lines = append(lines, string(text))
+		eols = append(eols, eol)
+		b = b[i+1:]
+	}
+	return lines, eols
+}
+
+// lineWriter write lines with the line ending they were read with. New lines
+// end like the last line written, and a line read without line ending gets
+// one when another line follows.
+type lineWriter struct {
+	buf  bytes.Buffer
+	eol  string
+	open bool
+}
+
+func (w *lineWriter) write(text string, l *line) {
+	if w.open {
+		w.buf.WriteString(w.newline())
+		w.open = false
+	}
+	w.buf.WriteString(text)
+	eol := w.newline()
+	if l != nil && l.parsed {
+		eol = l.eol
+	}
+	if eol == "" {
+		w.open = true
+		return
+	}
+	w.eol = eol
+	w.buf.WriteString(eol)
+}
+
+func (w *lineWriter) newline() string {
+	if w.eol == "" {
+		return "\n"
+	}
+	return w.eol
+}
+
+// source return the line a node was parsed from
+func source(n Node) *line {
+	switch t := n.(type) {
+	case *KV:
+		return &t.src
+	case *Empty:
+		return &t.src
+	case *Include:
+		return &t.src
+	}
+	return nil
+}
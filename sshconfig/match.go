@@ -0,0 +1,354 @@
+package sshconfig
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	osuser "os/user"
+	"strings"
+)
+
+// MatchExecFunc runs the command of a "Match exec" criterion, after its
+// tokens have been expanded, and reports whether it exited with status zero.
+type MatchExecFunc func(command string) bool
+
+// MatchExec is the MatchExecFunc used to evaluate "Match exec" criteria when
+// no other function is configured. It runs the command with the user's shell,
+// as ssh does.
+var MatchExec MatchExecFunc = shellExec
+
+func shellExec(command string) bool {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	return exec.Command(shell, "-c", command).Run() == nil
+}
+
+// Match criteria names understood by the parser.
+var matchCriteria = map[string]bool{
+	"all":          true,
+	"canonical":    true,
+	"final":        true,
+	"exec":         true,
+	"localnetwork": true,
+	"host":         true,
+	"originalhost": true,
+	"tagged":       true,
+	"user":         true,
+	"localuser":    true,
+}
+
+// MatchCriterion is a single criterion of a Match directive, such as
+// "host *.example.com" or "!exec test-vpn".
+type MatchCriterion struct {
+	// Name is the criterion keyword as written, e.g. "host" or "exec".
+	Name string
+	// Arg is the criterion argument. It is empty for "all", "canonical"
+	// and "final".
+	Arg string
+	// Negated is true if the criterion was prefixed with an exclamation mark.
+	Negated bool
+}
+
+// String prints c as it would appear in a Match directive.
+func (c *MatchCriterion) String() string {
+	s := c.Name
+	if c.Negated {
+		s = "!" + s
+	}
+	if takesArg(strings.ToLower(c.Name)) {
+		s += " " + QuoteArg(c.Arg)
+	}
+	return s
+}
+
+func takesArg(name string) bool {
+	return name != "all" && name != "canonical" && name != "final"
+}
+
+// Match describes a Match directive. The keywords that follow it are stored
+// in the Nodes of the Host that holds it.
+type Match struct {
+	// Criteria are the conditions that must all be satisfied for the block
+	// to apply.
+	Criteria []*MatchCriterion
+	// EOLComment is the comment (if any) terminating the Match line.
+	EOLComment   string
+	hasEquals    bool
+	leadingSpace int
+	position     Position
+}
+
+// NewMatch parses the arguments of a Match directive, for example
+// `host *.example.com exec "test -f /tmp/vpn"`.
+func NewMatch(s string) (*Match, error) {
+	args, err := SplitArgs(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("sshconfig: Match directive has no criteria")
+	}
+	m := &Match{}
+	hasAll := false
+	for i := 0; i < len(args); i++ {
+		c := &MatchCriterion{Name: args[i]}
+		if strings.HasPrefix(c.Name, "!") {
+			c.Negated = true
+			c.Name = c.Name[1:]
+		}
+		name := strings.ToLower(c.Name)
+		if !matchCriteria[name] {
+			return nil, fmt.Errorf("sshconfig: unsupported Match attribute %q", c.Name)
+		}
+		if name == "all" {
+			hasAll = true
+		}
+		if takesArg(name) {
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, fmt.Errorf("sshconfig: missing argument for Match attribute %q", c.Name)
+			}
+			i++
+			c.Arg = args[i]
+		}
+		m.Criteria = append(m.Criteria, c)
+	}
+	if hasAll {
+		for _, c := range m.Criteria {
+			name := strings.ToLower(c.Name)
+			if name != "all" && name != "canonical" && name != "final" {
+				return nil, fmt.Errorf("sshconfig: Match \"all\" cannot be combined with %q", c.Name)
+			}
+		}
+	}
+	return m, nil
+}
+
+// Pos returns m's Position.
+func (m *Match) Pos() Position {
+	return m.position
+}
+
+// String prints m as it would appear in a config file.
+func (m *Match) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(strings.Repeat(" ", m.leadingSpace))
+	buf.WriteString("Match")
+	if m.hasEquals {
+		buf.WriteString(" = ")
+	} else {
+		buf.WriteString(" ")
+	}
+	for i, c := range m.Criteria {
+		buf.WriteString(c.String())
+		if i < len(m.Criteria)-1 {
+			buf.WriteString(" ")
+		}
+	}
+	if m.EOLComment != "" {
+		buf.WriteString(" #")
+		buf.WriteString(m.EOLComment)
+	}
+	return buf.String()
+}
+
+// matchContext carries the state a Match directive is evaluated against:
+// the alias given on the command line and the first values obtained so far
+// for the keywords the criteria depend on, as ssh tracks them while reading
+// its configuration.
+type matchContext struct {
+	originalHost string
+	hostname     string
+	user         string
+	port         string
+	tag          string
+	localUser    string
+	exec         MatchExecFunc
+	// final is set while evaluating the final pass.
+	final bool
+	// wantFinal is set when a "Match final" criterion was seen.
+	wantFinal bool
+}
+
+func newMatchContext(alias string, run MatchExecFunc) *matchContext {
+	if run == nil {
+		run = MatchExec
+	}
+	localUser := os.Getenv("USER")
+	if u, err := osuser.Current(); err == nil {
+		localUser = u.Username
+	}
+	return &matchContext{originalHost: alias, localUser: localUser, exec: run}
+}
+
+// observe records the value of kv if it is one of the keywords Match
+// criteria depend on and no value was obtained for it yet.
+func (ctx *matchContext) observe(kv *KV) {
+	var field *string
+	switch strings.ToLower(kv.Key) {
+	case "hostname":
+		field = &ctx.hostname
+	case "user":
+		field = &ctx.user
+	case "port":
+		field = &ctx.port
+	case "tag":
+		field = &ctx.tag
+	default:
+		return
+	}
+	if *field == "" {
+		*field = kv.Value
+	}
+}
+
+// host returns the target host name: the HostName obtained so far, with %h
+// expanded, or the original host.
+func (ctx *matchContext) host() string {
+	if ctx.hostname == "" {
+		return ctx.originalHost
+	}
+	return strings.ReplaceAll(ctx.hostname, "%h", ctx.originalHost)
+}
+
+func (ctx *matchContext) remoteUser() string {
+	if ctx.user == "" {
+		return ctx.localUser
+	}
+	return ctx.user
+}
+
+// expand replaces the tokens accepted by "Match exec" in s.
+func (ctx *matchContext) expand(s string) string {
+	port := ctx.port
+	if port == "" {
+		port = Default("Port")
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+1 >= len(s) {
+			buf.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case '%':
+			buf.WriteByte('%')
+		case 'h':
+			buf.WriteString(ctx.host())
+		case 'n':
+			buf.WriteString(ctx.originalHost)
+		case 'p':
+			buf.WriteString(port)
+		case 'r':
+			buf.WriteString(ctx.remoteUser())
+		case 'u':
+			buf.WriteString(ctx.localUser)
+		case 'd':
+			buf.WriteString(homedir())
+		case 'L', 'l':
+			h, _ := os.Hostname()
+			if s[i] == 'L' {
+				h, _, _ = strings.Cut(h, ".")
+			}
+			buf.WriteString(h)
+		default:
+			buf.WriteByte('%')
+			buf.WriteByte(s[i])
+		}
+	}
+	return buf.String()
+}
+
+// matchPatternList reports whether s matches the comma-separated pattern
+// list. A negated pattern that matches makes the whole list fail.
+func matchPatternList(s, list string, foldCase bool) bool {
+	if foldCase {
+		s = strings.ToLower(s)
+	}
+	found := false
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if foldCase {
+			p = strings.ToLower(p)
+		}
+		pat, err := NewPattern(p)
+		if err != nil {
+			continue
+		}
+		if pat.regex.MatchString(s) {
+			if pat.not {
+				return false
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+// matchLocalNetwork reports whether any local interface address falls into
+// one of the comma-separated CIDR networks in list.
+func matchLocalNetwork(list string) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, cidr := range strings.Split(list, ",") {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && network.Contains(ipnet.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches evaluates the criteria of m in ctx. All criteria must be satisfied
+// for the Match block to apply.
+func (m *Match) matches(ctx *matchContext) bool {
+	result := true
+	for _, c := range m.Criteria {
+		var r bool
+		switch strings.ToLower(c.Name) {
+		case "all":
+			r = true
+		case "canonical", "final":
+			if strings.ToLower(c.Name) == "final" {
+				ctx.wantFinal = true
+			}
+			r = ctx.final
+		case "host":
+			r = matchPatternList(ctx.host(), c.Arg, true)
+		case "originalhost":
+			r = matchPatternList(ctx.originalHost, c.Arg, true)
+		case "user":
+			r = matchPatternList(ctx.remoteUser(), c.Arg, false)
+		case "localuser":
+			r = matchPatternList(ctx.localUser, c.Arg, false)
+		case "tagged":
+			r = matchPatternList(ctx.tag, c.Arg, false)
+		case "localnetwork":
+			r = matchLocalNetwork(c.Arg)
+		case "exec":
+			if !result {
+				// ssh skips running commands once the block failed.
+				continue
+			}
+			r = ctx.exec(ctx.expand(c.Arg))
+		}
+		if r == c.Negated {
+			result = false
+		}
+	}
+	return result
+}
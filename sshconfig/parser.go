@@ -15,6 +15,10 @@ type sshParser struct {
 	// filepaths in the Include directive
 	system bool
 	depth  uint8
+	// lines and eols of the input, last the last line a node was read from
+	lines []string
+	eols  []string
+	last  int
 }
 
 type sshParserStateFn func() sshParserStateFn
@@ -81,7 +85,7 @@ func (p *sshParser) parseStart() sshParserStateFn {
 	case tokenEOF:
 		return nil
 	default:
-		p.raiseErrorf(tok, fmt.Sprintf("unexpected token %q\n", tok))
+		p.raiseErrorf(tok, "unexpected token %q\n", tok)
 	}
 	return nil
 }
@@ -104,17 +108,33 @@ func (p *sshParser) parseKV() sshParserStateFn {
 		comment = tok.val
 	}
 	if strings.ToLower(key.val) == "match" {
-		// https://github.com/kevinburke/sshconfig/issues/6
-		p.raiseErrorf(val, "sshconfig: Match directive parsing is unsupported")
-		return nil
+		match, err := NewMatch(val.val)
+		if err != nil {
+			p.raiseError(val, err)
+			return nil
+		}
+		match.EOLComment = comment
+		match.hasEquals = hasEquals
+		match.leadingSpace = key.Position.Col - 1
+		match.position = key.Position
+		host := &Host{
+			Match:    match,
+			Nodes:    make([]Node, 0),
+			src:      p.source(key.Position.Line),
+			position: key.Position,
+		}
+		host.src.built = host.header()
+		p.config.Hosts = append(p.config.Hosts, host)
+		return p.parseStart
 	}
 	if strings.ToLower(key.val) == "host" {
-		strPatterns := strings.Split(val.val, " ")
+		strPatterns, err := SplitArgs(val.val)
+		if err != nil {
+			p.raiseError(val, err)
+			return nil
+		}
 		patterns := make([]*Pattern, 0)
 		for i := range strPatterns {
-			if strPatterns[i] == "" {
-				continue
-			}
 			pat, err := NewPattern(strPatterns[i])
 			if err != nil {
 				p.raiseErrorf(val, "Invalid host pattern: %v", err)
@@ -122,17 +142,26 @@ func (p *sshParser) parseKV() sshParserStateFn {
 			}
 			patterns = append(patterns, pat)
 		}
-		p.config.Hosts = append(p.config.Hosts, &Host{
+		host := &Host{
 			Patterns:   patterns,
 			Nodes:      make([]Node, 0),
 			EOLComment: comment,
 			hasEquals:  hasEquals,
-		})
+			src:        p.source(key.Position.Line),
+			position:   key.Position,
+		}
+		host.src.built = host.header()
+		p.config.Hosts = append(p.config.Hosts, host)
 		return p.parseStart
 	}
 	lastHost := p.config.Hosts[len(p.config.Hosts)-1]
 	if strings.ToLower(key.val) == "include" {
-		inc, err := NewInclude(strings.Split(val.val, " "), hasEquals, key.Position, comment, p.system, p.depth+1)
+		directives, err := SplitArgs(val.val)
+		if err != nil {
+			p.raiseError(val, err)
+			return nil
+		}
+		inc, err := NewInclude(directives, hasEquals, key.Position, comment, p.system, p.depth+1)
 		if err == ErrDepthExceeded {
 			p.raiseError(val, err)
 			return nil
@@ -141,6 +170,8 @@ func (p *sshParser) parseKV() sshParserStateFn {
 			p.raiseErrorf(val, "Error parsing Include directive: %v", err)
 			return nil
 		}
+		inc.src = p.source(key.Position.Line)
+		inc.src.built = inc.build()
 		lastHost.Nodes = append(lastHost.Nodes, inc)
 		return p.parseStart
 	}
@@ -151,7 +182,9 @@ func (p *sshParser) parseKV() sshParserStateFn {
 		hasEquals:    hasEquals,
 		leadingSpace: key.Position.Col - 1,
 		position:     key.Position,
+		src:          p.source(key.Position.Line),
 	}
+	kv.src.built = kv.build()
 	lastHost.Nodes = append(lastHost.Nodes, kv)
 	return p.parseStart
 }
@@ -159,16 +192,30 @@ func (p *sshParser) parseKV() sshParserStateFn {
 func (p *sshParser) parseComment() sshParserStateFn {
 	comment := p.getToken()
 	lastHost := p.config.Hosts[len(p.config.Hosts)-1]
-	lastHost.Nodes = append(lastHost.Nodes, &Empty{
+	empty := &Empty{
 		Comment: comment.val,
 		// account for the "#" as well
 		leadingSpace: comment.Position.Col - 2,
 		position:     comment.Position,
-	})
+		src:          p.source(comment.Position.Line),
+	}
+	empty.src.built = empty.build()
+	lastHost.Nodes = append(lastHost.Nodes, empty)
 	return p.parseStart
 }
 
-func parseSSH(flow chan token, system bool, depth uint8) *Config {
+// source return the line n of the input
+func (p *sshParser) source(n int) line {
+	if n < 1 || n > len(p.lines) {
+		return line{}
+	}
+	if n > p.last {
+		p.last = n
+	}
+	return newLine(p.lines[n-1], p.eols[n-1])
+}
+
+func parseSSH(flow chan token, input []byte, system bool, depth uint8) *Config {
 	// Ensure we consume tokens to completion even if parser exits early
 	defer func() {
 		for range flow {
@@ -186,6 +233,11 @@ func parseSSH(flow chan token, system bool, depth uint8) *Config {
 		system:        system,
 		depth:         depth,
 	}
+	parser.lines, parser.eols = splitLines(input)
 	parser.run()
+	// blanks after the last line holding a node
+	for i := parser.last; i < len(parser.lines); i++ {
+		result.tail += parser.lines[i] + parser.eols[i]
+	}
 	return result
 }
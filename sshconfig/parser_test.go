@@ -2,6 +2,8 @@ package sshconfig
 
 import (
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -22,3 +24,66 @@ func TestIOError(t *testing.T) {
 		t.Errorf("expected read error msg, got %v", err)
 	}
 }
+
+var argsTests = []struct {
+	line    string
+	value   string
+	args    []string
+	comment string
+}{
+	{`IdentityFile "/path/with space/id"`, `"/path/with space/id"`, []string{"/path/with space/id"}, ""},
+	{`IdentityFile /path/with\ space/id  # key`, `/path/with\ space/id`, []string{"/path/with space/id"}, " key"},
+	{`ProxyCommand ssh -W %h:%p "jump#1"`, `ssh -W %h:%p "jump#1"`, []string{"ssh", "-W", "%h:%p", "jump#1"}, ""},
+	{`ProxyCommand sh -c 'nc %h %p # not a comment'`, `sh -c 'nc %h %p # not a comment'`, []string{"sh", "-c", "nc %h %p # not a comment"}, ""},
+	{"HostName foo#bar\t#comment", "foo#bar", []string{"foo#bar"}, "comment"},
+	{"LocalForward\t8080\tlocalhost:80\t", "8080\tlocalhost:80", []string{"8080", "localhost:80"}, ""},
+	{`SetEnv A="x y" B=\"z`, `A="x y" B=\"z`, []string{"A=x y", `B="z`}, ""},
+}
+
+func TestKVArgs(t *testing.T) {
+	for _, tt := range argsTests {
+		cfg, err := Decode(strings.NewReader("Host x\n" + tt.line + "\n"))
+		if err != nil {
+			t.Fatalf("%q: %v", tt.line, err)
+		}
+		kv := cfg.Hosts[1].Nodes[0].(*KV)
+		if kv.Value != tt.value {
+			t.Errorf("%q: Value = %q, want %q", tt.line, kv.Value, tt.value)
+		}
+		if !reflect.DeepEqual(kv.Args(), tt.args) {
+			t.Errorf("%q: Args() = %q, want %q", tt.line, kv.Args(), tt.args)
+		}
+		if kv.Comment != tt.comment {
+			t.Errorf("%q: Comment = %q, want %q", tt.line, kv.Comment, tt.comment)
+		}
+	}
+}
+
+func TestHostPatternArgs(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Host a\tb \"c d\" # hosts\n  Port 22\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := cfg.Hosts[1]
+	var patterns []string
+	for _, p := range host.Patterns {
+		patterns = append(patterns, p.String())
+	}
+	if want := []string{"a", "b", "c d"}; !reflect.DeepEqual(patterns, want) {
+		t.Errorf("patterns = %q, want %q", patterns, want)
+	}
+	if !host.Matches("c d") || host.Matches("c") {
+		t.Errorf("quoted pattern should match as a whole")
+	}
+	if host.EOLComment != " hosts" {
+		t.Errorf("EOLComment = %q", host.EOLComment)
+	}
+	host.Patterns = host.Patterns[1:]
+	if got, want := strings.SplitN(cfg.String(), "\n", 2)[0], `Host b "c d" # hosts`; got != want {
+		t.Errorf("rebuilt Host line %q, want %q", got, want)
+	}
+
+	if _, err := Decode(strings.NewReader("Host \"a b\n")); err == nil {
+		t.Errorf("expected an error for an unterminated quote")
+	}
+}
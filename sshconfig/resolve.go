@@ -0,0 +1,250 @@
+package sshconfig
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ResolveOptions configures how Resolve finds and evaluates config files.
+type ResolveOptions struct {
+	// Configs, if set, are evaluated in order instead of reading any file.
+	Configs []*Config
+	// ConfigFile, if set, is the only file read, as with "ssh -F".
+	ConfigFile string
+	// UserConfig is the user's config file. It defaults to ~/.ssh/config.
+	UserConfig string
+	// SystemConfig is the system-wide config file. It defaults to
+	// /etc/ssh/ssh_config.
+	SystemConfig string
+	// Defaults adds the OpenSSH default of every keyword no file sets.
+	Defaults bool
+	// MatchExec runs "Match exec" commands. If nil, the package level
+	// MatchExec is used.
+	MatchExec MatchExecFunc
+}
+
+// Source records where a resolved value was read from.
+type Source struct {
+	// File is the path of the config file. It is empty for values that were
+	// not read from a file, such as defaults.
+	File string
+	// Position is the position of the keyword in File.
+	Position Position
+}
+
+// String prints s as "file:line", or "default" for values that were not read
+// from a file.
+func (s Source) String() string {
+	if s.File == "" && s.Position.Invalid() {
+		return "default"
+	}
+	if s.File == "" {
+		return fmt.Sprintf("line %d", s.Position.Line)
+	}
+	return fmt.Sprintf("%s:%d", s.File, s.Position.Line)
+}
+
+// Setting is a value ssh uses for a keyword, along with where it was read.
+type Setting struct {
+	// Key is the keyword, in lower case.
+	Key string
+	// Value is the value ssh uses: the arguments with their quotes removed,
+	// joined by spaces, or the text as written for commands such as
+	// ProxyCommand, which the shell splits.
+	Value string
+	// Source is the file and position the value was read from.
+	Source Source
+	// Host is the Host or Match block holding the value. It is nil for
+	// defaults.
+	Host *Host
+	// KV is the line holding the value. It is nil for defaults.
+	KV *KV
+}
+
+// Resolver evaluates a set of config files the way "ssh -G" does. The files
+// are read once, when the Resolver is created.
+type Resolver struct {
+	configs  []*Config
+	exec     MatchExecFunc
+	defaults bool
+}
+
+// NewResolver reads the config files described by opts.
+func NewResolver(opts ResolveOptions) (*Resolver, error) {
+	r := &Resolver{configs: opts.Configs, exec: opts.MatchExec, defaults: opts.Defaults}
+	if len(r.configs) > 0 {
+		return r, nil
+	}
+	if opts.ConfigFile != "" {
+		c, err := parseFile(opts.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		r.configs = []*Config{c}
+		return r, nil
+	}
+	userFile := opts.UserConfig
+	if userFile == "" {
+		userFile = userConfigFinder()
+	}
+	systemFile := opts.SystemConfig
+	if systemFile == "" {
+		systemFile = systemConfigFinder()
+	}
+	userConfig, err := parseFile(userFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	systemConfig, err := parseSystemFile(systemFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, c := range []*Config{userConfig, systemConfig} {
+		if c != nil {
+			r.configs = append(r.configs, c)
+		}
+	}
+	return r, nil
+}
+
+// Settings returns the values ssh would use for alias, in the order they
+// were read. Keys set several times appear once, with the first value ssh
+// obtained, except for multi-valued keys such as IdentityFile which appear
+// once per distinct value.
+func (r *Resolver) Settings(alias string) ([]*Setting, error) {
+	ctx := newMatchContext(alias, r.exec)
+	var settings []*Setting
+	seen := map[string]bool{}
+	visit := func(c *Config, h *Host, kv *KV) bool {
+		key := strings.ToLower(kv.Key)
+		value := settingValue(key, kv)
+		id := key
+		if IsMultiValued(key) {
+			id += "\x00" + value
+		}
+		if seen[id] {
+			return false
+		}
+		seen[id] = true
+		settings = append(settings, &Setting{
+			Key:    key,
+			Value:  value,
+			Source: Source{File: c.path, Position: kv.Pos()},
+			Host:   h,
+			KV:     kv,
+		})
+		return false
+	}
+	for {
+		for _, c := range r.configs {
+			if _, err := c.walk(ctx, visit); err != nil {
+				return nil, err
+			}
+		}
+		if ctx.final || !ctx.wantFinal {
+			break
+		}
+		ctx.final = true
+	}
+	for _, s := range settings {
+		if s.Key == "hostname" {
+			s.Value = strings.ReplaceAll(s.Value, "%h", alias)
+		}
+	}
+	if r.defaults {
+		settings = append(settings, r.defaultSettings(alias, ctx, seen)...)
+	}
+	return settings, nil
+}
+
+// settingValue returns the value of kv the way ssh reads it, see
+// Setting.Value.
+func settingValue(key string, kv *KV) string {
+	if s := LookupKeyword(key); s != nil && s.Type == TypeCommand {
+		return kv.Value
+	}
+	return strings.Join(kv.Args(), " ")
+}
+
+// defaultSettings returns the defaults of the keys that are not in seen.
+func (r *Resolver) defaultSettings(alias string, ctx *matchContext, seen map[string]bool) []*Setting {
+	dynamic := map[string]string{
+		"hostname": alias,
+		"user":     ctx.localUser,
+	}
+	var settings []*Setting
+	for _, key := range sortedKeys(defaults, dynamic) {
+		if seen[key] || (IsMultiValued(key) && hasValue(seen, key)) {
+			continue
+		}
+		if val, ok := dynamic[key]; ok {
+			settings = append(settings, &Setting{Key: key, Value: val})
+			continue
+		}
+		// every default of a multi-valued key is a value of its own
+		values := []string{defaults[key]}
+		if IsMultiValued(key) {
+			values, _ = scanArgs(defaults[key])
+		}
+		for _, val := range values {
+			settings = append(settings, &Setting{Key: key, Value: val})
+		}
+	}
+	return settings
+}
+
+func hasValue(seen map[string]bool, key string) bool {
+	for id := range seen {
+		if strings.HasPrefix(id, key+"\x00") {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(maps ...map[string]string) []string {
+	set := map[string]bool{}
+	var keys []string
+	for _, m := range maps {
+		for k := range m {
+			if !set[k] {
+				set[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Resolve returns the values ssh would use for alias, keyed by lower case
+// keyword. Multi-valued keys such as IdentityFile hold every value in the
+// order it was read; other keys hold the single value ssh uses.
+func (r *Resolver) Resolve(alias string) (map[string][]string, error) {
+	settings, err := r.Settings(alias)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]string, len(settings))
+	for _, s := range settings {
+		values[s.Key] = append(values[s.Key], s.Value)
+	}
+	return values, nil
+}
+
+// Resolve returns the effective configuration of alias, as printed by
+// "ssh -G alias": the user and system config files are read in order, Host
+// and Match blocks are evaluated, Include directives are followed where they
+// appear and the first value obtained for each keyword wins.
+//
+// Use a Resolver to resolve several aliases without re-reading the files, or
+// Resolver.Settings to find out which file and line each value came from.
+func Resolve(alias string, opts ResolveOptions) (map[string][]string, error) {
+	r, err := NewResolver(opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.Resolve(alias)
+}
@@ -0,0 +1,158 @@
+package sshconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const resolveUserConfig = `Include %[1]s/early
+Host web
+    IdentityFile ~/.ssh/a
+    LocalForward 8080 localhost:80
+Host * !db
+    IdentityFile ~/.ssh/b
+    IdentityFile ~/.ssh/a
+    User everyone
+    SendEnv LANG
+Host *
+    SendEnv LC_*
+    Port 22
+`
+
+const resolveEarlyConfig = `Host web
+    Port 2200
+    User early
+`
+
+const resolveSystemConfig = `Host *
+    User system
+    Port 2222
+`
+
+func writeResolveConfigs(t *testing.T) (user, system string) {
+	dir := t.TempDir()
+	user = filepath.Join(dir, "config")
+	system = filepath.Join(dir, "ssh_config")
+	files := map[string]string{
+		user:                        fmt.Sprintf(resolveUserConfig, dir),
+		filepath.Join(dir, "early"): resolveEarlyConfig,
+		system:                      resolveSystemConfig,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return user, system
+}
+
+func TestResolve(t *testing.T) {
+	user, system := writeResolveConfigs(t)
+	r, err := NewResolver(ResolveOptions{UserConfig: user, SystemConfig: system})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := r.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"port":         {"2200"},
+		"user":         {"early"},
+		"identityfile": {"~/.ssh/a", "~/.ssh/b"},
+		"localforward": {"8080 localhost:80"},
+		"sendenv":      {"LANG", "LC_*"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve(web):\ngot  %v\nwant %v", got, want)
+	}
+
+	got, err = r.Resolve("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string][]string{
+		"port":    {"22"},
+		"user":    {"system"},
+		"sendenv": {"LC_*"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve(db):\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestResolveConfigFile(t *testing.T) {
+	user, _ := writeResolveConfigs(t)
+	got, err := Resolve("db", ResolveOptions{ConfigFile: user})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["user"]; ok {
+		t.Errorf("expected system config to be skipped, got user %q", got["user"])
+	}
+}
+
+func TestResolveSettings(t *testing.T) {
+	user, system := writeResolveConfigs(t)
+	r, err := NewResolver(ResolveOptions{UserConfig: user, SystemConfig: system, Defaults: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := r.Settings("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]string{}
+	for _, s := range settings {
+		if _, ok := sources[s.Key]; !ok {
+			sources[s.Key] = s.Source.String()
+		}
+	}
+	dir := filepath.Dir(user)
+	wantSources := map[string]string{
+		"port":         filepath.Join(dir, "early") + ":2",
+		"identityfile": user + ":3",
+		"sendenv":      user + ":9",
+		"hostname":     "default",
+	}
+	for key, want := range wantSources {
+		if sources[key] != want {
+			t.Errorf("source of %s: got %q, want %q", key, sources[key], want)
+		}
+	}
+	for _, s := range settings {
+		if s.Key == "hostname" && s.Value != "web" {
+			t.Errorf("expected default hostname to be the alias, got %q", s.Value)
+		}
+	}
+}
+
+func TestResolveQuoted(t *testing.T) {
+	user := filepath.Join(t.TempDir(), "config")
+	config := `Host web
+    IdentityFile "~/.ssh/my key"
+    IdentityFile ~/.ssh/my\ key
+    IdentityFile '~/.ssh/other key'
+    SendEnv "LANG" LC_*
+    ProxyCommand ssh -W "%h:%p" jump
+`
+	if err := os.WriteFile(user, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Resolve("web", ResolveOptions{ConfigFile: user})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"identityfile": {"~/.ssh/my key", "~/.ssh/other key"},
+		"sendenv":      {"LANG LC_*"},
+		"proxycommand": {`ssh -W "%h:%p" jump`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve(web):\ngot  %q\nwant %q", got, want)
+	}
+}
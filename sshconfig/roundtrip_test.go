@@ -0,0 +1,98 @@
+package sshconfig
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of TestEditGolden")
+
+// roundTripFiles are configs of the other tests that Decode reads without
+// error
+var roundTripFiles = []string{
+	"testdata/config1",
+	"testdata/config2",
+	"testdata/config3",
+	"testdata/config4",
+	"testdata/config-no-ending-newline",
+	"testdata/dos-lines",
+	"testdata/eqsign",
+	"testdata/extraspace",
+	"testdata/invalid-port",
+	"testdata/match",
+	"testdata/match-directive",
+	"testdata/negated",
+}
+
+func TestRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("testdata/roundtrip/*.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range append(files, roundTripFiles...) {
+		data := loadFile(t, filename)
+		cfg, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: %v", filename, err)
+			continue
+		}
+		if out := cfg.String(); out != string(data) {
+			t.Errorf("%s: Decode -> String changed the file:\ngot  %q\nwant %q", filename, out, string(data))
+		}
+	}
+}
+
+func TestEditGolden(t *testing.T) {
+	tests := []struct {
+		file string
+		edit func(t *testing.T, c *Config)
+	}{
+		{"tabs", func(t *testing.T, c *Config) {
+			github := c.Hosts[1]
+			github.Set("User", "deploy")
+			github.Set("Port", "22")
+			github.Set("IdentitiesOnly", "")
+			bastion := c.Hosts[3]
+			pattern, err := NewPattern("jump.internal")
+			if err != nil {
+				t.Fatal(err)
+			}
+			bastion.Patterns = []*Pattern{pattern}
+		}},
+		{"crlf", func(t *testing.T, c *Config) {
+			wap := c.Hosts[1]
+			wap.Set("user", "admin")
+			wap.Set("port", "2200")
+		}},
+		{"no-newline", func(t *testing.T, c *Config) {
+			c.Hosts[1].Set("User", "root")
+			pattern, err := NewPattern("added")
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Hosts = append(c.Hosts, &Host{Patterns: []*Pattern{pattern}, Nodes: []Node{NewKV("HostName", "10.0.0.2")}})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			cfg, err := Decode(bytes.NewReader(loadFile(t, "testdata/roundtrip/"+tt.file+".conf")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.edit(t, cfg)
+			out := cfg.String()
+			golden := "testdata/roundtrip/" + tt.file + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(out), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if want := string(loadFile(t, golden)); out != want {
+				t.Errorf("got  %q\nwant %q", out, want)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package sshconfig
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type token struct {
 	Position
@@ -36,6 +39,10 @@ func isSpace(r rune) bool {
 	return r == ' ' || r == '\t'
 }
 
+func trimBlanks(s string) string {
+	return strings.TrimRight(s, " \t")
+}
+
 func isKeyStartChar(r rune) bool {
 	return !(isSpace(r) || r == '\r' || r == '\n' || r == eof)
 }
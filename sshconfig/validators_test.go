@@ -10,9 +10,9 @@ var validateTests = []struct {
 	err string
 }{
 	{"IdentitiesOnly", "yes", ""},
-	{"IdentitiesOnly", "Yes", `sshconfig: value for key "IdentitiesOnly" must be 'yes' or 'no', got "Yes"`},
+	{"IdentitiesOnly", "Yes", `ssh_config: value for key "IdentitiesOnly" must be 'yes' or 'no', got "Yes"`},
 	{"Port", "22", ``},
-	{"Port", "yes", `sshconfig: strconv.ParseUint: parsing "yes": invalid syntax`},
+	{"Port", "yes", `ssh_config: strconv.ParseUint: parsing "yes": invalid syntax`},
 }
 
 func TestValidate(t *testing.T) {
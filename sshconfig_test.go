@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -187,6 +188,52 @@ func TestUpdate(t *testing.T) {
 	require.NotNil(t, hostMap["test4"])
 }
 
+func TestUpdateInPlace(t *testing.T) {
+	main := filepath.Join(t.TempDir(), "config")
+	content := "# laptop\r\nHost web # front\r\n\tHostName 10.0.0.1\r\n\t# deploy user\r\n\tUSER deploy\r\n\tPort=22\r\n\r\nHost db\r\n\tHostName 10.0.0.2\r\n"
+	require.Nil(t, os.WriteFile(main, []byte(content), 0600))
+
+	_, err := Update(main, &UpdateOption{Alias: "web", Connect: "admin@10.0.0.3", Config: map[string]string{"port": "", "IdentityFile": "~/.ssh/web"}})
+	require.Nil(t, err)
+	require.Equal(t, "# laptop\r\nHost web # front\r\n\tHostName 10.0.0.3\r\n\t# deploy user\r\n\tUSER admin\r\n\tidentityfile=~/.ssh/web\r\n\r\nHost db\r\n\tHostName 10.0.0.2\r\n",
+		readString(t, main))
+
+	_, err = Update(main, &UpdateOption{Alias: "db", NewAlias: "database"})
+	require.Nil(t, err)
+	require.True(t, strings.HasSuffix(readString(t, main), "\r\nHost database\r\n\tHostName 10.0.0.2\r\n"))
+}
+
+func TestUpdateQuoted(t *testing.T) {
+	main := filepath.Join(t.TempDir(), "config")
+	// args the arguments ssh reads from the line setting key
+	args := func(alias, key string) []string {
+		host, err := Resolve(main, alias)
+		require.Nil(t, err)
+		for _, s := range host.Settings {
+			if s.Key == key {
+				return s.KV.Args()
+			}
+		}
+		return nil
+	}
+	require.Nil(t, os.WriteFile(main, []byte("Host a b\n    HostName 10.0.0.1\n    IdentityFile \"/x y/id\"\n"), 0600))
+
+	// the values of the shared block are copied with their quotes
+	_, err := Update(main, &UpdateOption{Alias: "a", Config: map[string]string{"port": "2222"}})
+	require.Nil(t, err)
+	require.Equal(t, "Host b\n    HostName 10.0.0.1\n    IdentityFile \"/x y/id\"\nHost a\n    hostname 10.0.0.1\n    identityfile \"/x y/id\"\n    port 2222\n", readString(t, main))
+	require.Equal(t, []string{"/x y/id"}, args("a", "identityfile"))
+
+	// the values given are quoted
+	_, err = Update(main, &UpdateOption{Alias: "b", Config: map[string]string{"certificatefile": "/x y/id-cert.pub", "localforward": "8080 localhost:80"}})
+	require.Nil(t, err)
+	_, err = Add(main, &AddOption{Alias: "c", Config: map[string]string{"identityfile": "/x y/id"}})
+	require.Nil(t, err)
+	require.Equal(t, []string{"/x y/id-cert.pub"}, args("b", "certificatefile"))
+	require.Equal(t, []string{"8080", "localhost:80"}, args("b", "localforward"))
+	require.Equal(t, []string{"/x y/id"}, args("c", "identityfile"))
+}
+
 func TestDelete(t *testing.T) {
 	initConfig()
 	defer os.Remove(configRootDir)
@@ -218,3 +265,74 @@ func TestGetFilePaths(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, 3, len(paths))
 }
+
+func TestResolve(t *testing.T) {
+	initConfig()
+	defer os.Remove(configRootDir)
+
+	host, err := Resolve(mainConfigPath, "main2")
+	require.Nil(t, err)
+	require.Equal(t, "192.168.2.20", host.Get("hostname"))
+	require.Equal(t, "wen", host.OwnConfig["user"])
+	require.Equal(t, "22022", host.ImplicitConfig["port"])
+	require.Equal(t, testConfigPath+":3", Origin(host.Settings[0]))
+	require.False(t, host.IsOwn(host.Settings[0]))
+
+	host, err = Resolve(mainConfigPath, "unknown.example.com")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(host.OwnConfig))
+	require.Equal(t, "22022", host.Get("port"))
+	require.Equal(t, GetUsername(), host.Get("user"))
+	require.Empty(t, host.Get("hostname"))
+	for _, setting := range host.Settings {
+		if setting.Key == "user" {
+			require.Equal(t, "injected default", Origin(setting))
+		}
+	}
+}
+
+func TestListSideEffectFree(t *testing.T) {
+	initConfig()
+	defer os.Remove(configRootDir)
+	require.Nil(t, os.Chmod(testConfigPath, 0600))
+
+	_, err := List(mainConfigPath, ListOption{})
+	require.Nil(t, err)
+	content, err := ioutil.ReadFile(testConfigPath)
+	require.Nil(t, err)
+	require.Equal(t, testConfigContent, string(content))
+	info, err := os.Stat(testConfigPath)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	missing := filepath.Join(configRootDir, "missing")
+	hosts, err := List(missing, ListOption{})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(hosts))
+	_, err = os.Stat(missing)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestFormat(t *testing.T) {
+	initConfig()
+	defer os.Remove(configRootDir)
+
+	results, err := Format(mainConfigPath, FormatOption{Check: true})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(results))
+	require.Contains(t, results[0].Diff(), "-\tport 77")
+	content, err := ioutil.ReadFile(mainConfigPath)
+	require.Nil(t, err)
+	require.Equal(t, results[0].Original, string(content))
+
+	results, err = Format(mainConfigPath, FormatOption{})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(results))
+	content, err = ioutil.ReadFile(mainConfigPath)
+	require.Nil(t, err)
+	require.Equal(t, results[0].Formatted, string(content))
+
+	results, err = Format(mainConfigPath, FormatOption{Check: true})
+	require.Nil(t, err)
+	require.Equal(t, 0, len(results))
+}
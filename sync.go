@@ -0,0 +1,257 @@
+package sshman
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Inventory desired state of the hosts sync manages, read from yaml or json
+//
+//	hosts:
+//	  web:
+//	    hostname: 10.0.0.1
+//	    user: deploy
+type Inventory struct {
+	// Hosts ssh options of every alias, keyed by alias
+	Hosts map[string]map[string]string `yaml:"hosts" json:"hosts"`
+}
+
+// LoadInventory read an inventory in yaml, or json, from r
+func LoadInventory(r io.Reader) (*Inventory, error) {
+	inv := &Inventory{}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(inv); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid inventory: %v", err)
+	}
+	for alias, config := range inv.Hosts {
+		if alias == "" {
+			return nil, fmt.Errorf("invalid inventory: empty alias")
+		}
+		normalized := make(map[string]string, len(config))
+		for k, v := range config {
+			if v != "" {
+				normalized[strings.ToLower(k)] = v
+			}
+		}
+		inv.Hosts[alias] = normalized
+	}
+	return inv, nil
+}
+
+// Plan actions
+const (
+	PlanAdd      = "add"
+	PlanChange   = "change"
+	PlanRemove   = "remove"
+	PlanConflict = "conflict"
+)
+
+// KeyChange change of one option of an alias, Old is empty for an option
+// that is added and New for one that is removed
+type KeyChange struct {
+	Key string `json:"key"`
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// PlanItem change sync makes to one alias
+type PlanItem struct {
+	// Action add, change, remove or conflict
+	Action string `json:"action"`
+	// Alias alias
+	Alias string `json:"alias"`
+	// Paths files declaring the alias outside the target, conflict only
+	Paths []string `json:"paths,omitempty"`
+	// Changes the options that change, sorted by key
+	Changes []KeyChange `json:"changes,omitempty"`
+}
+
+// Plan changes sync makes to reach the inventory, sorted by alias
+type Plan struct {
+	// Target file the managed hosts are written to
+	Target string `json:"target"`
+	// Include whether an Include directive for Target is added to the config
+	// file
+	Include bool        `json:"include,omitempty"`
+	Items   []*PlanItem `json:"items"`
+}
+
+// Count number of items with action
+func (p *Plan) Count(action string) int {
+	n := 0
+	for _, item := range p.Items {
+		if item.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Empty whether nothing has to change
+func (p *Plan) Empty() bool {
+	return len(p.Items) == 0 && !p.Include
+}
+
+// SyncOption options for Sync
+type SyncOption struct {
+	// Target file the managed hosts are written to, conf.d/managed next to
+	// the config file if empty
+	Target string
+	// Prune remove the aliases of the target file that are not in the
+	// inventory
+	Prune bool
+	// DryRun only compute the plan, write nothing
+	DryRun bool
+}
+
+// DefaultSyncTarget default target file of sync for the config file p
+func DefaultSyncTarget(p string) string {
+	return filepath.Join(filepath.Dir(p), "conf.d", "managed")
+}
+
+// Sync make the hosts of the target file match the inventory. Aliases
+// declared in other files are never changed: if the inventory has one, the
+// plan reports a conflict and nothing is written.
+func Sync(p string, inv *Inventory, so SyncOption) (*Plan, error) {
+	target := so.Target
+	if target == "" {
+		target = DefaultSyncTarget(p)
+	}
+	target, err := filepath.Abs(expandHome(target))
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := Begin(p)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	plan := &Plan{Target: target, Include: !tx.Reads(target)}
+	if plan.Include {
+		if err := tx.Include(target); err != nil {
+			return nil, err
+		}
+	}
+	if plan.Items, err = tx.plan(target, inv, so.Prune); err != nil {
+		return nil, err
+	}
+	conflicts := plan.Count(PlanConflict)
+	if conflicts > 0 {
+		return plan, fmt.Errorf("%d alias(es) of the inventory are declared outside %s", conflicts, target)
+	}
+	if so.DryRun || plan.Empty() {
+		return plan, nil
+	}
+
+	for _, item := range plan.Items {
+		switch item.Action {
+		case PlanAdd:
+			_, err = tx.Add(&AddOption{Path: target, Alias: item.Alias, Config: copyConfig(inv.Hosts[item.Alias])})
+		case PlanChange:
+			config := map[string]string{}
+			for _, c := range item.Changes {
+				config[c.Key] = c.New
+			}
+			_, err = tx.Update(&UpdateOption{Alias: item.Alias, Config: config})
+		case PlanRemove:
+			_, err = tx.Delete(item.Alias)
+		}
+		if err != nil {
+			return plan, fmt.Errorf("%s %s: %v", item.Action, item.Alias, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return plan, err
+	}
+	return plan, tx.Commit()
+}
+
+// plan compare the inventory with the aliases of the transaction
+func (tx *Transaction) plan(target string, inv *Inventory, prune bool) ([]*PlanItem, error) {
+	var items []*PlanItem
+	for alias, desired := range inv.Hosts {
+		hc, err := tx.host(alias)
+		if err != nil {
+			return nil, err
+		}
+		if hc == nil {
+			item := &PlanItem{Action: PlanAdd, Alias: alias}
+			for _, k := range SortKeys(desired) {
+				item.Changes = append(item.Changes, KeyChange{Key: k, New: desired[k]})
+			}
+			items = append(items, item)
+			continue
+		}
+		if others := tx.declaredOutside(hc, target); len(others) > 0 {
+			items = append(items, &PlanItem{Action: PlanConflict, Alias: alias, Paths: others})
+			continue
+		}
+		item := &PlanItem{Action: PlanChange, Alias: alias}
+		for _, k := range SortKeys(mergeKeys(desired, hc.OwnConfig)) {
+			if old, want := hc.OwnConfig[k], desired[k]; old != want {
+				item.Changes = append(item.Changes, KeyChange{Key: k, Old: old, New: want})
+			}
+		}
+		if len(item.Changes) > 0 {
+			items = append(items, item)
+		}
+	}
+	if prune {
+		for alias, hc := range tx.aliasMap {
+			if _, ok := inv.Hosts[alias]; ok || !tx.declares(hc, target) || len(tx.declaredOutside(hc, target)) > 0 {
+				continue
+			}
+			items = append(items, &PlanItem{Action: PlanRemove, Alias: alias})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Alias < items[j].Alias })
+	return items, nil
+}
+
+// declares whether a Host block of fp declares the alias of hc
+func (tx *Transaction) declares(hc *HostConfig, fp string) bool {
+	cfg := tx.configMap[fp]
+	if cfg == nil {
+		return false
+	}
+	for _, host := range hc.PathMap[fp] {
+		for _, h := range cfg.Hosts {
+			if h == host {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// declaredOutside return the files other than target declaring the alias
+// of hc, sorted
+func (tx *Transaction) declaredOutside(hc *HostConfig, target string) []string {
+	var paths []string
+	for fp := range hc.PathMap {
+		if fp != target && tx.declares(hc, fp) {
+			paths = append(paths, fp)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func mergeKeys(maps ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, m := range maps {
+		for k := range m {
+			merged[k] = ""
+		}
+	}
+	return merged
+}
@@ -0,0 +1,111 @@
+package sshman
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const syncInventory = `
+hosts:
+  web:
+    hostname: 10.0.0.1
+    user: deploy
+  db:
+    hostname: 10.0.0.2
+    port: 5022
+`
+
+func loadInventory(t *testing.T, s string) *Inventory {
+	inv, err := LoadInventory(strings.NewReader(s))
+	require.Nil(t, err)
+	return inv
+}
+
+func TestSync(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "config")
+	target := filepath.Join(dir, "conf.d", "managed")
+	mainContent := fmt.Sprintf("Include %s/conf.d/*\nHost mine\n    hostname 10.0.0.9\n", dir)
+	require.Nil(t, os.WriteFile(main, []byte(mainContent), 0600))
+
+	plan, err := Sync(main, loadInventory(t, syncInventory), SyncOption{Target: target, DryRun: true})
+	require.Nil(t, err)
+	require.False(t, plan.Include)
+	require.Equal(t, 2, plan.Count(PlanAdd))
+	require.Equal(t, "db", plan.Items[0].Alias)
+	require.Equal(t, []KeyChange{{Key: "hostname", New: "10.0.0.2"}, {Key: "port", New: "5022"}}, plan.Items[0].Changes)
+	_, err = os.Stat(target)
+	require.True(t, os.IsNotExist(err), "dry run wrote the target")
+
+	_, err = Sync(main, loadInventory(t, syncInventory), SyncOption{Target: target})
+	require.Nil(t, err)
+	require.Equal(t, mainContent, readString(t, main))
+	web, err := Resolve(main, "web")
+	require.Nil(t, err)
+	require.Equal(t, target, web.Path)
+	require.Equal(t, "deploy", web.OwnConfig["user"])
+
+	// a second run has nothing to do
+	plan, err = Sync(main, loadInventory(t, syncInventory), SyncOption{Target: target})
+	require.Nil(t, err)
+	require.True(t, plan.Empty())
+
+	plan, err = Sync(main, loadInventory(t, "hosts:\n  web:\n    hostname: 10.0.0.3\n"), SyncOption{Target: target, Prune: true})
+	require.Nil(t, err)
+	require.Equal(t, 1, plan.Count(PlanChange))
+	require.Equal(t, 1, plan.Count(PlanRemove))
+	require.Equal(t, []KeyChange{
+		{Key: "hostname", Old: "10.0.0.1", New: "10.0.0.3"},
+		{Key: "user", Old: "deploy"},
+	}, plan.Items[1].Changes)
+
+	hosts, err := List(main, ListOption{})
+	require.Nil(t, err)
+	var aliases []string
+	for _, h := range hosts {
+		aliases = append(aliases, h.Alias)
+	}
+	// hand-written hosts are never pruned
+	require.Equal(t, []string{"*", "mine", "web"}, aliases)
+	web, err = Resolve(main, "web")
+	require.Nil(t, err)
+	require.Equal(t, "10.0.0.3", web.OwnConfig["hostname"])
+	require.Empty(t, web.OwnConfig["user"])
+}
+
+func TestSyncAddsInclude(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "config")
+	target := filepath.Join(dir, "managed")
+	require.Nil(t, os.WriteFile(main, []byte("Host mine\n    hostname 10.0.0.9\n"), 0600))
+
+	plan, err := Sync(main, loadInventory(t, syncInventory), SyncOption{Target: target})
+	require.Nil(t, err)
+	require.True(t, plan.Include)
+	require.True(t, strings.HasPrefix(readString(t, main), "Include "+target+"\n"))
+
+	plan, err = Sync(main, loadInventory(t, syncInventory), SyncOption{Target: target})
+	require.Nil(t, err)
+	require.True(t, plan.Empty())
+}
+
+func TestSyncConflict(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "config")
+	target := filepath.Join(dir, "managed")
+	require.Nil(t, os.WriteFile(main, []byte(fmt.Sprintf("Include %s\nHost web\n    hostname 10.0.0.9\n", target)), 0600))
+	before := readString(t, main)
+
+	plan, err := Sync(main, loadInventory(t, syncInventory), SyncOption{Target: target})
+	require.NotNil(t, err)
+	require.Equal(t, 1, plan.Count(PlanConflict))
+	require.Equal(t, []string{main}, plan.Items[1].Paths)
+	require.Equal(t, before, readString(t, main))
+	_, err = os.Stat(target)
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,84 @@
+package sshman
+
+import (
+	"strings"
+	"text/template"
+)
+
+// TemplateFuncs functions available to the templates of ParseTemplate
+//
+//	get . "key"        value ssh uses for key, like .Get
+//	own . "key"        value of key in the alias's own blocks
+//	inherited . "key"  value of key inherited from other blocks or defaults
+//	files .            files declaring the alias, see Paths
+//	connection .       user@hostname:port
+//	join list sep      strings.Join
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"get": func(hc *HostConfig, key string) string {
+			return hc.Get(key)
+		},
+		"own": func(hc *HostConfig, key string) string {
+			return hc.OwnConfig[strings.ToLower(key)]
+		},
+		"inherited": func(hc *HostConfig, key string) string {
+			return hc.ImplicitConfig[strings.ToLower(key)]
+		},
+		"files": func(hc *HostConfig) []string {
+			return hc.Paths()
+		},
+		"connection": func(hc *HostConfig) string {
+			user, hostname, port := hc.Connection()
+			return user + "@" + hostname + ":" + port
+		},
+		"join": strings.Join,
+	}
+}
+
+// ParseTemplate parse a text/template executed over a *HostConfig, with the
+// TemplateFuncs. The escapes \t and \n in the text outside the {{ }}
+// actions stand for a tab and a newline, so they can be typed on the command
+// line; the string literals of the actions keep their own escapes.
+func ParseTemplate(text string) (*template.Template, error) {
+	return template.New("format").Funcs(TemplateFuncs()).Parse(unescapeText(text))
+}
+
+var textReplacer = strings.NewReplacer(`\t`, "\t", `\n`, "\n")
+
+// unescapeText replace \t and \n in the text of the template outside its
+// actions
+func unescapeText(text string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(text, "{{")
+		if start < 0 {
+			b.WriteString(textReplacer.Replace(text))
+			return b.String()
+		}
+		b.WriteString(textReplacer.Replace(text[:start]))
+		end := actionEnd(text, start+2)
+		b.WriteString(text[start:end])
+		text = text[end:]
+	}
+}
+
+// actionEnd return the index after the }} closing the action of text that
+// starts before i, skipping the quoted strings, or len(text) if unclosed
+func actionEnd(text string, i int) int {
+	for i < len(text) {
+		switch c := text[i]; c {
+		case '"', '\'', '`':
+			for i++; i < len(text) && text[i] != c; i++ {
+				if text[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case '}':
+			if strings.HasPrefix(text[i:], "}}") {
+				return i + 2
+			}
+		}
+		i++
+	}
+	return len(text)
+}
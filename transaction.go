@@ -0,0 +1,506 @@
+package sshman
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sonnt85/sshman/sshconfig"
+)
+
+// ErrTxDone returned by the methods of a Transaction that was already
+// committed or rolled back
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// Transaction a set of Add, Update and Delete operations on a config file and
+// the files it includes. The files are parsed once by Begin, every operation
+// edits them in memory, and Commit writes all of them or none of them. The
+// config file stays locked until Commit or Rollback.
+type Transaction struct {
+	path      string
+	configMap map[string]*sshconfig.Config
+	// aliasMap the aliases and their Host blocks with the operations applied
+	// so far, their values are resolved by host when they are looked up
+	aliasMap map[string]*HostConfig
+	// defaults the block of the sshman defaults the aliases are resolved with
+	defaults *sshconfig.Host
+	// resolved the aliases whose values are up to date
+	resolved map[string]bool
+	// originals the contents of every file as read by Begin, nil if the file
+	// did not exist
+	originals map[string][]byte
+	dirty     map[string]bool
+	unlock    func()
+	done      bool
+}
+
+// Begin lock the config file p and parse it with the files it includes to
+// start a transaction
+func Begin(p string) (*Transaction, error) {
+	unlock, err := lockConfig(p)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := readFile(p)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	configMap := map[string]*sshconfig.Config{p: cfg}
+	collectConfigs(configMap, cfg)
+	tx := &Transaction{
+		path:      p,
+		configMap: configMap,
+		originals: map[string][]byte{},
+		dirty:     map[string]bool{},
+		unlock:    unlock,
+	}
+	tx.collect()
+	for fp := range configMap {
+		if err := tx.snapshot(fp); err != nil {
+			unlock()
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// snapshot save the current contents of fp so Commit can restore it
+func (tx *Transaction) snapshot(fp string) error {
+	if _, ok := tx.originals[fp]; ok {
+		return nil
+	}
+	data, err := os.ReadFile(fp)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	tx.originals[fp] = data
+	return nil
+}
+
+// file return the config of fp. A file that is not part of the transaction
+// yet is read and, if an Include directive of the config file covers it,
+// attached there so the following operations see its hosts.
+func (tx *Transaction) file(fp string) (*sshconfig.Config, error) {
+	if cfg, ok := tx.configMap[fp]; ok {
+		return cfg, nil
+	}
+	cfg, err := readFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.snapshot(fp); err != nil {
+		return nil, err
+	}
+	if inc := tx.covering(fp); inc != nil {
+		inc.Attach(fp, cfg)
+	}
+	tx.configMap[fp] = cfg
+	return cfg, nil
+}
+
+// covering return the first Include directive of the config file, or of the
+// files it includes, that reads fp
+func (tx *Transaction) covering(fp string) *sshconfig.Include {
+	var found *sshconfig.Include
+	walkHosts(tx.path, tx.configMap[tx.path], func(_ string, host *sshconfig.Host) {
+		for _, node := range host.Nodes {
+			if inc, ok := node.(*sshconfig.Include); ok && found == nil && inc.Covers(fp) {
+				found = inc
+			}
+		}
+	})
+	return found
+}
+
+// Reads whether ssh reads fp when it reads the config file, either because
+// it is the config file or because an Include directive covers it
+func (tx *Transaction) Reads(fp string) bool {
+	return fp == tx.path || tx.covering(fp) != nil
+}
+
+// Include add an Include directive for fp at the top of the config file, so
+// that ssh reads it before any Host block. It does nothing if ssh reads fp
+// already.
+func (tx *Transaction) Include(fp string) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if tx.Reads(fp) {
+		return nil
+	}
+	directive := fp
+	if home := GetHomeDir(); strings.HasPrefix(fp, home+string(filepath.Separator)) {
+		directive = "~" + fp[len(home):]
+	}
+	inc, err := sshconfig.NewInclude([]string{directive}, false, sshconfig.Position{Line: 1, Col: 1}, "", false, 1)
+	if err != nil {
+		return err
+	}
+	cfg := tx.configMap[tx.path]
+	if len(cfg.Hosts) == 0 {
+		return fmt.Errorf("%s: no implicit host block", tx.path)
+	}
+	cfg.Hosts[0].Nodes = append([]sshconfig.Node{inc}, cfg.Hosts[0].Nodes...)
+	tx.dirty[tx.path] = true
+	if files := inc.GetFiles(); files[fp] != nil {
+		tx.configMap[fp] = files[fp]
+		if err := tx.snapshot(fp); err != nil {
+			return err
+		}
+	} else if cfg, ok := tx.configMap[fp]; ok {
+		inc.Attach(fp, cfg)
+	}
+	tx.collect()
+	return nil
+}
+
+// collect collect the aliases and their Host blocks from the edited configs.
+// Their values are not resolved here but by host, so that a series of
+// operations does not resolve every alias again after each of them.
+func (tx *Transaction) collect() {
+	tx.aliasMap, tx.defaults = collectAliases(tx.path, tx.configMap[tx.path])
+	tx.resolved = map[string]bool{}
+}
+
+// host return the alias with the values it has with the operations applied
+// so far, resolving them if an operation changed the configs since they were
+// last resolved. It returns nil if the alias does not exist.
+func (tx *Transaction) host(alias string) (*HostConfig, error) {
+	hc, ok := tx.aliasMap[alias]
+	if !ok || tx.resolved[alias] {
+		return hc, nil
+	}
+	r, err := sshconfig.NewResolver(sshconfig.ResolveOptions{Configs: []*sshconfig.Config{tx.configMap[tx.path]}})
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveHost(r, tx.defaults, hc); err != nil {
+		return nil, err
+	}
+	tx.resolved[alias] = true
+	return hc, nil
+}
+
+// Lookup return the alias as it stands with the operations applied so far,
+// false if it does not exist or its values cannot be resolved
+func (tx *Transaction) Lookup(alias string) (*HostConfig, bool) {
+	hc, err := tx.host(alias)
+	return hc, hc != nil && err == nil
+}
+
+// Add ssh host config to the transaction
+func (tx *Transaction) Add(ao *AddOption) (*HostConfig, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	if ao.Path == "" {
+		ao.Path = tx.path
+	}
+	if err := checkAlias(tx.aliasMap, false, ao.Alias); err != nil {
+		return nil, err
+	}
+
+	_, known := tx.configMap[ao.Path]
+	cfg, err := tx.file(ao.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if ao.Config == nil {
+		ao.Config = map[string]string{}
+	}
+
+	// Parse connect string
+	user, hostname, port := ParseConnect(ao.Connect)
+	if user != "" {
+		ao.Config["user"] = user
+	}
+	if hostname != "" {
+		ao.Config["hostname"] = hostname
+	}
+	if port != "" {
+		ao.Config["port"] = port
+	}
+
+	var nodes []sshconfig.Node
+	for k, v := range ao.Config {
+		k = strings.ToLower(k)
+		nodes = append(nodes, sshconfig.NewKV(k, sshconfig.QuoteValue(k, v)))
+	}
+
+	pattern, err := sshconfig.NewPattern(ao.Alias)
+	if err != nil {
+		return nil, err
+	}
+
+	host := &sshconfig.Host{
+		Patterns: []*sshconfig.Pattern{pattern},
+		Nodes:    nodes,
+	}
+	if ao.Comment != "" {
+		host.EOLComment = " " + ao.Comment
+	}
+	cfg.Hosts = append(cfg.Hosts, host)
+	tx.dirty[ao.Path] = true
+	if known && (ao.Path == tx.path || tx.covering(ao.Path) != nil) {
+		// the new block only adds its alias
+		if hasKV(host) {
+			tx.aliasMap[ao.Alias] = NewHostConfig(ao.Alias, ao.Path, host)
+		}
+		tx.resolved = map[string]bool{}
+	} else {
+		tx.collect()
+	}
+	return tx.host(ao.Alias)
+}
+
+// Update existing record in the transaction
+func (tx *Transaction) Update(uo *UpdateOption) (*HostConfig, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	configMap, aliasMap := tx.configMap, tx.aliasMap
+	if err := checkAlias(aliasMap, true, uo.Alias); err != nil {
+		return nil, err
+	}
+
+	updateHost, err := tx.host(uo.Alias)
+	if err != nil {
+		return nil, err
+	}
+	if uo.NewAlias != "" {
+		// new alias should not exist
+		if err := checkAlias(aliasMap, false, uo.NewAlias); err != nil {
+			return nil, err
+		}
+	} else {
+		uo.NewAlias = uo.Alias
+	}
+
+	if uo.Config == nil {
+		uo.Config = map[string]string{}
+	}
+	if uo.Connect != "" {
+		// Parse connect string
+		user, hostname, port := ParseConnect(uo.Connect)
+		if user != "" {
+			uo.Config["user"] = user
+		}
+		if hostname != "" {
+			uo.Config["hostname"] = hostname
+		}
+		if port != "" {
+			uo.Config["port"] = port
+		}
+	}
+
+	// values the text of the own keys as it is written: the values of the
+	// blocks as they are, quotes included, and the changes quoted
+	values := map[string]string{}
+	for _, s := range updateHost.Settings {
+		if _, ok := values[s.Key]; !ok && s.KV != nil && updateHost.IsOwn(s) {
+			values[s.Key] = s.KV.Value
+		}
+	}
+	changes := map[string]string{}
+	for k, v := range uo.Config {
+		k = strings.ToLower(k)
+		changes[k] = sshconfig.QuoteValue(k, v)
+		if v == "" {
+			delete(updateHost.OwnConfig, k)
+			delete(values, k)
+		} else {
+			updateHost.OwnConfig[k] = v
+			values[k] = changes[k]
+		}
+	}
+
+	for fp, hosts := range updateHost.PathMap {
+		for i, host := range hosts {
+			if fp == updateHost.Path {
+				pattern, _ := sshconfig.NewPattern(uo.NewAlias)
+				newHost := &sshconfig.Host{
+					Patterns:   []*sshconfig.Pattern{pattern},
+					EOLComment: host.EOLComment,
+				}
+				for _, k := range SortKeys(values) {
+					newHost.Nodes = append(newHost.Nodes, sshconfig.NewKV(k, values[k]))
+				}
+				if len(host.Patterns) == 1 {
+					if i == 0 {
+						find := false
+						for _, h := range configMap[fp].Hosts {
+							if host == h {
+								find = true
+								break
+							}
+						}
+						if find {
+							// edit the block in place, so its comments and
+							// layout stay as they are
+							host.Patterns = newHost.Patterns
+							for _, k := range SortKeys(changes) {
+								host.Set(k, changes[k])
+							}
+							for _, k := range SortKeys(values) {
+								if host.Find(k) == nil {
+									host.Set(k, values[k])
+								}
+							}
+						} else {
+							// for implicit "*"
+							newHost.Nodes = []sshconfig.Node{}
+							for _, k := range SortKeys(changes) {
+								newHost.Nodes = append(newHost.Nodes, sshconfig.NewKV(k, changes[k]))
+							}
+							configMap[fp].Hosts = append(configMap[fp].Hosts, newHost)
+						}
+					} else {
+						deleteHostFromConfig(configMap[fp], host)
+					}
+				} else {
+					if i == 0 {
+						configMap[fp].Hosts = append(configMap[fp].Hosts, newHost)
+					}
+					var patterns []*sshconfig.Pattern
+					for _, pattern := range host.Patterns {
+						if pattern.String() != uo.NewAlias {
+							patterns = append(patterns, pattern)
+						}
+					}
+					host.Patterns = patterns
+				}
+			} else {
+				if len(host.Patterns) == 1 {
+					deleteHostFromConfig(configMap[fp], host)
+				} else {
+					var patterns []*sshconfig.Pattern
+					for _, pattern := range host.Patterns {
+						if pattern.String() != uo.NewAlias {
+							patterns = append(patterns, pattern)
+						}
+					}
+					host.Patterns = patterns
+				}
+			}
+		}
+		tx.dirty[fp] = true
+	}
+	tx.collect()
+	return tx.host(uo.NewAlias)
+}
+
+// Delete existing alias records in the transaction
+func (tx *Transaction) Delete(aliases ...string) ([]*HostConfig, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	if err := checkAlias(tx.aliasMap, true, aliases...); err != nil {
+		return nil, err
+	}
+
+	var deleteHosts []*HostConfig
+	for _, alias := range aliases {
+		deleteHost, err := tx.host(alias)
+		if err != nil {
+			return nil, err
+		}
+		deleteHosts = append(deleteHosts, deleteHost)
+		for fp, hosts := range deleteHost.PathMap {
+			for _, host := range hosts {
+				if len(host.Patterns) == 1 {
+					deleteHostFromConfig(tx.configMap[fp], host)
+				} else {
+					var patterns []*sshconfig.Pattern
+					for _, pattern := range host.Patterns {
+						if pattern.String() != alias {
+							patterns = append(patterns, pattern)
+						}
+					}
+					host.Patterns = patterns
+				}
+			}
+			tx.dirty[fp] = true
+		}
+	}
+	tx.collect()
+	return deleteHosts, nil
+}
+
+// Changed return the files the transaction modifies, sorted
+func (tx *Transaction) Changed() []string {
+	var paths []string
+	for fp := range tx.dirty {
+		if tx.configMap[fp].String() != string(tx.originals[fp]) {
+			paths = append(paths, fp)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Commit validate the edited files and write them, if one of the writes fails
+// the files already written are restored. The transaction is finished even
+// when Commit fails.
+func (tx *Transaction) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	defer tx.finish()
+
+	paths := tx.Changed()
+	for _, fp := range paths {
+		if _, err := sshconfig.Decode(strings.NewReader(tx.configMap[fp].String())); err != nil {
+			return fmt.Errorf("%s: %v", fp, err)
+		}
+	}
+	var written []string
+	for _, fp := range paths {
+		if err := writeConfig(fp, tx.configMap[fp], backupDir(tx.path)); err != nil {
+			if rerr := tx.restore(written); rerr != nil {
+				return fmt.Errorf("%v, restore: %v", err, rerr)
+			}
+			return err
+		}
+		written = append(written, fp)
+	}
+	return nil
+}
+
+// restore put back the contents the files had when the transaction began
+func (tx *Transaction) restore(paths []string) error {
+	var errs []error
+	for _, fp := range paths {
+		data := tx.originals[fp]
+		if data == nil {
+			if err := os.Remove(fp); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := writeFile(fp, string(data), backupDir(tx.path)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Rollback discard the operations of the transaction, nothing is written
+func (tx *Transaction) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.finish()
+	return nil
+}
+
+func (tx *Transaction) finish() {
+	tx.done = true
+	tx.configMap = nil
+	tx.aliasMap = nil
+	tx.unlock()
+}
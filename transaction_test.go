@@ -0,0 +1,161 @@
+package sshman
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeTxConfigs(t *testing.T) (main, included string) {
+	dir := t.TempDir()
+	main = filepath.Join(dir, "config")
+	included = filepath.Join(dir, "work")
+	require.Nil(t, os.WriteFile(main, []byte(fmt.Sprintf("Include %s\nHost web\n    hostname 10.0.0.1\n", included)), 0600))
+	require.Nil(t, os.WriteFile(included, []byte("Host db\n    hostname 10.0.0.2\n"), 0600))
+	return main, included
+}
+
+func readString(t *testing.T, p string) string {
+	content, err := os.ReadFile(p)
+	require.Nil(t, err)
+	return string(content)
+}
+
+func TestTransactionCommit(t *testing.T) {
+	main, included := writeTxConfigs(t)
+
+	tx, err := Begin(main)
+	require.Nil(t, err)
+	host, err := tx.Add(&AddOption{Alias: "cache", Connect: "root@10.0.0.3:2222"})
+	require.Nil(t, err)
+	require.Equal(t, "2222", host.OwnConfig["port"])
+	_, err = tx.Update(&UpdateOption{Alias: "db", NewAlias: "db1"})
+	require.Nil(t, err)
+	_, err = tx.Delete("web")
+	require.Nil(t, err)
+
+	// later operations see the earlier ones
+	_, ok := tx.Lookup("db1")
+	require.True(t, ok)
+	_, err = tx.Update(&UpdateOption{Alias: "db", Connect: "10.0.0.4"})
+	require.NotNil(t, err)
+
+	// nothing is written before Commit
+	require.NotContains(t, readString(t, main), "cache")
+	require.Equal(t, []string{main, included}, tx.Changed())
+	require.Nil(t, tx.Commit())
+	require.Equal(t, ErrTxDone, tx.Commit())
+	require.Equal(t, ErrTxDone, tx.Rollback())
+
+	hosts, err := List(main, ListOption{})
+	require.Nil(t, err)
+	var aliases []string
+	for _, h := range hosts {
+		aliases = append(aliases, h.Alias)
+	}
+	require.Equal(t, []string{"*", "cache", "db1"}, aliases)
+	require.Contains(t, readString(t, included), "db1")
+}
+
+func TestTransactionResolve(t *testing.T) {
+	main, included := writeTxConfigs(t)
+
+	tx, err := Begin(main)
+	require.Nil(t, err)
+	defer tx.Rollback()
+	for i := 0; i < 3; i++ {
+		_, err := tx.Add(&AddOption{Path: included, Alias: fmt.Sprintf("cache%d", i), Connect: "10.0.0.3"})
+		require.Nil(t, err)
+	}
+	// the operations resolve only the aliases they return
+	require.Equal(t, map[string]bool{"cache2": true}, tx.resolved)
+
+	// a lookup sees the blocks added before it
+	_, err = tx.Add(&AddOption{Alias: "cache*", Config: map[string]string{"user": "redis", "port": "6380"}})
+	require.Nil(t, err)
+	host, ok := tx.Lookup("cache0")
+	require.True(t, ok)
+	require.Equal(t, "redis@10.0.0.3:6380", host.ConnectionStr())
+}
+
+func TestTransactionRollback(t *testing.T) {
+	main, included := writeTxConfigs(t)
+	before, beforeIncluded := readString(t, main), readString(t, included)
+
+	tx, err := Begin(main)
+	require.Nil(t, err)
+	_, err = tx.Add(&AddOption{Alias: "cache", Connect: "10.0.0.3"})
+	require.Nil(t, err)
+	_, err = tx.Delete("db")
+	require.Nil(t, err)
+	require.Nil(t, tx.Rollback())
+	_, err = tx.Add(&AddOption{Alias: "other"})
+	require.Equal(t, ErrTxDone, err)
+
+	require.Equal(t, before, readString(t, main))
+	require.Equal(t, beforeIncluded, readString(t, included))
+
+	// the lock is released
+	_, err = Add(main, &AddOption{Alias: "cache", Connect: "10.0.0.3"})
+	require.Nil(t, err)
+}
+
+func TestApply(t *testing.T) {
+	main, included := writeTxConfigs(t)
+	changes, err := LoadChanges(strings.NewReader(`
+- op: add
+  alias: cache
+  connect: root@10.0.0.3
+  config:
+    port: 2222
+- op: update
+  alias: db
+  config:
+    user: admin
+- op: delete
+  alias: web
+`))
+	require.Nil(t, err)
+	require.Equal(t, 3, len(changes))
+	require.Equal(t, "2222", changes[0].Config["port"])
+	require.Nil(t, Apply(main, changes))
+
+	db, err := Resolve(main, "db")
+	require.Nil(t, err)
+	require.Equal(t, "admin", db.OwnConfig["user"])
+	require.Equal(t, included, db.Path)
+	require.NotContains(t, readString(t, main), "web")
+}
+
+func TestApplyAllOrNothing(t *testing.T) {
+	main, included := writeTxConfigs(t)
+	before, beforeIncluded := readString(t, main), readString(t, included)
+
+	err := Apply(main, []*Change{
+		{Op: "add", Alias: "cache", Connect: "10.0.0.3"},
+		{Op: "update", Alias: "db", Connect: "admin@10.0.0.4"},
+		{Op: "delete", Alias: "missing"},
+	})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "change 3")
+
+	require.Equal(t, before, readString(t, main))
+	require.Equal(t, beforeIncluded, readString(t, included))
+}
+
+func TestLoadChangesInvalid(t *testing.T) {
+	for _, input := range []string{
+		"- op: rename\n  alias: a\n",
+		"- op: add\n",
+		"- op: delete\n  alias: a\n  connect: b\n",
+		"- op: update\n  alias: a\n",
+		"- op: add\n  alias: a\n  unknown: b\n",
+	} {
+		_, err := LoadChanges(strings.NewReader(input))
+		require.NotNil(t, err, input)
+	}
+}
@@ -5,12 +5,12 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/fatih/color"
-	"github.com/sonnt85/gosutils/sregexp"
 )
 
 var (
@@ -35,11 +35,23 @@ func ArgumentsCheck(argCount, min, max int) error {
 // Query values contains keys, key is parterm
 func Query(values, keys []string, ignoreCase bool) bool {
 	contains := func(key string) bool {
+		match := func(value string) bool {
+			if ignoreCase {
+				return strings.Contains(strings.ToLower(value), strings.ToLower(key))
+			}
+			return strings.Contains(value, key)
+		}
+		pattern := key
 		if ignoreCase {
-			key = fmt.Sprintf("(?i:%s)", key)
+			pattern = fmt.Sprintf("(?i:%s)", key)
+		}
+		// keys that are not valid regular expressions, like "*", are
+		// matched literally
+		if re, err := regexp.Compile(pattern); err == nil {
+			match = re.MatchString
 		}
 		for _, value := range values {
-			if sregexp.New(key).MatchString(value) {
+			if match(value) {
 				return true
 			}
 		}
@@ -73,7 +85,7 @@ func GetUsername() string {
 }
 
 // SortKeys sort map keys
-func SortKeys(m map[string]string) []string {
+func SortKeys[V any](m map[string]V) []string {
 	var keys []string
 	for k := range m {
 		keys = append(keys, k)
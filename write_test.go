@@ -0,0 +1,107 @@
+package sshman
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFilePreservesMode(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "config")
+	require.Nil(t, os.WriteFile(p, []byte("Host a\n"), 0640))
+	require.Nil(t, os.Chmod(p, 0640))
+
+	require.Nil(t, writeFile(p, "Host b\n", dir))
+	content, err := os.ReadFile(p)
+	require.Nil(t, err)
+	require.Equal(t, "Host b\n", string(content))
+	info, err := os.Stat(p)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(entries), "temporary file left behind")
+}
+
+func TestWriteFileFollowsSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles-config")
+	link := filepath.Join(dir, "config")
+	require.Nil(t, os.WriteFile(target, []byte("Host a\n"), 0600))
+	require.Nil(t, os.Symlink(target, link))
+
+	require.Nil(t, writeFile(link, "Host b\n", dir))
+	info, err := os.Lstat(link)
+	require.Nil(t, err)
+	require.True(t, info.Mode()&os.ModeSymlink != 0)
+	content, err := os.ReadFile(target)
+	require.Nil(t, err)
+	require.Equal(t, "Host b\n", string(content))
+}
+
+func TestAutoBackup(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "config")
+	require.Nil(t, os.WriteFile(p, []byte("Host a\n    hostname 1.1.1.1\n"), 0600))
+	AutoBackup, BackupDir = true, filepath.Join(dir, "backups")
+	defer func() { AutoBackup, BackupDir = false, "" }()
+
+	_, err := Add(p, &AddOption{Alias: "b", Connect: "2.2.2.2"})
+	require.Nil(t, err)
+	backups, err := filepath.Glob(filepath.Join(BackupDir, "config.*.bak"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(backups))
+	content, err := os.ReadFile(backups[0])
+	require.Nil(t, err)
+	require.Equal(t, "Host a\n    hostname 1.1.1.1\n", string(content))
+}
+
+func TestAutoBackupInclude(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "config")
+	require.Nil(t, os.Mkdir(filepath.Join(dir, "conf.d"), 0700))
+	require.Nil(t, os.WriteFile(p, []byte("Include "+dir+"/conf.d/*\n"), 0600))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "conf.d", "work"), []byte("Host a\n    hostname 1.1.1.1\n"), 0600))
+	AutoBackup = true
+	defer func() { AutoBackup = false }()
+
+	_, err := Update(p, &UpdateOption{Alias: "a", Config: map[string]string{"port": "2222"}})
+	require.Nil(t, err)
+	// the backup is kept out of the Include glob
+	entries, err := os.ReadDir(filepath.Join(dir, "conf.d"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(entries))
+	backups, err := filepath.Glob(filepath.Join(dir, "work.*.bak"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(backups))
+	configMap, _, err := parseConfig(p)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(configMap))
+}
+
+func TestConcurrentAdd(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config")
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = Add(p, &AddOption{Alias: fmt.Sprintf("host%d", i), Connect: "1.2.3.4"})
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.Nil(t, err)
+	}
+
+	hosts, err := List(p, ListOption{})
+	require.Nil(t, err)
+	require.Equal(t, 11, len(hosts))
+}